@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -49,6 +50,52 @@ func GetLogLevel() LogLevel {
 	return LogLevel(logLevel)
 }
 
+// GetLogFormat returns "text" or "json".
+func GetLogFormat() string {
+	if os.Getenv("XUI_LOG_FORMAT") == "json" {
+		return "json"
+	}
+	return "text"
+}
+
+// GetLogLevels returns the per-component levels, e.g. "xray=warning,web=debug".
+func GetLogLevels() string {
+	return os.Getenv("XUI_LOG_LEVELS")
+}
+
+// GetLogFile returns the path of the log file sink, empty if disabled.
+func GetLogFile() string {
+	return os.Getenv("XUI_LOG_FILE")
+}
+
+// GetLogMaxSize returns the size in megabytes at which the log file rotates.
+func GetLogMaxSize() int {
+	return getEnvInt("XUI_LOG_MAX_SIZE", 10)
+}
+
+// GetLogMaxAge returns the days rotated log files are kept.
+func GetLogMaxAge() int {
+	return getEnvInt("XUI_LOG_MAX_AGE", 7)
+}
+
+// GetLogMaxBackups returns how many rotated log files are kept.
+func GetLogMaxBackups() int {
+	return getEnvInt("XUI_LOG_MAX_BACKUPS", 5)
+}
+
+// IsLogCompress reports whether rotated log files are gzipped.
+func IsLogCompress() bool {
+	return os.Getenv("XUI_LOG_COMPRESS") != "false"
+}
+
+func getEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return def
+	}
+	return value
+}
+
 func IsDebug() bool {
 	return os.Getenv("XUI_DEBUG") == "true"
 }
@@ -72,6 +72,17 @@ func InitDB(dbPath string) error {
 		&model.Outbound{},
 		&model.RoutingRule{},
 		&model.Setting{},
+		&model.ServerMetric{},
+		&model.AlertRule{},
+		&model.AlertEvent{},
+		&model.WebhookDelivery{},
+		&model.AccessLog{},
+		&model.ClientIpHistory{},
+		&model.SharingFlag{},
+		&model.IpAccessRule{},
+		&model.IpLimitBlock{},
+		&model.IpLimitClient{},
+		&model.Certificate{},
 		&xray.ClientTraffic{},
 	)
 	if err != nil {
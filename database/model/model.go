@@ -45,6 +45,11 @@ type Inbound struct {
 	StreamSettings string   `json:"streamSettings" form:"streamSettings"`
 	Tag            string   `json:"tag" form:"tag" gorm:"unique"`
 	Sniffing       string   `json:"sniffing" form:"sniffing"`
+
+	// country access, GeoMode is "allow" or "deny" for the comma separated
+	// GeoCountries, empty to accept every country
+	GeoMode      string `json:"geoMode" form:"geoMode"`
+	GeoCountries string `json:"geoCountries" form:"geoCountries"`
 }
 
 type Outbound struct {
@@ -132,6 +137,159 @@ type Setting struct {
 	Value string `json:"value" form:"value"`
 }
 
+// ServerMetric is a sample of server resource usage. Raw samples have a
+// Resolution of 0, downsampled rows hold the average of Resolution seconds
+// starting at Time.
+type ServerMetric struct {
+	Id         int64   `json:"-" gorm:"primaryKey;autoIncrement"`
+	Resolution int     `json:"-" gorm:"index:idx_server_metric_time,priority:1"`
+	Time       int64   `json:"time" gorm:"index:idx_server_metric_time,priority:2"`
+	Cpu        float64 `json:"cpu"`
+	Mem        uint64  `json:"mem"`
+	Swap       uint64  `json:"swap"`
+	Disk       uint64  `json:"disk"`
+	Load       float64 `json:"load"`
+	NetUp      uint64  `json:"netUp"`
+	NetDown    uint64  `json:"netDown"`
+	TcpCount   int     `json:"tcpCount"`
+	UdpCount   int     `json:"udpCount"`
+}
+
+// AlertRule fires when the value of its type passes Threshold for at least
+// Duration seconds. The evaluation state is kept on the rule so it survives
+// restarts.
+type AlertRule struct {
+	Id            int     `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name          string  `json:"name" form:"name"`
+	Type          string  `json:"type" form:"type"`
+	Target        string  `json:"target" form:"target"`
+	Threshold     float64 `json:"threshold" form:"threshold"`
+	Duration      int     `json:"duration" form:"duration"`
+	Cooldown      int     `json:"cooldown" form:"cooldown"`
+	NotifyResolve bool    `json:"notifyResolve" form:"notifyResolve"`
+	Enable        bool    `json:"enable" form:"enable"`
+
+	// state part
+	State        string  `json:"state" form:"-"`
+	Value        float64 `json:"value" form:"-"`
+	PendingSince int64   `json:"pendingSince" form:"-"`
+	LastNotify   int64   `json:"lastNotify" form:"-"`
+}
+
+type AlertEvent struct {
+	Id        int     `json:"id" gorm:"primaryKey;autoIncrement"`
+	RuleId    int     `json:"ruleId" gorm:"index"`
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	State     string  `json:"state"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Time      int64   `json:"time"`
+}
+
+// WebhookDelivery is one attempt chain of sending an event to a webhook.
+type WebhookDelivery struct {
+	Id           int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Event        string `json:"event"`
+	Url          string `json:"url"`
+	Payload      string `json:"payload"`
+	Status       string `json:"status" gorm:"index"`
+	Attempts     int    `json:"attempts"`
+	ResponseCode int    `json:"responseCode"`
+	Error        string `json:"error"`
+	CreatedAt    int64  `json:"createdAt"`
+	UpdatedAt    int64  `json:"updatedAt"`
+	NextAttempt  int64  `json:"nextAttempt"`
+}
+
+// AccessLog is one parsed line of the xray access log.
+type AccessLog struct {
+	Id          int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Time        int64  `json:"time" gorm:"index;index:idx_access_log_email_time,priority:2"`
+	Email       string `json:"email" gorm:"index:idx_access_log_email_time,priority:1"`
+	Source      string `json:"source"`
+	Network     string `json:"network"`
+	Destination string `json:"destination" gorm:"index"`
+	Port        int    `json:"port"`
+	InboundTag  string `json:"inboundTag"`
+	OutboundTag string `json:"outboundTag"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+}
+
+// ClientIpHistory aggregates the sightings of a client from one address.
+type ClientIpHistory struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email     string `json:"email" gorm:"uniqueIndex:idx_client_ip_history,priority:1"`
+	Ip        string `json:"ip" gorm:"uniqueIndex:idx_client_ip_history,priority:2"`
+	Subnet    string `json:"subnet"`
+	Country   string `json:"country"`
+	Asn       uint64 `json:"asn"`
+	AsnOrg    string `json:"asnOrg"`
+	FirstSeen int64  `json:"firstSeen"`
+	LastSeen  int64  `json:"lastSeen" gorm:"index"`
+	Count     int64  `json:"count"`
+}
+
+// SharingFlag marks a client that is likely shared by several people.
+type SharingFlag struct {
+	Id     int64   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email  string  `json:"email" gorm:"index"`
+	Reason string  `json:"reason"`
+	Detail string  `json:"detail"`
+	Value  float64 `json:"value"`
+	Action string  `json:"action"`
+	Time   int64   `json:"time" gorm:"index"`
+}
+
+// IpAccessRule is a manual ban or allow entry of the ip limit firewall. A
+// ban on port 0 covers all ports, ExpiresAt 0 never expires.
+type IpAccessRule struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Type      string `json:"type" form:"type"`
+	Cidr      string `json:"cidr" form:"cidr"`
+	Port      uint16 `json:"port" form:"port"`
+	Remark    string `json:"remark" form:"remark"`
+	ExpiresAt int64  `json:"expiresAt" gorm:"index"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// IpLimitBlock is an active block of the ip limit, kept across restarts.
+type IpLimitBlock struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Ip        string `json:"ip"`
+	Port      uint16 `json:"port"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// IpLimitClient is the saved ip limit state of a client: the addresses or
+// networks holding its slots and its recent offenses.
+type IpLimitClient struct {
+	Email       string `json:"email" gorm:"primaryKey"`
+	Allowed     string `json:"allowed"`
+	Offenses    int    `json:"offenses"`
+	LastOffense int64  `json:"lastOffense"`
+}
+
+// Certificate is a TLS certificate of the certificate store. Inbounds select
+// it by id in their tls settings. Cert holds the PEM chain, leaf first, and
+// Domains the comma separated names it was issued for.
+type Certificate struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	Domains   string `json:"domains"`
+	IsCa      bool   `json:"isCa"`
+	IssuerId  int    `json:"issuerId"`
+	Cert      string `json:"cert"`
+	Key       string `json:"-"`
+	NotBefore int64  `json:"notBefore"`
+	NotAfter  int64  `json:"notAfter" gorm:"index"`
+	WarnedAt  int64  `json:"-"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
 type ClientReverse struct {
 	Tag      string               `json:"tag"`
 	Sniffing json_util.RawMessage `json:"sniffing,omitempty"`
@@ -145,6 +303,7 @@ type Client struct {
 	Email      string         `json:"email"`
 	TotalGB    int64          `json:"totalGB" form:"totalGB"`
 	LimitIP    uint16         `json:"limitIp" form:"limitIp"`
+	IpStrategy string         `json:"ipStrategy,omitempty" form:"ipStrategy"`
 	ExpiryTime int64          `json:"expiryTime" form:"expiryTime"`
 	Enable     bool           `json:"enable" form:"enable"`
 	TgID       string         `json:"tgId" form:"tgId"`
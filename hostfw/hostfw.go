@@ -0,0 +1,116 @@
+// Package hostfw manages the host firewall rules that open the ports of the
+// panel, the subscription server and the inbounds.
+package hostfw
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alireza0/x-ui/util/common"
+)
+
+// Rule accepts Port for the enabled protocols.
+type Rule struct {
+	Port uint16
+	TCP  bool
+	UDP  bool
+}
+
+// Apply replaces the managed rules in one transaction. With defaultDeny
+// every other incoming connection is dropped, except loopback, ICMP and
+// replies to outgoing connections.
+func Apply(rules []Rule, defaultDeny bool) error {
+	return apply(rules, defaultDeny)
+}
+
+// Remove deletes the managed rules, it is a no-op if there are none.
+func Remove() error {
+	return remove()
+}
+
+// ParsePorts parses a comma separated list of ports. A port is opened for
+// TCP unless it ends with "/udp", or "/tcp+udp" for both.
+func ParsePorts(value string) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		port, proto, _ := strings.Cut(item, "/")
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || n == 0 {
+			return nil, common.NewError("invalid port:", item)
+		}
+		rule := Rule{Port: uint16(n)}
+		switch strings.ToLower(proto) {
+		case "", "tcp":
+			rule.TCP = true
+		case "udp":
+			rule.UDP = true
+		case "tcp+udp":
+			rule.TCP, rule.UDP = true, true
+		default:
+			return nil, common.NewError("invalid port:", item)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+const sshdConfigPath = "/etc/ssh/sshd_config"
+
+// SSHPorts returns the ports sshd listens on according to its config and
+// the files it includes, or 22 when they set none.
+func SSHPorts() []uint16 {
+	return sshPorts(sshdConfigPath)
+}
+
+func sshPorts(configPath string) []uint16 {
+	ports := make([]uint16, 0)
+	readSSHPorts(configPath, filepath.Dir(configPath), &ports, 0)
+	if len(ports) == 0 {
+		ports = append(ports, 22)
+	}
+	return ports
+}
+
+// readSSHPorts adds the Port values of configPath to ports. Includes are
+// followed where they appear, relative paths resolve under dir like sshd
+// does. A Match block ends the file, it can not set the port.
+func readSSHPorts(configPath string, dir string, ports *[]uint16, depth int) {
+	data, err := os.ReadFile(configPath)
+	if err != nil || depth > 8 {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '='
+		})
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "match":
+			return
+		case "include":
+			for _, pattern := range fields[1:] {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(dir, pattern)
+				}
+				files, _ := filepath.Glob(pattern)
+				sort.Strings(files)
+				for _, file := range files {
+					readSSHPorts(file, dir, ports, depth+1)
+				}
+			}
+		case "port":
+			if n, err := strconv.ParseUint(fields[1], 10, 16); err == nil && n > 0 {
+				*ports = append(*ports, uint16(n))
+			}
+		}
+	}
+}
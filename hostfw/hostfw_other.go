@@ -0,0 +1,13 @@
+//go:build !linux
+
+package hostfw
+
+import "github.com/alireza0/x-ui/util/common"
+
+func apply(rules []Rule, defaultDeny bool) error {
+	return common.NewError("host firewall is only supported on linux")
+}
+
+func remove() error {
+	return nil
+}
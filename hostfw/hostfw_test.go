@@ -0,0 +1,75 @@
+package hostfw
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSSHPorts(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		config string
+		want   []uint16
+	}{
+		{"", []uint16{22}},
+		{"#Port 22\nPermitRootLogin no\n", []uint16{22}},
+		{"Port 2222\n", []uint16{2222}},
+		{"port\t2222\nPort=2200\nPort 0\nPort x\n", []uint16{2222, 2200}},
+		{"Port 2222\nMatch User git\n  Port 3333\n", []uint16{2222}},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, "sshd_config")
+		if err := os.WriteFile(path, []byte(test.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := sshPorts(path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("config %d: got %v, want %v", i, got, test.want)
+		}
+	}
+	if got := sshPorts(filepath.Join(dir, "missing")); !reflect.DeepEqual(got, []uint16{22}) {
+		t.Errorf("missing config: got %v", got)
+	}
+}
+
+func TestSSHPortsInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"sshd_config":                "Include sshd_config.d/*.conf\nPort 22\nMatch User git\n  Include extra.conf\n",
+		"sshd_config.d/50-port.conf": "# custom port\nPort 2222\n",
+		"sshd_config.d/60-abs.conf":  "Include " + filepath.Join(dir, "abs.conf") + "\n",
+		"sshd_config.d/notes.txt":    "Port 1111\n",
+		"abs.conf":                   "Port 2200\nMatch Address 10.0.0.0/8\n  Port 3333\n",
+		"extra.conf":                 "Port 4444\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []uint16{2222, 2200, 22}
+	if got := sshPorts(filepath.Join(dir, "sshd_config")); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	rules, err := ParsePorts(" 22, 53/udp,443/TCP+udp,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{{Port: 22, TCP: true}, {Port: 53, UDP: true}, {Port: 443, TCP: true, UDP: true}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("got %v, want %v", rules, want)
+	}
+	for _, value := range []string{"0", "65536", "22/sctp", "ssh"} {
+		if _, err := ParsePorts(value); err == nil {
+			t.Errorf("%q was accepted", value)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+//go:build linux
+
+package hostfw
+
+import (
+	"encoding/binary"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	tableName = "xui_host"
+	chainName = "input"
+)
+
+func hostTable() *nftables.Table {
+	return &nftables.Table{Name: tableName, Family: nftables.TableFamilyINet}
+}
+
+// ifname returns name padded the way the kernel compares interface names.
+func ifname(name string) []byte {
+	b := make([]byte, unix.IFNAMSIZ)
+	copy(b, name)
+	return b
+}
+
+func acceptExprs(match ...expr.Any) []expr.Any {
+	return append(match, &expr.Verdict{Kind: expr.VerdictAccept})
+}
+
+// portRuleExprs builds "meta l4proto <proto> th dport <port> accept".
+func portRuleExprs(port uint16, proto byte) []expr.Any {
+	portData := make([]byte, 2)
+	binary.BigEndian.PutUint16(portData, port)
+	return acceptExprs(
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       2,
+			Len:          2,
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: portData},
+	)
+}
+
+// baseRuleExprs returns the rules that keep the host usable with a drop
+// policy: loopback, established connections and ICMP.
+func baseRuleExprs() [][]expr.Any {
+	return [][]expr.Any{
+		acceptExprs(
+			&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifname("lo")},
+		),
+		acceptExprs(
+			&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+			&expr.Bitwise{
+				SourceRegister: 1,
+				DestRegister:   1,
+				Len:            4,
+				Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED),
+				Xor:            binaryutil.NativeEndian.PutUint32(0),
+			},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+		),
+		acceptExprs(
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_ICMP}},
+		),
+		acceptExprs(
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_ICMPV6}},
+		),
+	}
+}
+
+func apply(rules []Rule, defaultDeny bool) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	table := hostTable()
+	// Adding the table first makes the delete valid when it does not exist
+	// yet, the batch then swaps the old rules for the new ones at once.
+	conn.AddTable(table)
+	conn.DelTable(table)
+	conn.AddTable(table)
+
+	policy := nftables.ChainPolicyAccept
+	if defaultDeny {
+		policy = nftables.ChainPolicyDrop
+	}
+	chain := conn.AddChain(&nftables.Chain{
+		Name:     chainName,
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookInput,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &policy,
+	})
+	exprs := make([][]expr.Any, 0, len(rules)*2+4)
+	if defaultDeny {
+		exprs = append(exprs, baseRuleExprs()...)
+	}
+	for _, rule := range rules {
+		if rule.TCP {
+			exprs = append(exprs, portRuleExprs(rule.Port, unix.IPPROTO_TCP))
+		}
+		if rule.UDP {
+			exprs = append(exprs, portRuleExprs(rule.Port, unix.IPPROTO_UDP))
+		}
+	}
+	for _, e := range exprs {
+		conn.AddRule(&nftables.Rule{Table: table, Chain: chain, Exprs: e})
+	}
+	return conn.Flush()
+}
+
+func remove() error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	table := hostTable()
+	conn.AddTable(table)
+	conn.DelTable(table)
+	return conn.Flush()
+}
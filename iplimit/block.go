@@ -1,21 +1,57 @@
 package iplimit
 
-import "time"
+import (
+	"net"
+	"time"
+)
 
+// BlockDuration is the default time an address stays blocked.
 const BlockDuration = 60 * time.Second
 
+// Firewall backends, BackendAuto picks the first usable one.
+const (
+	BackendAuto     = "auto"
+	BackendNftables = "nftables"
+	BackendIptables = "iptables"
+	BackendNone     = "none"
+)
+
 type BlockKey struct {
 	IP   string
 	Port uint16
 }
 
+// CountryRule limits the sources of an inbound port. With Allow only the
+// networks may connect, otherwise the networks are dropped.
+type CountryRule struct {
+	Port     uint16
+	Allow    bool
+	Networks []*net.IPNet
+}
+
+// BanRule drops a network on Port, or on every port if Port is 0.
+type BanRule struct {
+	Network *net.IPNet
+	Port    uint16
+}
+
 type Firewall interface {
 	Supported() bool
+	Backend() string
 	Init() (err error)
 	Stop() (err error)
-	Block(key BlockKey) (err error)
+	// Block drops key for duration, blocking an address again restarts
+	// its duration.
+	Block(key BlockKey, duration time.Duration) (err error)
+	Unblock(key BlockKey) (err error)
+	SetCountryRules(rules []CountryRule) (err error)
+	// SetAccessLists replaces the manual bans and the networks that are
+	// never dropped, neither by bans, blocks nor country rules.
+	SetAccessLists(bans []BanRule, allowed []*net.IPNet) (err error)
 }
 
-func NewFirewall() Firewall {
-	return newPlatformFirewall()
+// NewFirewall returns the firewall of backend, or the first usable one for
+// BackendAuto. Without a usable backend the firewall is not Supported.
+func NewFirewall(backend string) Firewall {
+	return newPlatformFirewall(backend)
 }
@@ -0,0 +1,25 @@
+//go:build linux
+
+package iplimit
+
+import "github.com/alireza0/x-ui/logger"
+
+func newPlatformFirewall(backend string) Firewall {
+	switch backend {
+	case BackendNftables:
+		return &nftFirewall{}
+	case BackendIptables:
+		return &iptablesFirewall{}
+	case BackendNone:
+		return &stubFirewall{}
+	}
+	if nftablesUsable() {
+		return &nftFirewall{}
+	}
+	if iptablesUsable() {
+		logger.Info("nftables is not usable, ip limit uses iptables and ipset")
+		return &iptablesFirewall{}
+	}
+	logger.Warning("neither nftables nor iptables with ipset is usable, ip limit is disabled")
+	return &stubFirewall{}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package iplimit
+
+func newPlatformFirewall(backend string) Firewall {
+	return &stubFirewall{}
+}
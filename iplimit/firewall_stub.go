@@ -0,0 +1,41 @@
+package iplimit
+
+import (
+	"net"
+	"time"
+)
+
+// stubFirewall is used when no backend is usable, nothing is blocked.
+type stubFirewall struct{}
+
+func (stubFirewall) Block(key BlockKey, duration time.Duration) error {
+	return nil
+}
+
+func (stubFirewall) Unblock(key BlockKey) error {
+	return nil
+}
+
+func (stubFirewall) SetAccessLists(bans []BanRule, allowed []*net.IPNet) error {
+	return nil
+}
+
+func (stubFirewall) SetCountryRules(rules []CountryRule) error {
+	return nil
+}
+
+func (stubFirewall) Init() error {
+	return nil
+}
+
+func (stubFirewall) Stop() error {
+	return nil
+}
+
+func (stubFirewall) Supported() bool {
+	return false
+}
+
+func (stubFirewall) Backend() string {
+	return BackendNone
+}
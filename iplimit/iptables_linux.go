@@ -0,0 +1,405 @@
+//go:build linux
+
+package iplimit
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/util/common"
+)
+
+const (
+	iptablesChain    = "XUI_IPLIMIT"
+	iptablesGeoChain = "XUI_GEO"
+	iptablesBanChain = "XUI_BAN"
+	ipsetNameV4      = "xui_blocked"
+	ipsetNameV6      = "xui_blocked6"
+	ipsetAllowV4     = "xui_allow"
+	ipsetAllowV6     = "xui_allow6"
+	ipsetGeoPrefix   = "xui_geo"
+	ipsetGeoMaxElem  = "1048576"
+)
+
+// iptablesFirewall blocks with ipset sets that expire their entries, for
+// hosts where nftables cannot be used over netlink.
+type iptablesFirewall struct {
+	mu      sync.Mutex
+	ipv6    bool
+	ready   bool
+	geoSets []string
+	geoGen  int
+	// blocked holds the expiry of the entries added to the block sets. The
+	// kernel expires them itself, so an entry is only added again when its
+	// deadline moved.
+	blocked map[string]time.Time
+}
+
+// iptablesUsable reports whether iptables and ipset are installed and can
+// be used with the current privileges.
+func iptablesUsable() bool {
+	for _, name := range []string{"iptables", "ipset"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return false
+		}
+	}
+	if _, err := runCommand("ipset", "list", "-n"); err != nil {
+		return false
+	}
+	_, err := runCommand("iptables", "-w", "-n", "-L", "INPUT")
+	return err == nil
+}
+
+func runCommand(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return "", common.NewErrorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (f *iptablesFirewall) Supported() bool {
+	return true
+}
+
+func (f *iptablesFirewall) Backend() string {
+	return BackendIptables
+}
+
+// tables returns the commands of the enabled address families with the
+// block set used by each.
+func (f *iptablesFirewall) tables() map[string]string {
+	tables := map[string]string{"iptables": ipsetNameV4}
+	if f.ipv6 {
+		tables["ip6tables"] = ipsetNameV6
+	}
+	return tables
+}
+
+// allowSet returns the allow set used by table.
+func allowSet(table string) string {
+	if table == "ip6tables" {
+		return ipsetAllowV6
+	}
+	return ipsetAllowV4
+}
+
+// addAllowRule returns early from chain for the allowed networks.
+func addAllowRule(table string, chain string) error {
+	_, err := runCommand(table, "-w", "-A", chain, "-m", "set", "--match-set", allowSet(table), "src", "-j", "RETURN")
+	return err
+}
+
+func (f *iptablesFirewall) Init() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := exec.LookPath("ip6tables")
+	f.ipv6 = err == nil
+
+	// Remove leftovers from a previous run.
+	f.cleanup()
+
+	timeout := strconv.Itoa(int(BlockDuration.Seconds()))
+	if _, err := runCommand("ipset", "create", ipsetNameV4, "hash:ip,port", "family", "inet", "timeout", timeout); err != nil {
+		return err
+	}
+	if _, err := runCommand("ipset", "create", ipsetAllowV4, "hash:net", "family", "inet"); err != nil {
+		return err
+	}
+	if f.ipv6 {
+		if _, err := runCommand("ipset", "create", ipsetNameV6, "hash:ip,port", "family", "inet6", "timeout", timeout); err != nil {
+			return err
+		}
+		if _, err := runCommand("ipset", "create", ipsetAllowV6, "hash:net", "family", "inet6"); err != nil {
+			return err
+		}
+	}
+	for table, set := range f.tables() {
+		for _, chain := range []string{iptablesChain, iptablesGeoChain, iptablesBanChain} {
+			if _, err := runCommand(table, "-w", "-N", chain); err != nil {
+				return err
+			}
+			if _, err := runCommand(table, "-w", "-I", "INPUT", "-j", chain); err != nil {
+				return err
+			}
+			if err := addAllowRule(table, chain); err != nil {
+				return err
+			}
+		}
+		if _, err := runCommand(table, "-w", "-A", iptablesChain, "-m", "set", "--match-set", set, "src,dst", "-j", "DROP"); err != nil {
+			return err
+		}
+	}
+	f.ready = true
+	return nil
+}
+
+// cleanup removes the chains and sets, errors of missing ones are ignored.
+func (f *iptablesFirewall) cleanup() {
+	for _, table := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(table); err != nil {
+			continue
+		}
+		for _, chain := range []string{iptablesChain, iptablesGeoChain, iptablesBanChain} {
+			for i := 0; i < 8; i++ {
+				if _, err := runCommand(table, "-w", "-D", "INPUT", "-j", chain); err != nil {
+					break
+				}
+			}
+			runCommand(table, "-w", "-F", chain)
+			runCommand(table, "-w", "-X", chain)
+		}
+	}
+	sets := []string{ipsetNameV4, ipsetNameV6, ipsetAllowV4, ipsetAllowV6}
+	if out, err := runCommand("ipset", "list", "-n"); err == nil {
+		for _, name := range strings.Fields(out) {
+			if strings.HasPrefix(name, ipsetGeoPrefix) {
+				sets = append(sets, name)
+			}
+		}
+	}
+	for _, set := range sets {
+		runCommand("ipset", "destroy", set)
+	}
+	f.geoSets = nil
+	f.blocked = make(map[string]time.Time)
+}
+
+func (f *iptablesFirewall) Stop() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.ready {
+		return nil
+	}
+	f.cleanup()
+	f.ready = false
+	return nil
+}
+
+// blockEntries returns the set and the tcp and udp entries of key.
+func (f *iptablesFirewall) blockEntries(key BlockKey) (string, []string, error) {
+	ip := net.ParseIP(strings.Trim(key.IP, "[]"))
+	if ip == nil {
+		return "", nil, common.NewErrorf("invalid ip: %s", key.IP)
+	}
+	set := ipsetNameV4
+	if ip.To4() == nil {
+		if !f.ipv6 {
+			return "", nil, common.NewError("ip6tables is not available to block", key.IP)
+		}
+		set = ipsetNameV6
+	}
+	entries := make([]string, 0, 2)
+	for _, proto := range []string{"tcp", "udp"} {
+		entries = append(entries, fmt.Sprintf("%s,%s:%d", ip.String(), proto, key.Port))
+	}
+	return set, entries, nil
+}
+
+func (f *iptablesFirewall) Block(key BlockKey, duration time.Duration) error {
+	if !f.ready {
+		return common.NewError("iptables not ready")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set, entries, err := f.blockEntries(key)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	deadline := now.Add(duration)
+	var input strings.Builder
+	timeout := strconv.Itoa(max(int(duration.Seconds()), 1))
+	for _, entry := range entries {
+		// the deadlines of a reapplied block differ by the rounding to seconds
+		if expiry, ok := f.blocked[set+" "+entry]; ok && expiry.After(now) &&
+			expiry.Sub(deadline).Abs() < 2*time.Second {
+			continue
+		}
+		fmt.Fprintf(&input, "add %s %s timeout %s\n", set, entry, timeout)
+	}
+	if input.Len() == 0 {
+		return nil
+	}
+	if err := ipsetRestore(input.String()); err != nil {
+		return err
+	}
+	for entry, expiry := range f.blocked {
+		if !expiry.After(now) {
+			delete(f.blocked, entry)
+		}
+	}
+	for _, entry := range entries {
+		f.blocked[set+" "+entry] = deadline
+	}
+	return nil
+}
+
+func (f *iptablesFirewall) Unblock(key BlockKey) error {
+	if !f.ready {
+		return common.NewError("iptables not ready")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set, entries, err := f.blockEntries(key)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := runCommand("ipset", "del", "-exist", set, entry); err != nil {
+			return err
+		}
+		delete(f.blocked, set+" "+entry)
+	}
+	return nil
+}
+
+// addGeoSet creates a hash:net set with networks of one family.
+func (f *iptablesFirewall) addGeoSet(name string, networks []*net.IPNet, ipv4 bool) error {
+	family := "inet6"
+	if ipv4 {
+		family = "inet"
+	}
+	if _, err := runCommand("ipset", "create", name, "hash:net", "family", family, "maxelem", ipsetGeoMaxElem); err != nil {
+		return err
+	}
+	return fillNetSet(name, networks, ipv4)
+}
+
+// fillNetSet adds the networks of one family to a hash:net set.
+func fillNetSet(name string, networks []*net.IPNet, ipv4 bool) error {
+	var input strings.Builder
+	for _, network := range networks {
+		if (network.IP.To4() != nil) != ipv4 {
+			continue
+		}
+		fmt.Fprintf(&input, "add %s %s\n", name, network.String())
+	}
+	return ipsetRestore(input.String())
+}
+
+// ipsetRestore runs the ipset commands of input in one process.
+func ipsetRestore(input string) error {
+	cmd := exec.Command("ipset", "restore", "-exist")
+	cmd.Stdin = strings.NewReader(input)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return common.NewErrorf("ipset restore: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SetCountryRules replaces the country rules. The new sets are filled
+// before the chain is rebuilt.
+func (f *iptablesFirewall) SetCountryRules(rules []CountryRule) error {
+	if !f.ready {
+		return common.NewError("iptables not ready")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.geoGen++
+	sets := make([]string, 0, len(rules)*2)
+	removeSets := func(sets []string) {
+		for _, set := range sets {
+			runCommand("ipset", "destroy", set)
+		}
+	}
+	for i, rule := range rules {
+		name := fmt.Sprintf("%s%d_%d", ipsetGeoPrefix, f.geoGen, i)
+		sets = append(sets, name)
+		if err := f.addGeoSet(name, rule.Networks, true); err != nil {
+			removeSets(sets)
+			return err
+		}
+		if f.ipv6 {
+			sets = append(sets, name+"_6")
+			if err := f.addGeoSet(name+"_6", rule.Networks, false); err != nil {
+				removeSets(sets)
+				return err
+			}
+		}
+	}
+
+	// Sets of a failed rebuild may be referenced, they go with the next one.
+	old := append(f.geoSets, sets...)
+	for table := range f.tables() {
+		if _, err := runCommand(table, "-w", "-F", iptablesGeoChain); err != nil {
+			f.geoSets = old
+			return err
+		}
+		if err := addAllowRule(table, iptablesGeoChain); err != nil {
+			f.geoSets = old
+			return err
+		}
+		for i, rule := range rules {
+			set := fmt.Sprintf("%s%d_%d", ipsetGeoPrefix, f.geoGen, i)
+			if table == "ip6tables" {
+				set += "_6"
+			}
+			for _, proto := range []string{"tcp", "udp"} {
+				args := []string{"-w", "-A", iptablesGeoChain, "-p", proto, "--dport", strconv.Itoa(int(rule.Port)), "-m", "set"}
+				if rule.Allow {
+					args = append(args, "!")
+				}
+				args = append(args, "--match-set", set, "src", "-j", "DROP")
+				if _, err := runCommand(table, args...); err != nil {
+					f.geoSets = old
+					return err
+				}
+			}
+		}
+	}
+	removeSets(old[:len(old)-len(sets)])
+	f.geoSets = sets
+	return nil
+}
+
+// SetAccessLists refills the allow sets and rebuilds the ban chain.
+func (f *iptablesFirewall) SetAccessLists(bans []BanRule, allowed []*net.IPNet) error {
+	if !f.ready {
+		return common.NewError("iptables not ready")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for table := range f.tables() {
+		set := allowSet(table)
+		if _, err := runCommand("ipset", "flush", set); err != nil {
+			return err
+		}
+		if err := fillNetSet(set, allowed, table == "iptables"); err != nil {
+			return err
+		}
+
+		if _, err := runCommand(table, "-w", "-F", iptablesBanChain); err != nil {
+			return err
+		}
+		if err := addAllowRule(table, iptablesBanChain); err != nil {
+			return err
+		}
+		for _, ban := range bans {
+			if (ban.Network.IP.To4() != nil) != (table == "iptables") {
+				continue
+			}
+			args := []string{"-w", "-A", iptablesBanChain, "-s", ban.Network.String()}
+			if ban.Port == 0 {
+				if _, err := runCommand(table, append(args, "-j", "DROP")...); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, proto := range []string{"tcp", "udp"} {
+				portArgs := append(args[:len(args):len(args)], "-p", proto, "--dport", strconv.Itoa(int(ban.Port)), "-j", "DROP")
+				if _, err := runCommand(table, portArgs...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
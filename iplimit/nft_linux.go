@@ -4,8 +4,10 @@ package iplimit
 
 import (
 	"encoding/binary"
+	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/alireza0/x-ui/util/common"
 	"github.com/google/nftables"
@@ -16,8 +18,12 @@ import (
 const (
 	filterTableName = "xui"
 	inputChainName  = "iplimit_input"
+	geoChainName    = "geo_input"
+	banChainName    = "ban_input"
 	nftSetNameV4    = "xui_blocked"
 	nftSetNameV6    = "xui_blocked_ip6"
+	nftAllowSetV4   = "xui_allow"
+	nftAllowSetV6   = "xui_allow_ip6"
 )
 
 // Concatenated set keys are laid out in consecutive 4-byte registers, each field
@@ -49,16 +55,36 @@ type nftFirewall struct {
 	setV4 *nftables.Set
 	setV6 *nftables.Set
 	ready bool
-}
 
-func newPlatformFirewall() Firewall {
-	return &nftFirewall{}
+	geoChain *nftables.Chain
+	geoSets  []*nftables.Set
+	geoGen   int
+
+	banChain *nftables.Chain
+	allowV4  *nftables.Set
+	allowV6  *nftables.Set
 }
 
 func (f *nftFirewall) Supported() bool {
 	return true
 }
 
+func (f *nftFirewall) Backend() string {
+	return BackendNftables
+}
+
+// nftablesUsable reports whether tables can be changed over netlink.
+func nftablesUsable() bool {
+	conn, err := nftables.New()
+	if err != nil {
+		return false
+	}
+	table := &nftables.Table{Name: filterTableName + "_probe", Family: nftables.TableFamilyINet}
+	conn.AddTable(table)
+	conn.DelTable(table)
+	return conn.Flush() == nil
+}
+
 // blockRuleExprs builds "<family> saddr . <l4> dport @set drop". The source
 // address occupies the lookup base register (NFT_REG32_00); the destination port
 // goes into the next free 4-byte register after the address (one slot for IPv4,
@@ -165,10 +191,47 @@ func (f *nftFirewall) Init() error {
 		Timeout:       BlockDuration,
 	}
 
+	f.geoChain = &nftables.Chain{
+		Name:     geoChainName,
+		Table:    f.table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookInput,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &policy,
+	}
+	f.geoSets = nil
+	f.banChain = &nftables.Chain{
+		Name:     banChainName,
+		Table:    f.table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookInput,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &policy,
+	}
+	f.allowV4 = &nftables.Set{
+		Name:     nftAllowSetV4,
+		Table:    f.table,
+		KeyType:  nftables.TypeIPAddr,
+		Interval: true,
+	}
+	f.allowV6 = &nftables.Set{
+		Name:     nftAllowSetV6,
+		Table:    f.table,
+		KeyType:  nftables.TypeIP6Addr,
+		Interval: true,
+	}
+
 	f.conn.AddTable(f.table)
 	f.conn.AddChain(f.chain)
+	f.conn.AddChain(f.geoChain)
+	f.conn.AddChain(f.banChain)
 	f.conn.AddSet(f.setV4, nil)
 	f.conn.AddSet(f.setV6, nil)
+	f.conn.AddSet(f.allowV4, nil)
+	f.conn.AddSet(f.allowV6, nil)
+	for _, chain := range []*nftables.Chain{f.chain, f.geoChain, f.banChain} {
+		f.addAllowRules(chain)
+	}
 	f.addBlockRules()
 
 	if err := f.conn.Flush(); err != nil {
@@ -192,35 +255,368 @@ func (f *nftFirewall) Stop() error {
 	return err
 }
 
-func (f *nftFirewall) Block(key BlockKey) error {
+func parseBlockIP(value string) (net.IP, error) {
+	if n := len(value); n >= 2 && value[0] == '[' && value[n-1] == ']' {
+		value = value[1 : n-1]
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, common.NewErrorf("invalid ip: %s", value)
+	}
+	return ip, nil
+}
+
+// blockElement returns the set and element of key.
+func (f *nftFirewall) blockElement(key BlockKey) (*nftables.Set, []nftables.SetElement, error) {
+	ip, err := parseBlockIP(key.IP)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return f.setV4, []nftables.SetElement{{Key: concatBlockKeyV4(v4, key.Port)}}, nil
+	}
+	return f.setV6, []nftables.SetElement{{Key: concatBlockKeyV6(ip.To16(), key.Port)}}, nil
+}
+
+func (f *nftFirewall) Block(key BlockKey, duration time.Duration) error {
 	if !f.ready {
 		return common.NewError("nftables not ready")
 	}
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	ipStr := key.IP
-	if n := len(ipStr); n >= 2 && ipStr[0] == '[' && ipStr[n-1] == ']' {
-		ipStr = ipStr[1 : n-1]
+	set, elements, err := f.blockElement(key)
+	if err != nil {
+		return err
 	}
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return common.NewErrorf("invalid ip: %s", key.IP)
+	for i := range elements {
+		elements[i].Timeout = duration
 	}
-	if v4 := ip.To4(); v4 != nil {
-		if err := f.conn.SetAddElements(f.setV4, []nftables.SetElement{
-			{Key: concatBlockKeyV4(v4, key.Port)},
-		}); err != nil {
-			return err
+	// Adding an existing element keeps its timeout, so it is replaced. The
+	// batch fails as a whole if the element does not exist yet.
+	if err := f.conn.SetDeleteElements(set, elements); err != nil {
+		return err
+	}
+	if err := f.conn.SetAddElements(set, elements); err != nil {
+		return err
+	}
+	if err := f.conn.Flush(); err == nil {
+		return nil
+	}
+	if err := f.conn.SetAddElements(set, elements); err != nil {
+		return err
+	}
+	return f.conn.Flush()
+}
+
+func (f *nftFirewall) Unblock(key BlockKey) error {
+	if !f.ready {
+		return common.NewError("nftables not ready")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set, elements, err := f.blockElement(key)
+	if err != nil {
+		return err
+	}
+	if err := f.conn.SetDeleteElements(set, elements); err != nil {
+		return err
+	}
+	return f.conn.Flush()
+}
+
+// Elements per netlink message, an attribute is limited to 64 KiB.
+const geoSetChunk = 512
+
+// countryRuleExprs builds "<family> <l4> dport <port> <family> saddr [!=] @set drop".
+func countryRuleExprs(set *nftables.Set, port uint16, allow bool, ipv4 bool, tcp bool) []expr.Any {
+	nfproto := byte(unix.NFPROTO_IPV6)
+	srcOffset := uint32(8)
+	srcLen := uint32(16)
+	if ipv4 {
+		nfproto = byte(unix.NFPROTO_IPV4)
+		srcOffset = 12
+		srcLen = 4
+	}
+	l4proto := byte(unix.IPPROTO_UDP)
+	if tcp {
+		l4proto = byte(unix.IPPROTO_TCP)
+	}
+	portData := make([]byte, 2)
+	binary.BigEndian.PutUint16(portData, port)
+
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{nfproto}},
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{l4proto}},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       2,
+			Len:          2,
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: portData},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       srcOffset,
+			Len:          srcLen,
+		},
+		&expr.Lookup{
+			SourceRegister: 1,
+			SetName:        set.Name,
+			SetID:          set.ID,
+			Invert:         allow,
+		},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	}
+}
+
+// addGeoSet creates an interval set with the ranges of networks. Large sets
+// are filled with several batches.
+func (f *nftFirewall) addGeoSet(name string, networks []*net.IPNet, ipv4 bool) (*nftables.Set, error) {
+	set := &nftables.Set{
+		Name:     name,
+		Table:    f.table,
+		KeyType:  nftables.TypeIP6Addr,
+		Interval: true,
+	}
+	size := net.IPv6len
+	if ipv4 {
+		set.KeyType = nftables.TypeIPAddr
+		size = net.IPv4len
+	}
+	if err := f.conn.AddSet(set, nil); err != nil {
+		return nil, err
+	}
+	if err := f.conn.Flush(); err != nil {
+		return nil, err
+	}
+	return set, f.fillIntervalSet(set, networks, size)
+}
+
+// fillIntervalSet adds the merged ranges of networks to an interval set of
+// the family of size.
+func (f *nftFirewall) fillIntervalSet(set *nftables.Set, networks []*net.IPNet, size int) error {
+	elements := make([]nftables.SetElement, 0, geoSetChunk)
+	for _, r := range mergeNetworks(networks, size) {
+		elements = append(elements, nftables.SetElement{Key: r.start})
+		if end, overflow := nextIP(r.end); !overflow {
+			elements = append(elements, nftables.SetElement{Key: end, IntervalEnd: true})
+		}
+		if len(elements) >= geoSetChunk {
+			if err := f.conn.SetAddElements(set, elements); err != nil {
+				return err
+			}
+			if err := f.conn.Flush(); err != nil {
+				return err
+			}
+			elements = elements[:0]
 		}
-	} else if v6 := ip.To16(); v6 != nil {
-		if err := f.conn.SetAddElements(f.setV6, []nftables.SetElement{
-			{Key: concatBlockKeyV6(v6, key.Port)},
-		}); err != nil {
+	}
+	if len(elements) > 0 {
+		if err := f.conn.SetAddElements(set, elements); err != nil {
 			return err
 		}
+		return f.conn.Flush()
+	}
+	return nil
+}
+
+// SetCountryRules replaces the country rules. The new sets are filled
+// before the rules are swapped, so the old rules stay active meanwhile.
+func (f *nftFirewall) SetCountryRules(rules []CountryRule) error {
+	if !f.ready {
+		return common.NewError("nftables not ready")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.geoGen++
+	sets := make([]*nftables.Set, 0, len(rules)*2)
+	removeSets := func(sets []*nftables.Set) {
+		for _, set := range sets {
+			f.conn.DelSet(set)
+		}
+		_ = f.conn.Flush()
+	}
+	for i, rule := range rules {
+		for _, ipv4 := range []bool{true, false} {
+			family := "v6"
+			if ipv4 {
+				family = "v4"
+			}
+			set, err := f.addGeoSet(fmt.Sprintf("geo%d_%d_%s", f.geoGen, i, family), rule.Networks, ipv4)
+			if set != nil {
+				sets = append(sets, set)
+			}
+			if err != nil {
+				removeSets(sets)
+				return err
+			}
+		}
+	}
+
+	f.conn.FlushChain(f.geoChain)
+	f.addAllowRules(f.geoChain)
+	for i, rule := range rules {
+		for j, ipv4 := range []bool{true, false} {
+			for _, tcp := range []bool{true, false} {
+				f.conn.AddRule(&nftables.Rule{
+					Table: f.table,
+					Chain: f.geoChain,
+					Exprs: countryRuleExprs(sets[i*2+j], rule.Port, rule.Allow, ipv4, tcp),
+				})
+			}
+		}
+	}
+	for _, set := range f.geoSets {
+		f.conn.DelSet(set)
 	}
 	if err := f.conn.Flush(); err != nil {
+		removeSets(sets)
 		return err
 	}
+	f.geoSets = sets
 	return nil
 }
+
+// allowRuleExprs builds "<family> saddr @allow accept".
+func allowRuleExprs(set *nftables.Set, ipv4 bool) []expr.Any {
+	nfproto := byte(unix.NFPROTO_IPV6)
+	srcOffset := uint32(8)
+	srcLen := uint32(16)
+	if ipv4 {
+		nfproto = byte(unix.NFPROTO_IPV4)
+		srcOffset = 12
+		srcLen = 4
+	}
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{nfproto}},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       srcOffset,
+			Len:          srcLen,
+		},
+		&expr.Lookup{
+			SourceRegister: 1,
+			SetName:        set.Name,
+			SetID:          set.ID,
+		},
+		&expr.Verdict{Kind: expr.VerdictAccept},
+	}
+}
+
+// addAllowRules accepts the allowed networks first in chain. An accept
+// only ends one base chain, so every chain that drops starts with them.
+func (f *nftFirewall) addAllowRules(chain *nftables.Chain) {
+	for _, rule := range []struct {
+		set *nftables.Set
+		v4  bool
+	}{
+		{f.allowV4, true},
+		{f.allowV6, false},
+	} {
+		f.conn.AddRule(&nftables.Rule{
+			Table: f.table,
+			Chain: chain,
+			Exprs: allowRuleExprs(rule.set, rule.v4),
+		})
+	}
+}
+
+// banRuleExprs builds "<family> saddr <network> [<l4> dport <port>] drop".
+func banRuleExprs(ban BanRule, tcp bool) []expr.Any {
+	ip := ban.Network.IP.To4()
+	nfproto := byte(unix.NFPROTO_IPV4)
+	srcOffset := uint32(12)
+	if ip == nil {
+		ip = ban.Network.IP.To16()
+		nfproto = byte(unix.NFPROTO_IPV6)
+		srcOffset = 8
+	}
+	mask := []byte(ban.Network.Mask)
+	if len(mask) != len(ip) {
+		mask = mask[len(mask)-len(ip):]
+	}
+
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{nfproto}},
+	}
+	if ban.Port != 0 {
+		l4proto := byte(unix.IPPROTO_UDP)
+		if tcp {
+			l4proto = byte(unix.IPPROTO_TCP)
+		}
+		portData := make([]byte, 2)
+		binary.BigEndian.PutUint16(portData, ban.Port)
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{l4proto}},
+			&expr.Payload{
+				DestRegister: 1,
+				Base:         expr.PayloadBaseTransportHeader,
+				Offset:       2,
+				Len:          2,
+			},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: portData},
+		)
+	}
+	return append(exprs,
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       srcOffset,
+			Len:          uint32(len(ip)),
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            uint32(len(ip)),
+			Mask:           mask,
+			Xor:            make([]byte, len(ip)),
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip.Mask(mask)},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+}
+
+func (f *nftFirewall) SetAccessLists(bans []BanRule, allowed []*net.IPNet) error {
+	if !f.ready {
+		return common.NewError("nftables not ready")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.conn.FlushSet(f.allowV4)
+	f.conn.FlushSet(f.allowV6)
+	if err := f.conn.Flush(); err != nil {
+		return err
+	}
+	if err := f.fillIntervalSet(f.allowV4, allowed, net.IPv4len); err != nil {
+		return err
+	}
+	if err := f.fillIntervalSet(f.allowV6, allowed, net.IPv6len); err != nil {
+		return err
+	}
+
+	f.conn.FlushChain(f.banChain)
+	f.addAllowRules(f.banChain)
+	for _, ban := range bans {
+		protocols := []bool{true, false}
+		if ban.Port == 0 {
+			protocols = protocols[:1]
+		}
+		for _, tcp := range protocols {
+			f.conn.AddRule(&nftables.Rule{
+				Table: f.table,
+				Chain: f.banChain,
+				Exprs: banRuleExprs(ban, tcp),
+			})
+		}
+	}
+	return f.conn.Flush()
+}
@@ -0,0 +1,74 @@
+package iplimit
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// ipRange is an inclusive range of addresses of one family.
+type ipRange struct {
+	start net.IP
+	end   net.IP
+}
+
+// mergeNetworks returns the sorted, non-overlapping ranges covered by the
+// networks of one family, size is net.IPv4len or net.IPv6len.
+func mergeNetworks(networks []*net.IPNet, size int) []ipRange {
+	ranges := make([]ipRange, 0, len(networks))
+	for _, network := range networks {
+		ip := network.IP.To4()
+		if size == net.IPv6len {
+			if ip != nil {
+				continue
+			}
+			ip = network.IP.To16()
+		}
+		if ip == nil {
+			continue
+		}
+		ones, bits := network.Mask.Size()
+		if bits != size*8 {
+			continue
+		}
+		mask := net.CIDRMask(ones, bits)
+		start := ip.Mask(mask)
+		end := make(net.IP, size)
+		for i := range end {
+			end[i] = start[i] | ^mask[i]
+		}
+		ranges = append(ranges, ipRange{start: start, end: end})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].start, ranges[j].start) < 0
+	})
+
+	merged := make([]ipRange, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			next, overflow := nextIP(last.end)
+			if overflow || bytes.Compare(r.start, next) <= 0 {
+				if bytes.Compare(r.end, last.end) > 0 {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// nextIP returns ip + 1, overflow is true for the last address.
+func nextIP(ip net.IP) (net.IP, bool) {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next, false
+		}
+	}
+	return next, true
+}
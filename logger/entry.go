@@ -0,0 +1,72 @@
+package logger
+
+import "github.com/op/go-logging"
+
+// Fields are structured values attached to a log line, e.g. the inbound tag
+// or client email it is about.
+type Fields map[string]any
+
+// Entry logs with a component and fields. Entries are immutable, With
+// returns a copy.
+type Entry struct {
+	component string
+	fields    Fields
+}
+
+// WithComponent returns an entry for component. The component selects the
+// per-component level and is written as a field in JSON output.
+func WithComponent(component string) *Entry {
+	return &Entry{component: component}
+}
+
+// WithFields returns an entry of the panel component with fields.
+func WithFields(fields Fields) *Entry {
+	return (&Entry{}).WithFields(fields)
+}
+
+func (e *Entry) With(key string, value any) *Entry {
+	return e.WithFields(Fields{key: value})
+}
+
+func (e *Entry) WithFields(fields Fields) *Entry {
+	merged := make(Fields, len(e.fields)+len(fields))
+	for key, value := range e.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Entry{component: e.component, fields: merged}
+}
+
+func (e *Entry) Debug(args ...interface{}) {
+	log(logging.DEBUG, e.component, e.fields, args...)
+}
+
+func (e *Entry) Debugf(format string, args ...interface{}) {
+	logf(logging.DEBUG, e.component, e.fields, format, args...)
+}
+
+func (e *Entry) Info(args ...interface{}) {
+	log(logging.INFO, e.component, e.fields, args...)
+}
+
+func (e *Entry) Infof(format string, args ...interface{}) {
+	logf(logging.INFO, e.component, e.fields, format, args...)
+}
+
+func (e *Entry) Warning(args ...interface{}) {
+	log(logging.WARNING, e.component, e.fields, args...)
+}
+
+func (e *Entry) Warningf(format string, args ...interface{}) {
+	logf(logging.WARNING, e.component, e.fields, format, args...)
+}
+
+func (e *Entry) Error(args ...interface{}) {
+	log(logging.ERROR, e.component, e.fields, args...)
+}
+
+func (e *Entry) Errorf(format string, args ...interface{}) {
+	logf(logging.ERROR, e.component, e.fields, format, args...)
+}
@@ -1,13 +1,39 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/op/go-logging"
 )
 
+const (
+	FormatText = "text"
+	FormatJson = "json"
+)
+
+// Options configures the sinks of the logger. Levels overrides Level for
+// single components, e.g. {"xray": WARNING}.
+type Options struct {
+	Level  logging.Level
+	Levels map[string]logging.Level
+	Format string
+
+	// File enables an additional file sink rotated by size. Old files are
+	// removed after MaxAge days or when there are more than MaxBackups.
+	File       string
+	MaxSize    int
+	MaxAge     int
+	MaxBackups int
+	Compress   bool
+}
+
 var (
 	logger    *logging.Logger
 	logBuffer []struct {
@@ -15,6 +41,11 @@ var (
 		level logging.Level
 		log   string
 	}
+	listener func(time string, level string, log string)
+
+	mu         sync.Mutex
+	options    Options
+	fileWriter io.WriteCloser
 )
 
 func init() {
@@ -22,6 +53,12 @@ func init() {
 }
 
 func InitLogger(level logging.Level) {
+	InitLoggerWithOptions(Options{Level: level})
+}
+
+// InitLoggerWithOptions replaces the sinks of the logger. If the file sink
+// cannot be opened the error is returned and only the console is used.
+func InitLoggerWithOptions(opts Options) error {
 	newLogger := logging.MustGetLogger("x-ui")
 	var err error
 	var backend logging.Backend
@@ -33,82 +70,251 @@ func InitLogger(level logging.Level) {
 		println(err)
 		backend = logging.NewLogBackend(os.Stderr, "", 0)
 	}
-	if ppid > 0 && err != nil {
+	if opts.Format == FormatJson {
+		format = logging.MustStringFormatter(`%{message}`)
+	} else if ppid > 0 && err != nil {
 		format = logging.MustStringFormatter(`%{time:2006/01/02 15:04:05} %{level} - %{message}`)
 	} else {
 		format = logging.MustStringFormatter(`%{level} - %{message}`)
 	}
 
+	// Levels are filtered in log, the backend passes everything.
 	backendFormatter := logging.NewBackendFormatter(backend, format)
 	backendLeveled := logging.AddModuleLevel(backendFormatter)
-	backendLeveled.SetLevel(level, "x-ui")
+	backendLeveled.SetLevel(logging.DEBUG, "x-ui")
 	newLogger.SetBackend(backendLeveled)
 
+	var writer io.WriteCloser
+	if opts.File != "" {
+		writer, err = NewRotateWriter(opts.File, opts.MaxSize, opts.MaxAge, opts.MaxBackups, opts.Compress)
+		if err != nil {
+			opts.File = ""
+		}
+	} else {
+		err = nil
+	}
+
+	mu.Lock()
+	if fileWriter != nil {
+		fileWriter.Close()
+	}
 	logger = newLogger
+	options = opts
+	fileWriter = writer
+	mu.Unlock()
+	return err
+}
+
+// ParseLevels parses per-component levels written as "xray=warning,web=debug".
+func ParseLevels(s string) (map[string]logging.Level, error) {
+	levels := make(map[string]logging.Level)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		component, levelName, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid component log level: %s", part)
+		}
+		level, err := logging.LogLevel(strings.TrimSpace(levelName))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level for %s: %s", component, levelName)
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	return levels, nil
 }
 
 func Debug(args ...interface{}) {
-	logger.Debug(args...)
-	addToBuffer("DEBUG", fmt.Sprint(args...))
+	log(logging.DEBUG, "", nil, args...)
 }
 
 func Debugf(format string, args ...interface{}) {
-	logger.Debugf(format, args...)
-	addToBuffer("DEBUG", fmt.Sprintf(format, args...))
+	logf(logging.DEBUG, "", nil, format, args...)
 }
 
 func Info(args ...interface{}) {
-	logger.Info(args...)
-	addToBuffer("INFO", fmt.Sprint(args...))
+	log(logging.INFO, "", nil, args...)
 }
 
 func Infof(format string, args ...interface{}) {
-	logger.Infof(format, args...)
-	addToBuffer("INFO", fmt.Sprintf(format, args...))
+	logf(logging.INFO, "", nil, format, args...)
 }
 
 func Warning(args ...interface{}) {
-	logger.Warning(args...)
-	addToBuffer("WARNING", fmt.Sprint(args...))
+	log(logging.WARNING, "", nil, args...)
 }
 
 func Warningf(format string, args ...interface{}) {
-	logger.Warningf(format, args...)
-	addToBuffer("WARNING", fmt.Sprintf(format, args...))
+	logf(logging.WARNING, "", nil, format, args...)
 }
 
 func Error(args ...interface{}) {
-	logger.Error(args...)
-	addToBuffer("ERROR", fmt.Sprint(args...))
+	log(logging.ERROR, "", nil, args...)
 }
 
 func Errorf(format string, args ...interface{}) {
-	logger.Errorf(format, args...)
-	addToBuffer("ERROR", fmt.Sprintf(format, args...))
+	logf(logging.ERROR, "", nil, format, args...)
+}
+
+func log(level logging.Level, component string, fields Fields, args ...interface{}) {
+	// the console keeps the spacing of go-logging, the buffer that of fmt.Sprint
+	console := fmt.Sprintln(args...)
+	write(level, component, fields, console[:len(console)-1], fmt.Sprint(args...))
+}
+
+func logf(level logging.Level, component string, fields Fields, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	write(level, component, fields, msg, msg)
 }
 
-func addToBuffer(level string, newLog string) {
+func write(level logging.Level, component string, fields Fields, consoleMsg string, msg string) {
 	t := time.Now()
+	mu.Lock()
+	defer mu.Unlock()
+
+	if enabled(level, component) {
+		var line string
+		if options.Format == FormatJson {
+			line = jsonLine(t, level, component, fields, consoleMsg)
+			logAt(level, line)
+		} else {
+			line = textLine(component, fields, consoleMsg)
+			logAt(level, line)
+			line = fmt.Sprintf("%s %s - %s", t.Format("2006/01/02 15:04:05"), level, line)
+		}
+		if fileWriter != nil {
+			fileWriter.Write([]byte(line + "\n"))
+		}
+	}
+
+	addToBuffer(t, level, textLine(component, fields, msg))
+}
+
+func enabled(level logging.Level, component string) bool {
+	if l, ok := options.Levels[component]; ok && component != "" {
+		return level <= l
+	}
+	return level <= options.Level
+}
+
+func logAt(level logging.Level, line string) {
+	switch level {
+	case logging.DEBUG:
+		logger.Debug(line)
+	case logging.INFO:
+		logger.Info(line)
+	case logging.WARNING:
+		logger.Warning(line)
+	default:
+		logger.Error(line)
+	}
+}
+
+// textLine renders a component as "XRAY: " prefix and fields as key=value
+// suffixes.
+func textLine(component string, fields Fields, msg string) string {
+	var b strings.Builder
+	if component != "" {
+		b.WriteString(strings.ToUpper(component))
+		b.WriteString(": ")
+	}
+	b.WriteString(msg)
+	for _, key := range fields.keys() {
+		if isEmptyField(fields[key]) {
+			continue
+		}
+		fmt.Fprintf(&b, " %s=%v", key, fields[key])
+	}
+	return b.String()
+}
+
+// isEmptyField reports whether a field has no value worth writing, e.g. the
+// ip of a request that has none.
+func isEmptyField(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	}
+	return false
+}
+
+func jsonLine(t time.Time, level logging.Level, component string, fields Fields, msg string) string {
+	entry := make(map[string]any, len(fields)+4)
+	for key, value := range fields {
+		if isEmptyField(value) {
+			continue
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	entry["time"] = t.Format(time.RFC3339Nano)
+	entry["level"] = strings.ToLower(level.String())
+	entry["msg"] = msg
+	if component == "" {
+		component = "panel"
+	}
+	entry["component"] = component
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{
+			"time":      entry["time"],
+			"level":     entry["level"],
+			"component": component,
+			"msg":       msg,
+		})
+	}
+	return string(data)
+}
+
+func (f Fields) keys() []string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func addToBuffer(t time.Time, level logging.Level, newLog string) {
 	if len(logBuffer) >= 10240 {
 		logBuffer = logBuffer[1:]
 	}
 
-	logLevel, _ := logging.LogLevel(level)
 	logBuffer = append(logBuffer, struct {
 		time  string
 		level logging.Level
 		log   string
 	}{
 		time:  t.Format("2006/01/02 15:04:05"),
-		level: logLevel,
+		level: level,
 		log:   newLog,
 	})
+
+	if listener != nil {
+		listener(t.Format("2006/01/02 15:04:05"), level.String(), newLog)
+	}
+}
+
+// SetListener registers a function that receives every new log line.
+// The listener must not log itself.
+func SetListener(f func(time string, level string, log string)) {
+	mu.Lock()
+	defer mu.Unlock()
+	listener = f
 }
 
 func GetLogs(c int, level string) []string {
 	var output []string
 	logLevel, _ := logging.LogLevel(level)
 
+	mu.Lock()
+	defer mu.Unlock()
 	for i := len(logBuffer) - 1; i >= 0 && len(output) <= c; i-- {
 		if logBuffer[i].level <= logLevel {
 			output = append(output, fmt.Sprintf("%s %s - %s", logBuffer[i].time, logBuffer[i].level, logBuffer[i].log))
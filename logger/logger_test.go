@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+func TestTextLineSkipsEmptyFields(t *testing.T) {
+	fields := Fields{"ip": "", "requestId": nil, "status": 200, "user": "admin"}
+	if got, want := textLine("web", fields, "done"), "WEB: done status=200 user=admin"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestJsonLineSkipsEmptyFields(t *testing.T) {
+	line := jsonLine(time.Now(), logging.INFO, "", Fields{"ip": "", "status": 200}, "done")
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry["ip"]; ok {
+		t.Errorf("empty field written: %s", line)
+	}
+	if entry["status"] != float64(200) || entry["component"] != "panel" || entry["level"] != "info" {
+		t.Errorf("unexpected entry %s", line)
+	}
+}
@@ -0,0 +1,202 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateWriter is a file writer that moves the file aside once it grows
+// beyond maxSize megabytes. Backups are named after the time of rotation,
+// optionally gzipped, and removed after maxAge days or when there are more
+// than maxBackups of them. Zero disables the respective limit.
+type RotateWriter struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	cleanups sync.WaitGroup
+}
+
+func NewRotateWriter(path string, maxSize, maxAge, maxBackups int, compress bool) (*RotateWriter, error) {
+	w := &RotateWriter{
+		path:       path,
+		maxSize:    int64(maxSize) * 1024 * 1024,
+		maxAge:     time.Duration(maxAge) * 24 * time.Hour,
+		maxBackups: maxBackups,
+		compress:   compress,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the file and waits for backups still being compressed.
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	defer w.cleanups.Wait()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Rotate moves the current file aside and starts a new one.
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+func (w *RotateWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	backup := w.backupName(time.Now())
+	if err := os.Rename(w.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.cleanups.Add(1)
+	go func() {
+		defer w.cleanups.Done()
+		w.cleanup(backup)
+	}()
+	return nil
+}
+
+// backupName returns an unused backup path for a rotation at t. Rotations
+// within the same millisecond get the following stamps.
+func (w *RotateWriter) backupName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	for {
+		backup := strings.TrimSuffix(w.path, ext) + "-" + t.Format(backupTimeFormat) + ext
+		_, err := os.Lstat(backup)
+		_, gzErr := os.Lstat(backup + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			return backup
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// cleanup compresses the new backup and removes the expired ones.
+func (w *RotateWriter) cleanup(backup string) {
+	if w.compress {
+		if err := compressFile(backup); err == nil {
+			os.Remove(backup)
+		}
+	}
+
+	ext := filepath.Ext(w.path)
+	prefix := filepath.Base(strings.TrimSuffix(w.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)[len(prefix):]
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		if w.maxAge > 0 && time.Since(t) > w.maxAge {
+			os.Remove(filepath.Join(filepath.Dir(w.path), name))
+			continue
+		}
+		backups = append(backups, name)
+	}
+	if w.maxBackups > 0 && len(backups) > w.maxBackups {
+		// the timestamps sort chronologically
+		sort.Strings(backups)
+		for _, name := range backups[:len(backups)-w.maxBackups] {
+			os.Remove(filepath.Join(filepath.Dir(w.path), name))
+		}
+	}
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backups lists the backups of the log at path, sorted by name.
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	ext := filepath.Ext(path)
+	matches, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func newTestRotateWriter(t *testing.T, path string, maxAge, maxBackups int, compress bool) *RotateWriter {
+	t.Helper()
+	w, err := NewRotateWriter(path, 1, maxAge, maxBackups, compress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.maxSize = 10
+	return w
+}
+
+func TestRotateWriterSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x-ui.log")
+	w := newTestRotateWriter(t, path, 0, 0, false)
+	for _, line := range []string{"12345\n", "67890\n", "abcde\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "abcde\n" {
+		t.Errorf("current file holds %q", current)
+	}
+	names := backups(t, path)
+	if len(names) != 2 {
+		t.Fatalf("got backups %v, want 2", names)
+	}
+	for i, want := range []string{"12345\n", "67890\n"} {
+		data, _ := os.ReadFile(names[i])
+		if string(data) != want {
+			t.Errorf("backup %s holds %q, want %q", names[i], data, want)
+		}
+	}
+}
+
+func TestRotateWriterCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x-ui.log")
+	w := newTestRotateWriter(t, path, 0, 0, true)
+	w.Write([]byte("first line\n"))
+	w.Write([]byte("second line\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := backups(t, path)
+	if len(names) != 1 || !strings.HasSuffix(names[0], ".log.gz") {
+		t.Fatalf("got backups %v, want one gzipped", names)
+	}
+	file, err := os.Open(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first line\n" {
+		t.Errorf("backup holds %q", data)
+	}
+}
+
+func TestRotateWriterCleanup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x-ui.log")
+	backup := func(t0 time.Time) string {
+		name := filepath.Join(dir, "x-ui-"+t0.Format(backupTimeFormat)+".log")
+		if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	now := time.Now()
+	expired := backup(now.Add(-48 * time.Hour))
+	oldest := backup(now.Add(-3 * time.Hour))
+	older := backup(now.Add(-2 * time.Hour))
+	recent := backup(now.Add(-time.Hour))
+	// files that only look alike are left alone
+	foreign := filepath.Join(dir, "x-ui-notes.log")
+	os.WriteFile(foreign, nil, 0o644)
+
+	w := newTestRotateWriter(t, path, 1, 3, false)
+	w.Write([]byte("rotated\n"))
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{expired, oldest} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s was kept", filepath.Base(name))
+		}
+	}
+	for _, name := range []string{older, recent, foreign} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s was removed", filepath.Base(name))
+		}
+	}
+	if names := backups(t, path); len(names) != 4 {
+		t.Errorf("got %v, want 3 backups and the foreign file", names)
+	}
+}
+
+func TestRotateWriterUniqueBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x-ui.log")
+	w := newTestRotateWriter(t, path, 0, 0, false)
+	for i := 0; i < 3; i++ {
+		w.Write([]byte("line\n"))
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	if names := backups(t, path); len(names) != 3 {
+		t.Errorf("got backups %v, want 3", names)
+	}
+}
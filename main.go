@@ -15,6 +15,7 @@ import (
 
 	"github.com/alireza0/x-ui/config"
 	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/hostfw"
 	"github.com/alireza0/x-ui/logger"
 	"github.com/alireza0/x-ui/sub"
 	"github.com/alireza0/x-ui/util/sys"
@@ -29,20 +30,36 @@ import (
 func runWebServer() {
 	log.Printf("%v %v", config.GetName(), config.GetVersion())
 
+	logOptions := logger.Options{
+		Format:     config.GetLogFormat(),
+		File:       config.GetLogFile(),
+		MaxSize:    config.GetLogMaxSize(),
+		MaxAge:     config.GetLogMaxAge(),
+		MaxBackups: config.GetLogMaxBackups(),
+		Compress:   config.IsLogCompress(),
+	}
 	switch config.GetLogLevel() {
 	case config.Debug:
-		logger.InitLogger(logging.DEBUG)
+		logOptions.Level = logging.DEBUG
 	case config.Info:
-		logger.InitLogger(logging.INFO)
+		logOptions.Level = logging.INFO
 	case config.Warning:
-		logger.InitLogger(logging.WARNING)
+		logOptions.Level = logging.WARNING
 	case config.Error:
-		logger.InitLogger(logging.ERROR)
+		logOptions.Level = logging.ERROR
 	default:
 		log.Fatal("unknown log level:", config.GetLogLevel())
 	}
+	levels, err := logger.ParseLevels(config.GetLogLevels())
+	if err != nil {
+		log.Fatal(err)
+	}
+	logOptions.Levels = levels
+	if err := logger.InitLoggerWithOptions(logOptions); err != nil {
+		log.Println("open log file failed:", err)
+	}
 
-	err := database.InitDB(config.GetDBPath())
+	err = database.InitDB(config.GetDBPath())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -69,7 +86,7 @@ func runWebServer() {
 
 	sigCh := make(chan os.Signal, 1)
 	// Trap shutdown signals
-	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGTERM, sys.SIGUSR1)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGTERM, sys.SIGUSR1, sys.SIGUSR2)
 	for {
 		sig := <-sigCh
 
@@ -106,6 +123,14 @@ func runWebServer() {
 			if err != nil {
 				logger.Error("Failed to restart xray-core:", err)
 			}
+		case sys.SIGUSR2:
+			logger.Info("Received USR2 signal, reloading certificates...")
+			if err := server.ReloadCert(); err != nil {
+				logger.Error("Failed to reload panel certificate:", err)
+			}
+			if err := subServer.ReloadCert(); err != nil {
+				logger.Error("Failed to reload subscription certificate:", err)
+			}
 		default:
 			server.Stop()
 			subServer.Stop()
@@ -291,6 +316,50 @@ func updateCert(publicKey string, privateKey string) {
 	}
 }
 
+// updateHostFirewall sets the host firewall mode. Turning it off removes the
+// rules at once, which is the way back in after a lockout.
+func updateHostFirewall(mode string) {
+	switch mode {
+	case service.HostFirewallOff, service.HostFirewallOpen, service.HostFirewallDeny:
+	default:
+		fmt.Println("host firewall mode should be off, open or deny")
+		return
+	}
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println("Database initialization failed:", err)
+		return
+	}
+	settingService := service.SettingService{}
+	if err := settingService.SetHostFirewall(mode); err != nil {
+		fmt.Println("Failed to set host firewall:", err)
+		return
+	}
+	if mode == service.HostFirewallOff {
+		if err := hostfw.Remove(); err != nil {
+			fmt.Println("Failed to remove host firewall rules:", err)
+			return
+		}
+		fmt.Println("Host firewall turned off and its rules removed")
+		return
+	}
+	fmt.Println("Host firewall set to", mode+", the running panel applies it within 5 minutes")
+}
+
+func clearPanelAllowedIps() {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println("Database initialization failed:", err)
+		return
+	}
+	settingService := service.SettingService{}
+	if err := settingService.ClearAllowedIps(); err != nil {
+		fmt.Println("Failed to clear allowed IPs:", err)
+		return
+	}
+	fmt.Println("Allowed IPs cleared, restart the panel to apply it")
+}
+
 func getPanelURI() {
 	err := database.InitDB(config.GetDBPath())
 	if err != nil {
@@ -392,6 +461,8 @@ func main() {
 	var tgbotchatid string
 	var enabletgbot bool
 	var tgbotRuntime string
+	var hostFirewall string
+	var clearAllowedIps bool
 	var reset bool
 	var show bool
 	settingCmd.BoolVar(&reset, "reset", false, "Reset all settings")
@@ -406,6 +477,8 @@ func main() {
 	settingCmd.StringVar(&tgbotRuntime, "tgbotRuntime", "", "Set telegram bot cron time")
 	settingCmd.StringVar(&tgbotchatid, "tgbotchatid", "", "Set telegram bot chat id")
 	settingCmd.BoolVar(&enabletgbot, "enabletgbot", false, "Enable telegram bot notify")
+	settingCmd.StringVar(&hostFirewall, "hostFirewall", "", "Set host firewall mode (off, open or deny), off removes its rules at once")
+	settingCmd.BoolVar(&clearAllowedIps, "clearAllowedIps", false, "Allow every IP to reach the panel and its API again")
 
 	oldUsage := flag.Usage
 	flag.Usage = func() {
@@ -456,6 +529,12 @@ func main() {
 		if enabletgbot {
 			updateTgbotEnableSts(enabletgbot)
 		}
+		if hostFirewall != "" {
+			updateHostFirewall(hostFirewall)
+		}
+		if clearAllowedIps {
+			clearPanelAllowedIps()
+		}
 	case "cert":
 		err := settingCmd.Parse(os.Args[2:])
 		if err != nil {
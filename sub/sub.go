@@ -19,8 +19,9 @@ import (
 )
 
 type Server struct {
-	httpServer *http.Server
-	listener   net.Listener
+	httpServer   *http.Server
+	listener     net.Listener
+	certReloader *network.CertReloader
 
 	sub            *SUBController
 	settingService service.SettingService
@@ -107,6 +108,8 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		SubJsonRules = ""
 	}
 
+	engine.GET("/.well-known/acme-challenge/:token", gin.WrapF(service.ServeAcmeChallenge))
+
 	g := engine.Group("/")
 
 	s.sub = NewSUBController(
@@ -145,6 +148,14 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	subAcme, err := s.settingService.GetSubAcme()
+	if err != nil {
+		return err
+	}
+	subDomain, err := s.settingService.GetSubDomain()
+	if err != nil {
+		return err
+	}
 	listen, err := s.settingService.GetSubListen()
 	if err != nil {
 		return err
@@ -154,25 +165,58 @@ func (s *Server) Start() (err error) {
 		return err
 	}
 
-	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
-	listener, err := net.Listen("tcp", listenAddr)
+	listenSocket, err := s.settingService.GetSubListenSocket()
+	if err != nil {
+		return err
+	}
+	proxyProtocol, err := s.settingService.GetSubProxyProtocol()
 	if err != nil {
 		return err
 	}
+	trusted := service.RefreshTrustedProxies()
 
+	var listener net.Listener
+	if listenSocket != "" {
+		listener, err = network.ListenUnix(listenSocket)
+	} else {
+		listener, err = net.Listen("tcp", net.JoinHostPort(listen, strconv.Itoa(port)))
+	}
+	if err != nil {
+		return err
+	}
+	if proxyProtocol {
+		listener = network.NewProxyProtocolListener(listener, trusted)
+	}
+
+	var reloader *network.CertReloader
 	if certFile != "" || keyFile != "" {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		loaded, err := network.NewCertReloader(certFile, keyFile)
 		if err == nil {
-			c := &tls.Config{
-				Certificates: []tls.Certificate{cert},
-			}
-			listener = network.NewAutoHttpsListener(listener)
-			listener = tls.NewListener(listener, c)
-			logger.Info("sub server run https on", listener.Addr())
+			reloader = loaded
 		} else {
 			logger.Error("error in loading certificates: ", err)
-			logger.Info("sub server run http on", listener.Addr())
 		}
+	}
+	var tlsConfig *tls.Config
+	if subAcme && subDomain != "" {
+		var fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+		if reloader != nil {
+			fallback = reloader.GetCertificate
+		}
+		tlsConfig = service.AcmeTLSConfig(subDomain, fallback)
+	} else if reloader != nil {
+		tlsConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+	if reloader != nil {
+		s.certReloader = reloader
+		go reloader.Watch(s.ctx)
+	}
+	if tlsConfig != nil {
+		listener = network.NewAutoHttpsListener(listener)
+		listener = tls.NewListener(listener, tlsConfig)
+		logger.Info("sub server run https on", listener.Addr())
 	} else {
 		logger.Info("sub server run http on", listener.Addr())
 	}
@@ -206,3 +250,12 @@ func (s *Server) Stop() error {
 func (s *Server) GetCtx() context.Context {
 	return s.ctx
 }
+
+// ReloadCert loads the certificate files of the listener again. It does
+// nothing if the listener serves no certificate files.
+func (s *Server) ReloadCert() error {
+	if s.certReloader == nil {
+		return nil
+	}
+	return s.certReloader.Reload()
+}
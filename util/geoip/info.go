@@ -0,0 +1,111 @@
+package geoip
+
+import (
+	"net"
+	"strconv"
+)
+
+// Info is the part of a GeoIP record shown for client addresses. Country
+// and City databases fill the location, ASN databases the network owner.
+type Info struct {
+	Country     string  `json:"country,omitempty"`
+	CountryName string  `json:"countryName,omitempty"`
+	City        string  `json:"city,omitempty"`
+	Latitude    float64 `json:"latitude,omitempty"`
+	Longitude   float64 `json:"longitude,omitempty"`
+	Asn         uint64  `json:"asn,omitempty"`
+	AsnOrg      string  `json:"asnOrg,omitempty"`
+}
+
+func (i *Info) IsEmpty() bool {
+	return i.Country == "" && i.Asn == 0
+}
+
+// Location returns the city and country name, or the country code when the
+// database has no names.
+func (i *Info) Location() string {
+	country := i.CountryName
+	if country == "" {
+		country = i.Country
+	}
+	if i.City != "" && country != "" {
+		return i.City + ", " + country
+	}
+	return i.City + country
+}
+
+// Network returns the ASN and its organization, like "AS13335 Cloudflare".
+func (i *Info) Network() string {
+	if i.Asn == 0 {
+		return i.AsnOrg
+	}
+	network := "AS" + strconv.FormatUint(i.Asn, 10)
+	if i.AsnOrg != "" {
+		network += " " + i.AsnOrg
+	}
+	return network
+}
+
+// HasLocation reports whether the record contained coordinates.
+func (i *Info) HasLocation() bool {
+	return i.Latitude != 0 || i.Longitude != 0
+}
+
+// LookupInfo looks up ip and merges the known fields into info, keeping the
+// fields that the record does not have.
+func (r *Reader) LookupInfo(ip net.IP, info *Info) error {
+	record, err := r.Lookup(ip)
+	if err != nil || record == nil {
+		return err
+	}
+	if code := recordCountry(record); code != "" {
+		info.Country = code
+	}
+	if name, ok := path(countryOf(record), "names", "en").(string); ok {
+		info.CountryName = name
+	}
+	if name, ok := path(record, "city", "names", "en").(string); ok {
+		info.City = name
+	}
+	if lat, ok := path(record, "location", "latitude").(float64); ok {
+		info.Latitude = lat
+	}
+	if lon, ok := path(record, "location", "longitude").(float64); ok {
+		info.Longitude = lon
+	}
+	if asn, ok := record["autonomous_system_number"].(uint64); ok {
+		info.Asn = asn
+	}
+	if org, ok := record["autonomous_system_organization"].(string); ok {
+		info.AsnOrg = org
+	}
+	return nil
+}
+
+func countryOf(record map[string]any) any {
+	if country := path(record, "country"); country != nil {
+		return country
+	}
+	return path(record, "registered_country")
+}
+
+// recordCountry returns the ISO code of a record of a country, city or
+// IP-to-country database.
+func recordCountry(record map[string]any) string {
+	if code, ok := path(countryOf(record), "iso_code").(string); ok {
+		return code
+	}
+	code, _ := record["country_code"].(string)
+	return code
+}
+
+func path(value any, keys ...string) any {
+	for _, key := range keys {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
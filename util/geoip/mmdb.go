@@ -0,0 +1,329 @@
+// Package geoip reads MaxMind DB (.mmdb) files such as GeoLite2 or DB-IP
+// without any network access.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+var metadataStart = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB file")
+
+// Reader looks up records in a MaxMind DB loaded into memory.
+type Reader struct {
+	Metadata Metadata
+
+	buffer     []byte
+	nodeCount  uint
+	recordSize uint
+	treeSize   uint
+	ipv4Start  uint
+}
+
+type Metadata struct {
+	DatabaseType string
+	IPVersion    uint
+	BuildEpoch   uint64
+	NodeCount    uint
+	RecordSize   uint
+}
+
+func Open(path string) (*Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(data)
+}
+
+func FromBytes(buffer []byte) (*Reader, error) {
+	dataEnd := bytes.LastIndex(buffer, metadataStart)
+	if dataEnd < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	d := decoder{buffer: buffer[dataEnd+len(metadataStart):]}
+	value, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := value.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	r := &Reader{buffer: buffer[:dataEnd]}
+	r.Metadata.DatabaseType, _ = meta["database_type"].(string)
+	r.Metadata.IPVersion = uint(toUint(meta["ip_version"]))
+	r.Metadata.BuildEpoch = toUint(meta["build_epoch"])
+	r.Metadata.NodeCount = uint(toUint(meta["node_count"]))
+	r.Metadata.RecordSize = uint(toUint(meta["record_size"]))
+	r.nodeCount = r.Metadata.NodeCount
+	r.recordSize = r.Metadata.RecordSize
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	r.treeSize = r.nodeCount * r.recordSize / 4
+	if r.treeSize+16 > uint(dataEnd) {
+		return nil, ErrInvalidDatabase
+	}
+
+	// IPv4 addresses live below 96 zero bits in IPv6 trees.
+	if r.Metadata.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+func (r *Reader) readNode(node uint, bit uint) uint {
+	offset := node * r.recordSize / 4
+	b := r.buffer[offset:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return (uint(b[3])&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return (uint(b[3])&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Lookup returns the record of ip decoded into maps, slices and scalars,
+// or nil if the database has no record for it.
+func (r *Reader) Lookup(ip net.IP) (map[string]any, error) {
+	node := uint(0)
+	bitCount := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bitCount = 32
+		if r.Metadata.IPVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if ip = ip.To16(); ip == nil {
+		return nil, fmt.Errorf("invalid ip address")
+	} else if r.Metadata.IPVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < bitCount && node < r.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, ErrInvalidDatabase
+	}
+
+	d := r.dataDecoder()
+	offset := node - r.nodeCount - 16
+	value, _, err := d.decode(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]any)
+	return record, nil
+}
+
+// dataDecoder decodes the data section, which lies between the search tree
+// and the metadata.
+func (r *Reader) dataDecoder() decoder {
+	return decoder{buffer: r.buffer[r.treeSize+16:]}
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeFloat64
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeSlice
+	typeContainer
+	typeMarker
+	typeBool
+	typeFloat32
+)
+
+type decoder struct {
+	buffer []byte
+}
+
+// decode returns the value at offset and the offset following it.
+func (d *decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > 32 {
+		return nil, 0, ErrInvalidDatabase
+	}
+	if offset >= uint(len(d.buffer)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buffer[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+	if kind == typeExtended {
+		if offset >= uint(len(d.buffer)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		kind = 7 + uint(d.buffer[offset])
+		offset++
+	}
+
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buffer)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		extra := uint(0)
+		for _, b := range d.buffer[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[keyString] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeSlice:
+		s := make([]any, 0, min(size, 256))
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			s = append(s, value)
+			offset = next
+		}
+		return s, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buffer)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	data := d.buffer[offset : offset+size]
+	offset += size
+	switch kind {
+	case typeString:
+		return string(data), offset, nil
+	case typeBytes:
+		return append([]byte(nil), data...), offset, nil
+	case typeFloat64:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), offset, nil
+	case typeFloat32:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		value := uint64(0)
+		for _, b := range data {
+			value = value<<8 | uint64(b)
+		}
+		return value, offset, nil
+	case typeInt32:
+		value := int32(0)
+		for _, b := range data {
+			value = value<<8 | int32(b)
+		}
+		return int64(value), offset, nil
+	case typeUint128:
+		return append([]byte(nil), data...), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown MaxMind DB data type %d", kind)
+}
+
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl>>3) & 0x3
+	n := size + 1
+	if offset+n > uint(len(d.buffer)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	b := d.buffer[offset : offset+n]
+	var pointer uint
+	switch size {
+	case 0:
+		pointer = uint(ctrl&0x7)<<8 | uint(b[0])
+	case 1:
+		pointer = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 2:
+		pointer = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + n, nil
+}
+
+func toUint(value any) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
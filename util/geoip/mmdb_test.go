@@ -0,0 +1,464 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// dataWriter encodes values of the MaxMind DB data section.
+type dataWriter struct {
+	bytes.Buffer
+}
+
+func (w *dataWriter) ctrl(kind int, size int) {
+	first := byte(kind << 5)
+	if kind > 7 {
+		first = 0
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+		first |= byte(size)
+	case size < 285:
+		first |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		first |= 30
+		extra = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		first |= 31
+		extra = binary.BigEndian.AppendUint32(nil, uint32(size-65821))[1:]
+	}
+	w.WriteByte(first)
+	if kind > 7 {
+		w.WriteByte(byte(kind - 7))
+	}
+	w.Write(extra)
+}
+
+// value writes v and returns its offset. Maps are written with sorted keys.
+func (w *dataWriter) value(v any) uint {
+	offset := uint(w.Len())
+	switch v := v.(type) {
+	case string:
+		w.ctrl(typeString, len(v))
+		w.WriteString(v)
+	case uint64:
+		b := binary.BigEndian.AppendUint64(nil, v)
+		b = bytes.TrimLeft(b, "\x00")
+		w.ctrl(typeUint64, len(b))
+		w.Write(b)
+	case uint32:
+		b := bytes.TrimLeft(binary.BigEndian.AppendUint32(nil, v), "\x00")
+		w.ctrl(typeUint32, len(b))
+		w.Write(b)
+	case uint16:
+		b := bytes.TrimLeft(binary.BigEndian.AppendUint16(nil, v), "\x00")
+		w.ctrl(typeUint16, len(b))
+		w.Write(b)
+	case int32:
+		w.ctrl(typeInt32, 4)
+		w.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+	case float64:
+		w.ctrl(typeFloat64, 8)
+		w.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+	case float32:
+		w.ctrl(typeFloat32, 4)
+		w.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(v)))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		w.ctrl(typeBool, size)
+	case []byte:
+		w.ctrl(typeBytes, len(v))
+		w.Write(v)
+	case []any:
+		w.ctrl(typeSlice, len(v))
+		for _, item := range v {
+			w.value(item)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.ctrl(typeMap, len(v))
+		for _, key := range keys {
+			w.value(key)
+			w.value(v[key])
+		}
+	case pointer:
+		w.pointer(uint(v))
+	default:
+		panic("unsupported test value")
+	}
+	return offset
+}
+
+// pointer is written as a pointer to the given data offset.
+type pointer uint
+
+func (w *dataWriter) pointer(p uint) {
+	switch {
+	case p < 2048:
+		w.Write([]byte{byte(typePointer<<5) | byte(p>>8), byte(p)})
+	case p < 526336:
+		p -= 2048
+		w.Write([]byte{byte(typePointer<<5) | 1<<3 | byte(p>>16), byte(p >> 8), byte(p)})
+	case p < 134744064:
+		p -= 526336
+		w.Write([]byte{byte(typePointer<<5) | 2<<3 | byte(p>>24), byte(p >> 16), byte(p >> 8), byte(p)})
+	default:
+		w.Write([]byte{byte(typePointer<<5) | 3<<3})
+		w.Write(binary.BigEndian.AppendUint32(nil, uint32(p)))
+	}
+}
+
+// treeNode is a node of a search tree under construction. A side without a
+// child holds a data offset, or -1 for no record.
+type treeNode struct {
+	children [2]*treeNode
+	data     [2]int
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{data: [2]int{-1, -1}}
+}
+
+func (n *treeNode) insert(ip net.IP, bits int, data uint) {
+	for i := 0; i < bits; i++ {
+		bit := ip[i>>3] >> (7 - uint(i&7)) & 1
+		if i == bits-1 {
+			n.data[bit] = int(data)
+			return
+		}
+		if n.children[bit] == nil {
+			n.children[bit] = newTreeNode()
+		}
+		n = n.children[bit]
+	}
+}
+
+type testNetwork struct {
+	cidr   string
+	record any
+}
+
+// buildDatabase returns a MaxMind DB holding networks. The records are
+// written into data after what it already holds, and IPv4 networks are
+// placed below ::/96 in IPv6 databases.
+func buildDatabase(t *testing.T, ipVersion, recordSize int, data *dataWriter, networks []testNetwork) []byte {
+	t.Helper()
+	root := newTreeNode()
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			if ipVersion == 6 {
+				ip = append(make(net.IP, 12), ip4...)
+				ones += 96
+			}
+		} else if ipVersion == 4 {
+			t.Fatalf("%s in an IPv4 database", network.cidr)
+		}
+		root.insert(ip, ones, data.value(network.record))
+	}
+
+	nodes := []*treeNode{root}
+	ids := map[*treeNode]uint{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if child != nil {
+				ids[child] = uint(len(nodes))
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	nodeCount := uint(len(nodes))
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]uint
+		for bit := range records {
+			switch {
+			case n.children[bit] != nil:
+				records[bit] = ids[n.children[bit]]
+			case n.data[bit] >= 0:
+				records[bit] = nodeCount + 16 + uint(n.data[bit])
+			default:
+				records[bit] = nodeCount
+			}
+		}
+		tree = appendNode(tree, recordSize, records[0], records[1])
+	}
+
+	var meta dataWriter
+	meta.value(map[string]any{
+		"database_type": "Test-Country",
+		"ip_version":    uint16(ipVersion),
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(recordSize),
+		"build_epoch":   uint64(1700000000),
+	})
+	file := append(tree, make([]byte, 16)...)
+	file = append(file, data.Bytes()...)
+	file = append(file, metadataStart...)
+	return append(file, meta.Bytes()...)
+}
+
+func appendNode(b []byte, recordSize int, left, right uint) []byte {
+	switch recordSize {
+	case 24:
+		return append(b, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+	case 28:
+		return append(b, byte(left>>16), byte(left>>8), byte(left),
+			byte(left>>24)<<4|byte(right>>24)&0x0F, byte(right>>16), byte(right>>8), byte(right))
+	default:
+		b = binary.BigEndian.AppendUint32(b, uint32(left))
+		return binary.BigEndian.AppendUint32(b, uint32(right))
+	}
+}
+
+// testNetworks is a database of countries in the formats of GeoLite2 and
+// IP-to-country databases. The German record reaches its shared values
+// through pointers.
+func testNetworks(data *dataWriter, ipVersion int) []testNetwork {
+	germany := data.value(map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany"}})
+	latitude := data.value(52.52)
+	networks := []testNetwork{
+		{"1.2.3.0/24", map[string]any{
+			"country":  pointer(germany),
+			"city":     map[string]any{"names": map[string]any{"en": "Berlin"}},
+			"location": map[string]any{"latitude": pointer(latitude), "longitude": 13.405},
+		}},
+		{"1.2.4.128/25", map[string]any{"registered_country": pointer(germany)}},
+		{"10.0.0.0/8", map[string]any{"country_code": "US"}},
+	}
+	if ipVersion == 6 {
+		networks = append(networks, testNetwork{"2001:db8::/32", map[string]any{"country_code": "FR"}})
+	}
+	return networks
+}
+
+func TestReaderLookup(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			data := &dataWriter{}
+			r, err := FromBytes(buildDatabase(t, ipVersion, recordSize, data, testNetworks(data, ipVersion)))
+			if err != nil {
+				t.Fatalf("IPv%d/%d: %v", ipVersion, recordSize, err)
+			}
+			if r.Metadata.DatabaseType != "Test-Country" || r.Metadata.IPVersion != uint(ipVersion) ||
+				r.Metadata.RecordSize != uint(recordSize) || r.Metadata.BuildEpoch != 1700000000 {
+				t.Errorf("IPv%d/%d: unexpected metadata %+v", ipVersion, recordSize, r.Metadata)
+			}
+
+			tests := map[string]string{
+				"1.2.3.4":        "DE",
+				"1.2.3.255":      "DE",
+				"1.2.4.200":      "DE",
+				"1.2.4.1":        "",
+				"10.200.0.1":     "US",
+				"11.0.0.1":       "",
+				"2001:db8::1":    "FR",
+				"2001:db9::1":    "",
+				"::ffff:1.2.3.4": "DE",
+			}
+			if ipVersion == 4 {
+				tests["2001:db8::1"] = ""
+			}
+			for ip, want := range tests {
+				record, err := r.Lookup(net.ParseIP(ip))
+				if err != nil {
+					t.Errorf("IPv%d/%d %s: %v", ipVersion, recordSize, ip, err)
+					continue
+				}
+				if got := recordCountry(record); got != want {
+					t.Errorf("IPv%d/%d %s: got %q, want %q", ipVersion, recordSize, ip, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestReaderLookupInfo(t *testing.T) {
+	data := &dataWriter{}
+	networks := append(testNetworks(data, 6), testNetwork{"8.8.8.0/24", map[string]any{
+		"autonomous_system_number":       uint32(15169),
+		"autonomous_system_organization": "Google LLC",
+	}})
+	r, err := FromBytes(buildDatabase(t, 6, 28, data, networks))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &Info{Asn: 1}
+	if err := r.LookupInfo(net.ParseIP("1.2.3.4"), info); err != nil {
+		t.Fatal(err)
+	}
+	want := Info{Country: "DE", CountryName: "Germany", City: "Berlin", Latitude: 52.52, Longitude: 13.405, Asn: 1}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+	if info.Location() != "Berlin, Germany" {
+		t.Errorf("location %q", info.Location())
+	}
+
+	info = &Info{}
+	if err := r.LookupInfo(net.ParseIP("8.8.8.8"), info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Network() != "AS15169 Google LLC" || info.Country != "" {
+		t.Errorf("got %+v", *info)
+	}
+}
+
+func TestReaderCountryNetworks(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		data := &dataWriter{}
+		r, err := FromBytes(buildDatabase(t, ipVersion, 24, data, testNetworks(data, ipVersion)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := r.CountryNetworks([]string{"de", "fr"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0)
+		for country, networks := range result {
+			for _, network := range networks {
+				got = append(got, country+" "+network.String())
+			}
+		}
+		sort.Strings(got)
+		want := []string{"DE 1.2.3.0/24", "DE 1.2.4.128/25"}
+		if ipVersion == 6 {
+			want = append(want, "FR 2001:db8::/32")
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("IPv%d: got %v, want %v", ipVersion, got, want)
+		}
+	}
+}
+
+func TestReadNodeRecordSizes(t *testing.T) {
+	tests := []struct {
+		recordSize  int
+		left, right uint
+	}{
+		{24, 0xABCDEF, 0x123456},
+		{28, 0xABCDEF1, 0x1234567},
+		{32, 0xABCDEF12, 0x12345678},
+	}
+	for _, test := range tests {
+		r := &Reader{recordSize: uint(test.recordSize), buffer: appendNode(make([]byte, test.recordSize/4), test.recordSize, test.left, test.right)}
+		if left, right := r.readNode(1, 0), r.readNode(1, 1); left != test.left || right != test.right {
+			t.Errorf("%d bit records: got %#x %#x, want %#x %#x", test.recordSize, left, right, test.left, test.right)
+		}
+	}
+}
+
+func TestDecoderTypes(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	huge := strings.Repeat("y", 70000)
+	values := map[string]any{
+		"bool":    true,
+		"bytes":   []byte{1, 2},
+		"float32": float32(1.5),
+		"int32":   int32(-7),
+		"long":    long,
+		"huge":    huge,
+		"slice":   []any{"a", uint16(2)},
+		"uint64":  uint64(1) << 40,
+	}
+	w := &dataWriter{}
+	offset := w.value(values)
+	d := decoder{buffer: w.Bytes()}
+	value, next, err := d.decode(offset, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != uint(w.Len()) {
+		t.Errorf("decoding ended at %d of %d", next, w.Len())
+	}
+	m := value.(map[string]any)
+	if m["bool"] != true || !bytes.Equal(m["bytes"].([]byte), []byte{1, 2}) || m["float32"] != 1.5 ||
+		m["int32"] != int64(-7) || m["long"] != long || m["huge"] != huge || m["uint64"] != uint64(1)<<40 {
+		t.Errorf("unexpected values %v", m["int32"])
+	}
+	if s := m["slice"].([]any); len(s) != 2 || s[0] != "a" || s[1] != uint64(2) {
+		t.Errorf("unexpected slice %v", s)
+	}
+}
+
+func TestDecoderPointers(t *testing.T) {
+	for _, target := range []uint{10, 3000, 600000} {
+		w := &dataWriter{}
+		w.Write(make([]byte, target))
+		w.value("target")
+		offset := uint(w.Len())
+		w.value(pointer(target))
+		d := decoder{buffer: w.Bytes()}
+		value, next, err := d.decode(offset, 0)
+		if err != nil || value != "target" || next != uint(w.Len()) {
+			t.Errorf("pointer to %d: got %v %d %v", target, value, next, err)
+		}
+	}
+
+	// a pointer to itself must not recurse forever
+	w := &dataWriter{}
+	w.value(pointer(0))
+	d := decoder{buffer: w.Bytes()}
+	if _, _, err := d.decode(0, 0); !errors.Is(err, ErrInvalidDatabase) {
+		t.Errorf("a pointer loop returned %v", err)
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	data := &dataWriter{}
+	db := buildDatabase(t, 6, 24, data, testNetworks(data, 6))
+	metaAt := bytes.LastIndex(db, metadataStart)
+
+	tests := map[string][]byte{
+		"empty":          nil,
+		"no metadata":    db[:metaAt],
+		"truncated meta": db[:len(db)-3],
+		"truncated tree": db[metaAt-len(data.Bytes())-20:],
+		"unsupported size": func() []byte {
+			data := &dataWriter{}
+			return buildDatabase(t, 6, 20, data, nil)
+		}(),
+	}
+	for name, buffer := range tests {
+		if _, err := FromBytes(buffer); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	// a record cut off by the end of the data section
+	data = &dataWriter{}
+	data.value("padding")
+	db = buildDatabase(t, 4, 24, data, []testNetwork{{"1.2.3.0/24", map[string]any{"country_code": "DE"}}})
+	metaAt = bytes.LastIndex(db, metadataStart)
+	truncated := append(append([]byte(nil), db[:metaAt-4]...), db[metaAt:]...)
+	r, err := FromBytes(truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Lookup(net.ParseIP("1.2.3.4")); !errors.Is(err, ErrInvalidDatabase) {
+		t.Errorf("a truncated record returned %v", err)
+	}
+}
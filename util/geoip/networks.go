@@ -0,0 +1,132 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/xtls/xray-core/common/geodata"
+	"google.golang.org/protobuf/proto"
+)
+
+// CountryNetworks returns the networks of the database grouped by the
+// country code of their record, limited to countries. Codes are upper case.
+func (r *Reader) CountryNetworks(countries []string) (map[string][]*net.IPNet, error) {
+	wanted := make(map[string]bool, len(countries))
+	for _, country := range countries {
+		wanted[strings.ToUpper(country)] = true
+	}
+	w := &networkWalker{
+		reader:  r,
+		wanted:  wanted,
+		codes:   make(map[uint]string),
+		decoder: r.dataDecoder(),
+		result:  make(map[string][]*net.IPNet),
+	}
+	bits := 128
+	if r.Metadata.IPVersion == 4 {
+		bits = 32
+	}
+	if err := w.walk(0, make([]byte, bits/8), 0); err != nil {
+		return nil, err
+	}
+	return w.result, nil
+}
+
+type networkWalker struct {
+	reader  *Reader
+	wanted  map[string]bool
+	codes   map[uint]string
+	decoder decoder
+	result  map[string][]*net.IPNet
+}
+
+func (w *networkWalker) walk(node uint, ip []byte, depth int) error {
+	r := w.reader
+	if node == r.nodeCount {
+		return nil
+	}
+	if node < r.nodeCount {
+		// IPv4-mapped and 6to4 ranges alias the IPv4 subtree below ::/96.
+		if r.Metadata.IPVersion == 6 && node == r.ipv4Start && depth > 0 && !(depth == 96 && isZero(ip[:12])) {
+			return nil
+		}
+		if depth >= len(ip)*8 {
+			return ErrInvalidDatabase
+		}
+		for bit := uint(0); bit < 2; bit++ {
+			next := make([]byte, len(ip))
+			copy(next, ip)
+			if bit == 1 {
+				next[depth>>3] |= 0x80 >> uint(depth&7)
+			}
+			if err := w.walk(r.readNode(node, bit), next, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	offset := node - r.nodeCount - 16
+	code, ok := w.codes[offset]
+	if !ok {
+		value, _, err := w.decoder.decode(offset, 0)
+		if err != nil {
+			return err
+		}
+		record, _ := value.(map[string]any)
+		code = strings.ToUpper(recordCountry(record))
+		w.codes[offset] = code
+	}
+	if !w.wanted[code] {
+		return nil
+	}
+	network := &net.IPNet{IP: net.IP(ip), Mask: net.CIDRMask(depth, len(ip)*8)}
+	if len(ip) == net.IPv6len && depth >= 96 && isZero(ip[:12]) {
+		network = &net.IPNet{IP: net.IP(ip[12:]), Mask: net.CIDRMask(depth-96, 32)}
+	}
+	w.result[code] = append(w.result[code], network)
+	return nil
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadGeodat reads the networks of countries from a geoip.dat file in the
+// format used by Xray. Codes are upper case.
+func LoadGeodat(path string, countries []string) (map[string][]*net.IPNet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list := &geodata.GeoIPList{}
+	if err := proto.Unmarshal(data, list); err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(countries))
+	for _, country := range countries {
+		wanted[strings.ToUpper(country)] = true
+	}
+	result := make(map[string][]*net.IPNet)
+	for _, entry := range list.GetEntry() {
+		code := strings.ToUpper(entry.GetCode())
+		if !wanted[code] || entry.GetReverseMatch() {
+			continue
+		}
+		for _, cidr := range entry.GetCidr() {
+			ip := net.IP(cidr.GetIp())
+			bits := len(ip) * 8
+			if bits != 32 && bits != 128 || int(cidr.GetPrefix()) > bits {
+				continue
+			}
+			result[code] = append(result[code], &net.IPNet{IP: ip, Mask: net.CIDRMask(int(cidr.GetPrefix()), bits)})
+		}
+	}
+	return result, nil
+}
@@ -9,7 +9,10 @@ import (
 	"github.com/shirou/gopsutil/v4/net"
 )
 
-var SIGUSR1 = syscall.SIGUSR1
+var (
+	SIGUSR1 = syscall.SIGUSR1
+	SIGUSR2 = syscall.SIGUSR2
+)
 
 func GetTCPCount() (int, error) {
 	stats, err := net.Connections("tcp")
@@ -11,7 +11,10 @@ import (
 	"syscall"
 )
 
-var SIGUSR1 = syscall.SIGUSR1
+var (
+	SIGUSR1 = syscall.SIGUSR1
+	SIGUSR2 = syscall.SIGUSR2
+)
 
 func getLinesNum(filename string) (int, error) {
 	file, err := os.Open(filename)
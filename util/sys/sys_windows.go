@@ -9,7 +9,10 @@ import (
 	"github.com/shirou/gopsutil/v4/net"
 )
 
-var SIGUSR1 = syscall.Signal(0)
+var (
+	SIGUSR1 = syscall.Signal(0)
+	SIGUSR2 = syscall.Signal(0)
+)
 
 func GetTCPCount() (int, error) {
 	stats, err := net.Connections("tcp")
@@ -18,6 +18,8 @@ class DBInbound {
         this.tag = "";
         this.sniffing = "";
         this.clientStats = ""
+        this.geoMode = "";
+        this.geoCountries = "";
         if (data == null) {
             return;
         }
@@ -32,6 +34,14 @@ class DBInbound {
         this.total = toFixed(gb * ONE_GB, 0);
     }
 
+    get _geoCountries() {
+        return this.geoCountries ? this.geoCountries.split(',').filter(c => c.length > 0) : [];
+    }
+
+    set _geoCountries(countries) {
+        this.geoCountries = countries.map(c => c.trim().toUpperCase()).filter(c => c.length > 0).join(',');
+    }
+
     get isVMess() {
         return this.protocol === Protocols.VMESS;
     }
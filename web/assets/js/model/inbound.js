@@ -902,8 +902,11 @@ TlsStreamSettings.Cert = class extends XrayCommonClass {
         oneTimeLoading = false,
         usage = USAGE_OPTION.ENCIPHERMENT,
         buildChain = false,
+        certificateId = 0,
     ) {
         super();
+        this.useStore = certificateId > 0;
+        this.certId = certificateId;
         this.useFile = useFile;
         this.certFile = certificateFile;
         this.keyFile = keyFile;
@@ -915,8 +918,26 @@ TlsStreamSettings.Cert = class extends XrayCommonClass {
         this.buildChain = buildChain
     }
 
+    get source() {
+        return this.useStore ? 'store' : this.useFile ? 'file' : 'content';
+    }
+
+    set source(value) {
+        this.useStore = value === 'store';
+        this.useFile = value === 'file';
+    }
+
     static fromJson(json = {}) {
-        if ('certificateFile' in json && 'keyFile' in json) {
+        if ('certificateId' in json) {
+            return new TlsStreamSettings.Cert(
+                false, '', '', '', '',
+                json.ocspStapling,
+                json.oneTimeLoading,
+                json.usage,
+                json.buildChain,
+                json.certificateId,
+            );
+        } else if ('certificateFile' in json && 'keyFile' in json) {
             return new TlsStreamSettings.Cert(
                 true,
                 json.certificateFile,
@@ -940,7 +961,15 @@ TlsStreamSettings.Cert = class extends XrayCommonClass {
     }
 
     toJson() {
-        if (this.useFile) {
+        if (this.useStore) {
+            return {
+                certificateId: this.certId,
+                ocspStapling: this.ocspStapling,
+                oneTimeLoading: this.oneTimeLoading,
+                usage: this.usage,
+                buildChain: this.buildChain,
+            };
+        } else if (this.useFile) {
             return {
                 certificateFile: this.certFile,
                 keyFile: this.keyFile,
@@ -2552,6 +2581,7 @@ Inbound.ClientBase = class extends XrayCommonClass {
         subId = RandomUtil.randomLowerAndNum(16),
         reset = 0,
         limitIp = 0,
+        ipStrategy = '',
     ) {
         super();
         this.email = email;
@@ -2562,6 +2592,7 @@ Inbound.ClientBase = class extends XrayCommonClass {
         this.subId = subId;
         this.reset = reset;
         this.limitIp = limitIp;
+        this.ipStrategy = ipStrategy;
     }
 
     static commonArgsFromJson(json = {}) {
@@ -2574,6 +2605,7 @@ Inbound.ClientBase = class extends XrayCommonClass {
             json.subId,
             json.reset,
             json.limitIp ?? 0,
+            json.ipStrategy ?? '',
         ];
     }
 
@@ -2587,6 +2619,7 @@ Inbound.ClientBase = class extends XrayCommonClass {
             subId: this.subId,
             reset: this.reset,
             limitIp: this.limitIp,
+            ipStrategy: this.ipStrategy,
         };
     }
 
@@ -2660,9 +2693,9 @@ Inbound.VmessSettings.Vmess = class extends Inbound.ClientBase {
     constructor(
         id = RandomUtil.randomUUID(),
         security = USERS_SECURITY.AUTO,
-        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp
+        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp,ipStrategy
     ) {
-        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp);
+        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp, ipStrategy);
         this.id = id;
         this.security = security;
     }
@@ -2764,9 +2797,9 @@ Inbound.VLESSSettings.VLESS = class extends Inbound.ClientBase {
         id = RandomUtil.randomUUID(),
         flow = '',
         reverseTag = '',
-        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp
+        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp,ipStrategy
     ) {
-        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp);
+        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp, ipStrategy);
         this.id = id;
         this.flow = flow;
         this.reverseTag = reverseTag;
@@ -2866,9 +2899,9 @@ Inbound.TrojanSettings = class extends Inbound.Settings {
 Inbound.TrojanSettings.Trojan = class extends Inbound.ClientBase {
     constructor(
         password = RandomUtil.randomSeq(10),
-        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp
+        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp,ipStrategy
     ) {
-        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp);
+        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp, ipStrategy);
         this.password = password;
     }
 
@@ -2968,9 +3001,9 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends Inbound.ClientBase {
     constructor(
         method = '',
         password = RandomUtil.randomShadowsocksPassword(),
-        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp
+        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp,ipStrategy
     ) {
-        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp);
+        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp, ipStrategy);
         this.method = method;
         this.password = password;
     }
@@ -3018,9 +3051,9 @@ Inbound.HysteriaSettings = class extends Inbound.Settings {
 Inbound.HysteriaSettings.Hysteria = class extends Inbound.ClientBase {
     constructor(
         auth = RandomUtil.randomSeq(10),
-        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp
+        email,totalGB,expiryTime,enable,tgId,subId,reset,limitIp,ipStrategy
     ) {
-        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp);
+        super(email, totalGB, expiryTime, enable, tgId, subId, reset, limitIp, ipStrategy);
         this.auth = auth;
     }
 
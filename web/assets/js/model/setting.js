@@ -2,10 +2,21 @@ class AllSetting {
 
     constructor(data) {
         this.webListen = "";
+        this.webListenSocket = "";
+        this.webProxyProtocol = false;
+        this.trustedProxies = "127.0.0.1/32,::1/128";
+        this.webAllowedIps = "";
+        this.apiAllowedIps = "";
         this.webDomain = "";
         this.webPort = 54321;
         this.webCertFile = "";
         this.webKeyFile = "";
+        this.webAcme = false;
+        this.acmeEmail = "";
+        this.acmeDirectory = "https://acme-v02.api.letsencrypt.org/directory";
+        this.acmeChallenge = "http-01";
+        this.acmeHttpPort = 80;
+        this.certExpiryWarnDays = 14;
         this.webBasePath = "/";
         this.sessionMaxAge = "";
         this.pageSize = 0;
@@ -20,15 +31,19 @@ class AllSetting {
         this.tgBotBackup = false;
         this.tgBotLoginNotify = false;
         this.tgCpu = "";
+        this.tgCpuPeriod = 5;
         this.tgLang = "";
         this.subEnable = false;
         this.subListen = "";
+        this.subListenSocket = "";
+        this.subProxyProtocol = false;
         this.subPort = "2096";
         this.subPath = "/sub/";
         this.subJsonPath = "/json/";
         this.subDomain = "";
         this.subCertFile = "";
         this.subKeyFile = "";
+        this.subAcme = false;
         this.subUpdates = 0;
         this.subEncrypt = true;
         this.subShowInfo = false;
@@ -39,6 +54,42 @@ class AllSetting {
         this.subJsonMux = "";
         this.subJsonRules = "";
         this.ipBlockAfterRemove = false;
+        this.ipLimitBackend = "auto";
+        this.ipLimitStrategy = "newest";
+        this.ipBlockDuration = 60;
+        this.ipBlockMaxDuration = 3600;
+        this.hostFirewall = "off";
+        this.hostFirewallPorts = "22";
+        this.xrayMirrorUrl = "";
+        this.geoUpdateSources = "[]";
+        this.geoUpdateCron = "@daily";
+        this.metricsEnable = false;
+        this.metricsListen = "";
+        this.metricsUser = "";
+        this.metricsPassword = "";
+        this.metricsToken = "";
+        this.metricsClients = false;
+        this.apiToken = "";
+        this.serverMetricsInterval = 10;
+        this.notifyRoutes = "{}";
+        this.notifyWebhookUrl = "";
+        this.notifyWebhookSecret = "";
+        this.notifySmtpHost = "";
+        this.notifySmtpPort = 587;
+        this.notifySmtpUser = "";
+        this.notifySmtpPassword = "";
+        this.notifySmtpFrom = "";
+        this.notifySmtpTo = "";
+        this.clientWebhooks = "[]";
+        this.accessLogIngest = false;
+        this.accessLogRetention = 7;
+        this.accessLogMaxRows = 1000000;
+        this.ipHistoryRetention = 30;
+        this.sharingDetect = false;
+        this.sharingMaxSubnets = 8;
+        this.sharingMinDistance = 500;
+        this.sharingAction = "none";
+        this.sharingLimitIp = 1;
 
         this.timeLocation = "Asia/Tehran";
 
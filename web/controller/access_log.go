@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccessLogController struct {
+	accessLogService service.AccessLogService
+}
+
+func NewAccessLogController(g *gin.RouterGroup) *AccessLogController {
+	a := &AccessLogController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *AccessLogController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/accessLog")
+
+	g.POST("/search", a.search)
+	g.POST("/top/:email", a.topDestinations)
+	g.POST("/clear", a.clear)
+}
+
+func (a *AccessLogController) search(c *gin.Context) {
+	query := &service.AccessLogQuery{}
+	err := c.ShouldBind(query)
+	if err != nil {
+		jsonMsg(c, "search access log", err)
+		return
+	}
+	logs, err := a.accessLogService.Search(query)
+	if err != nil {
+		jsonMsg(c, "search access log", err)
+		return
+	}
+	jsonObj(c, logs, nil)
+}
+
+// topDestinations summarizes the last "hours" hours, one day by default.
+func (a *AccessLogController) topDestinations(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	since := time.Now().Add(-time.Duration(hours) * time.Hour).Unix()
+	destinations, err := a.accessLogService.GetTopDestinations(c.Param("email"), since, limit)
+	if err != nil {
+		jsonMsg(c, "get top destinations", err)
+		return
+	}
+	jsonObj(c, destinations, nil)
+}
+
+func (a *AccessLogController) clear(c *gin.Context) {
+	err := a.accessLogService.Clear()
+	jsonMsg(c, "clear access log", err)
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AlertController struct {
+	alertService service.AlertService
+}
+
+func NewAlertController(g *gin.RouterGroup) *AlertController {
+	a := &AlertController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *AlertController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/alert")
+
+	g.POST("/list", a.getRules)
+	g.POST("/add", a.addRule)
+	g.POST("/update/:id", a.updateRule)
+	g.POST("/del/:id", a.delRule)
+	g.POST("/events", a.getEvents)
+	g.POST("/clearEvents", a.clearEvents)
+}
+
+func (a *AlertController) getRules(c *gin.Context) {
+	rules, err := a.alertService.GetRules()
+	if err != nil {
+		jsonMsg(c, "get alert rules", err)
+		return
+	}
+	jsonObj(c, rules, nil)
+}
+
+func (a *AlertController) addRule(c *gin.Context) {
+	rule := &model.AlertRule{}
+	err := c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "add alert rule", err)
+		return
+	}
+	err = a.alertService.AddRule(rule)
+	jsonMsgObj(c, "add alert rule", rule, err)
+}
+
+func (a *AlertController) updateRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update alert rule", err)
+		return
+	}
+	rule := &model.AlertRule{}
+	err = c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "update alert rule", err)
+		return
+	}
+	rule.Id = id
+	err = a.alertService.UpdateRule(rule)
+	jsonMsgObj(c, "update alert rule", rule, err)
+}
+
+func (a *AlertController) delRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.alertService.DelRule(id)
+	jsonMsgObj(c, I18nWeb(c, "delete"), id, err)
+}
+
+func (a *AlertController) getEvents(c *gin.Context) {
+	ruleId, _ := strconv.Atoi(c.Query("ruleId"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	events, err := a.alertService.GetEvents(ruleId, limit)
+	if err != nil {
+		jsonMsg(c, "get alert events", err)
+		return
+	}
+	jsonObj(c, events, nil)
+}
+
+func (a *AlertController) clearEvents(c *gin.Context) {
+	err := a.alertService.ClearEvents()
+	jsonMsg(c, "clear alert events", err)
+}
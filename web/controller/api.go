@@ -12,6 +12,15 @@ type APIController struct {
 	outboundController    *OutboundController
 	routingRuleController *RoutingRuleController
 	serverController      *ServerController
+	geoController         *GeoController
+	alertController       *AlertController
+	webhookController     *WebhookController
+	accessLogController   *AccessLogController
+	sharingController     *SharingController
+	geoIPController       *GeoIPController
+	ipAccessController    *IpAccessController
+	certificateController *CertificateController
+	eventsController      *EventsController
 	Tgbot                 service.Tgbot
 }
 
@@ -24,6 +33,10 @@ func NewAPIController(g *gin.RouterGroup, s *ServerController) *APIController {
 }
 
 func (a *APIController) initRouter(g *gin.RouterGroup) {
+	// the event stream only reads, so it alone also takes the API token
+	a.eventsController = &EventsController{}
+	g.GET("/xui/API/events", a.checkApiLogin, a.eventsController.stream)
+
 	api := g.Group("/xui/API")
 	api.Use(a.checkLogin)
 
@@ -31,6 +44,14 @@ func (a *APIController) initRouter(g *gin.RouterGroup) {
 	a.outboundApi(api)
 	a.routingApi(api)
 	a.serverApi(api)
+	a.geoApi(api)
+	a.alertApi(api)
+	a.webhookApi(api)
+	a.accessLogApi(api)
+	a.sharingApi(api)
+	a.geoIPApi(api)
+	a.ipAccessApi(api)
+	a.certificateApi(api)
 }
 
 func (a *APIController) inboundApi(api *gin.RouterGroup) {
@@ -59,6 +80,8 @@ func (a *APIController) inboundApi(api *gin.RouterGroup) {
 		{"POST", "/delDepletedClients/:id", a.inboundController.delDepletedClients},
 		{"POST", "/import", a.inboundController.importInbound},
 		{"POST", "/onlines", a.inboundController.onlines},
+		{"GET", "/blockedIps", a.inboundController.blockedIps},
+		{"POST", "/unblockIp", a.inboundController.unblockIp},
 	}
 
 	for _, route := range inboundRoutes {
@@ -122,10 +145,16 @@ func (a *APIController) serverApi(api *gin.RouterGroup) {
 		Handler gin.HandlerFunc
 	}{
 		{"GET", "/status", a.serverController.status},
+		{"GET", "/getMetricsHistory/:range", a.serverController.getMetricsHistory},
 		{"GET", "/getDb", a.serverController.getDb},
 		{"GET", "/createbackup", a.createBackup},
 		{"GET", "/getConfigJson", a.serverController.getConfigJson},
 		{"GET", "/getXrayVersion", a.serverController.getXrayVersion},
+		{"GET", "/getXrayApiHealth", a.serverController.getXrayApiHealth},
+		{"GET", "/getXrayRestarts", a.serverController.getXrayRestarts},
+		{"GET", "/getCrashReports", a.serverController.getCrashReports},
+		{"GET", "/getCrashReport/:name", a.serverController.getCrashReport},
+		{"GET", "/getInstalledXray", a.serverController.getInstalledXray},
 		{"GET", "/getNewVlessEnc", a.serverController.getNewVlessEnc},
 		{"GET", "/getNewX25519Cert", a.serverController.getNewX25519Cert},
 		{"GET", "/getNewmldsa65", a.serverController.getNewmldsa65},
@@ -134,7 +163,11 @@ func (a *APIController) serverApi(api *gin.RouterGroup) {
 		{"POST", "/importDB", a.serverController.importDB},
 		{"POST", "/stopXrayService", a.serverController.stopXrayService},
 		{"POST", "/restartXrayService", a.serverController.restartXrayService},
+		{"POST", "/reloadCert", a.serverController.reloadCert},
 		{"POST", "/installXray/:version", a.serverController.installXray},
+		{"POST", "/installXrayArchive", a.serverController.installXrayArchive},
+		{"POST", "/activateXray/:version", a.serverController.activateXray},
+		{"POST", "/removeXray/:version", a.serverController.removeXray},
 		{"POST", "/logs/:count", a.serverController.getLogs},
 	}
 
@@ -143,6 +176,173 @@ func (a *APIController) serverApi(api *gin.RouterGroup) {
 	}
 }
 
+func (a *APIController) geoApi(api *gin.RouterGroup) {
+	geoApi := api.Group("/geo")
+
+	a.geoController = &GeoController{}
+
+	geoRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.geoController.getGeoFiles},
+		{"POST", "/upload", a.geoController.uploadGeoFile},
+		{"POST", "/del/:name", a.geoController.delGeoFile},
+		{"POST", "/update", a.geoController.updateGeoFiles},
+	}
+
+	for _, route := range geoRoutes {
+		geoApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+func (a *APIController) alertApi(api *gin.RouterGroup) {
+	alertApi := api.Group("/alerts")
+
+	a.alertController = &AlertController{}
+
+	alertRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.alertController.getRules},
+		{"GET", "/events", a.alertController.getEvents},
+		{"POST", "/add", a.alertController.addRule},
+		{"POST", "/update/:id", a.alertController.updateRule},
+		{"POST", "/del/:id", a.alertController.delRule},
+		{"POST", "/clearEvents", a.alertController.clearEvents},
+	}
+
+	for _, route := range alertRoutes {
+		alertApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+func (a *APIController) webhookApi(api *gin.RouterGroup) {
+	webhookApi := api.Group("/webhooks")
+
+	a.webhookController = &WebhookController{}
+
+	webhookRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.webhookController.getDeliveries},
+		{"POST", "/replay/:id", a.webhookController.replay},
+	}
+
+	for _, route := range webhookRoutes {
+		webhookApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+func (a *APIController) accessLogApi(api *gin.RouterGroup) {
+	accessLogApi := api.Group("/accessLogs")
+
+	a.accessLogController = &AccessLogController{}
+
+	accessLogRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.accessLogController.search},
+		{"GET", "/top/:email", a.accessLogController.topDestinations},
+		{"POST", "/clear", a.accessLogController.clear},
+	}
+
+	for _, route := range accessLogRoutes {
+		accessLogApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+func (a *APIController) sharingApi(api *gin.RouterGroup) {
+	sharingApi := api.Group("/sharing")
+
+	a.sharingController = &SharingController{}
+
+	sharingRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.sharingController.getFlags},
+		{"GET", "/history/:email", a.sharingController.getHistory},
+		{"POST", "/clearFlags", a.sharingController.clearFlags},
+	}
+
+	for _, route := range sharingRoutes {
+		sharingApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+func (a *APIController) geoIPApi(api *gin.RouterGroup) {
+	geoIPApi := api.Group("/geoip")
+
+	a.geoIPController = &GeoIPController{}
+
+	geoIPRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.geoIPController.getDatabases},
+		{"GET", "/lookup", a.geoIPController.lookup},
+		{"POST", "/upload", a.geoIPController.upload},
+		{"POST", "/delete/:name", a.geoIPController.delete},
+	}
+
+	for _, route := range geoIPRoutes {
+		geoIPApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+func (a *APIController) ipAccessApi(api *gin.RouterGroup) {
+	ipAccessApi := api.Group("/ipAccess")
+
+	a.ipAccessController = &IpAccessController{}
+
+	ipAccessRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.ipAccessController.getRules},
+		{"POST", "/ban", a.ipAccessController.ban},
+		{"POST", "/allow", a.ipAccessController.allow},
+		{"POST", "/del/:id", a.ipAccessController.delRule},
+	}
+
+	for _, route := range ipAccessRoutes {
+		ipAccessApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+func (a *APIController) certificateApi(api *gin.RouterGroup) {
+	certificateApi := api.Group("/certificate")
+
+	a.certificateController = &CertificateController{}
+
+	certificateRoutes := []struct {
+		Method  string
+		Path    string
+		Handler gin.HandlerFunc
+	}{
+		{"GET", "/list", a.certificateController.getCertificates},
+		{"POST", "/upload", a.certificateController.upload},
+		{"POST", "/generate", a.certificateController.generate},
+		{"POST", "/renew/:id", a.certificateController.renew},
+		{"POST", "/del/:id", a.certificateController.delCertificate},
+	}
+
+	for _, route := range certificateRoutes {
+		certificateApi.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
 func (a *APIController) createBackup(c *gin.Context) {
 	a.Tgbot.SendBackupToAdmins()
 }
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CertificateController struct {
+	certificateService service.CertificateService
+}
+
+func NewCertificateController(g *gin.RouterGroup) *CertificateController {
+	a := &CertificateController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *CertificateController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/certificate")
+
+	g.POST("/list", a.getCertificates)
+	g.POST("/upload", a.upload)
+	g.POST("/generate", a.generate)
+	g.POST("/renew/:id", a.renew)
+	g.POST("/del/:id", a.delCertificate)
+}
+
+func (a *CertificateController) getCertificates(c *gin.Context) {
+	certs, err := a.certificateService.GetAll()
+	if err != nil {
+		jsonMsg(c, "get certificates", err)
+		return
+	}
+	jsonObj(c, certs, nil)
+}
+
+// upload takes the PEM encoded "cert" chain and "key", and an optional
+// "name".
+func (a *CertificateController) upload(c *gin.Context) {
+	cert, err := a.certificateService.Upload(c.PostForm("name"), c.PostForm("cert"), c.PostForm("key"))
+	jsonMsgObj(c, "upload certificate", cert, err)
+}
+
+// generate takes the "source" (self_signed, ca, internal or acme), the
+// comma separated "domains", the validity in "days" (0 for the default),
+// the "issuerId" of the ca for internal certificates and a "name".
+func (a *CertificateController) generate(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultPostForm("days", "0"))
+	if err != nil {
+		jsonMsg(c, "generate certificate", err)
+		return
+	}
+	issuerId, err := strconv.Atoi(c.DefaultPostForm("issuerId", "0"))
+	if err != nil {
+		jsonMsg(c, "generate certificate", err)
+		return
+	}
+	cert, err := a.certificateService.Generate(c.PostForm("name"), c.PostForm("source"), c.PostForm("domains"), days, issuerId)
+	jsonMsgObj(c, "generate certificate", cert, err)
+}
+
+func (a *CertificateController) renew(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "renew certificate", err)
+		return
+	}
+	cert, err := a.certificateService.Renew(id)
+	jsonMsgObj(c, "renew certificate", cert, err)
+}
+
+func (a *CertificateController) delCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete certificate", err)
+		return
+	}
+	err = a.certificateService.Delete(id)
+	jsonMsg(c, "delete certificate", err)
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/alireza0/x-ui/web/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const eventsPingInterval = 30 * time.Second
+
+var eventsUpgrader = websocket.Upgrader{}
+
+type EventsController struct{}
+
+// stream pushes live events to the client, as a WebSocket when the request
+// asks for an upgrade and as server-sent events otherwise. The optional
+// "types" query limits the stream to a comma separated list of event types.
+func (a *EventsController) stream(c *gin.Context) {
+	var types map[string]bool
+	if query := c.Query("types"); query != "" {
+		types = map[string]bool{}
+		for _, t := range strings.Split(query, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	ch, cancel := events.Subscribe()
+	defer cancel()
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		a.streamWebSocket(c, ch, cancel, types)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	ticker := time.NewTicker(eventsPingInterval)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			if types == nil || types[event.Type] {
+				c.SSEvent(event.Type, event)
+			}
+			return true
+		case now := <-ticker.C:
+			c.SSEvent("ping", now.UnixMilli())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func (a *EventsController) streamWebSocket(c *gin.Context, ch <-chan events.Event, cancel func(), types map[string]bool) {
+	conn, err := eventsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// the client does not send anything; reading only detects when it leaves
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(eventsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if types != nil && !types[event.Type] {
+				continue
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(10 * time.Second)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		}
+	}
+}
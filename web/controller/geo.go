@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GeoController struct {
+	geoService service.GeoService
+}
+
+func NewGeoController(g *gin.RouterGroup) *GeoController {
+	a := &GeoController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *GeoController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/geo")
+
+	g.POST("/list", a.getGeoFiles)
+	g.POST("/upload", a.uploadGeoFile)
+	g.POST("/del/:name", a.delGeoFile)
+	g.POST("/update", a.updateGeoFiles)
+}
+
+func (a *GeoController) getGeoFiles(c *gin.Context) {
+	files, err := a.geoService.GetGeoFiles()
+	if err != nil {
+		jsonMsg(c, "get geo files", err)
+		return
+	}
+	jsonObj(c, files, nil)
+}
+
+func (a *GeoController) uploadGeoFile(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		jsonMsg(c, "Error reading geo file", err)
+		return
+	}
+	defer file.Close()
+	name := c.PostForm("name")
+	if name == "" {
+		name = header.Filename
+	}
+	err = a.geoService.UploadGeoFile(name, file)
+	jsonMsg(c, "upload "+name, err)
+}
+
+func (a *GeoController) delGeoFile(c *gin.Context) {
+	name := c.Param("name")
+	err := a.geoService.DeleteGeoFile(name)
+	jsonMsg(c, I18nWeb(c, "delete")+" "+name, err)
+}
+
+func (a *GeoController) updateGeoFiles(c *gin.Context) {
+	err := a.geoService.UpdateGeoFiles()
+	jsonMsg(c, "update geo files", err)
+}
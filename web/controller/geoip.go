@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GeoIPController struct {
+	geoIPService service.GeoIPService
+}
+
+func NewGeoIPController(g *gin.RouterGroup) *GeoIPController {
+	a := &GeoIPController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *GeoIPController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/geoip")
+
+	g.POST("/databases", a.getDatabases)
+	g.POST("/lookup", a.lookup)
+	g.POST("/upload", a.upload)
+	g.POST("/delete/:name", a.delete)
+}
+
+func (a *GeoIPController) getDatabases(c *gin.Context) {
+	jsonObj(c, a.geoIPService.GetDatabases(), nil)
+}
+
+// lookup accepts one or more "ip" values, each may be a comma separated list.
+func (a *GeoIPController) lookup(c *gin.Context) {
+	values := c.QueryArray("ip")
+	if len(values) == 0 {
+		values = c.PostFormArray("ip")
+	}
+	ips := make([]string, 0, len(values))
+	for _, value := range values {
+		ips = append(ips, strings.Split(value, ",")...)
+	}
+	result, err := a.geoIPService.Lookup(ips)
+	if err != nil {
+		jsonMsg(c, "geoip lookup", err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
+
+func (a *GeoIPController) upload(c *gin.Context) {
+	file, header, err := c.Request.FormFile("mmdb")
+	if err != nil {
+		jsonMsg(c, "Error reading geoip database", err)
+		return
+	}
+	defer file.Close()
+	err = a.geoIPService.Upload(header.Filename, file)
+	jsonMsg(c, "upload geoip database", err)
+}
+
+func (a *GeoIPController) delete(c *gin.Context) {
+	err := a.geoIPService.Delete(c.Param("name"))
+	jsonMsg(c, "delete geoip database", err)
+}
@@ -13,8 +13,9 @@ import (
 )
 
 type InboundController struct {
-	inboundService service.InboundService
-	xrayService    service.XrayService
+	inboundService  service.InboundService
+	xrayService     service.XrayService
+	ipAccessService service.IpAccessService
 }
 
 func NewInboundController(g *gin.RouterGroup) *InboundController {
@@ -39,6 +40,8 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g.POST("/delDepletedClients/:id", a.delDepletedClients)
 	g.POST("/import", a.importInbound)
 	g.POST("/onlines", a.onlines)
+	g.POST("/blockedIps", a.blockedIps)
+	g.POST("/unblockIp", a.unblockIp)
 }
 
 func (a *InboundController) getInbounds(c *gin.Context) {
@@ -101,6 +104,10 @@ func (a *InboundController) addInbound(c *gin.Context) {
 
 	inbound, needRestart, err := a.inboundService.AddInbound(inbound)
 	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.create"), inbound, err)
+	if err == nil {
+		service.RefreshGeoAccess()
+		service.RefreshHostFirewall()
+	}
 	if err == nil && needRestart {
 		a.xrayService.SetToNeedRestart()
 	}
@@ -114,6 +121,10 @@ func (a *InboundController) delInbound(c *gin.Context) {
 	}
 	needRestart, err := a.inboundService.DelInbound(id)
 	jsonMsgObj(c, I18nWeb(c, "delete"), id, err)
+	if err == nil {
+		service.RefreshGeoAccess()
+		service.RefreshHostFirewall()
+	}
 	if err == nil && needRestart {
 		a.xrayService.SetToNeedRestart()
 	}
@@ -135,6 +146,10 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 	}
 	inbound, needRestart, err := a.inboundService.UpdateInbound(inbound)
 	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.update"), inbound, err)
+	if err == nil {
+		service.RefreshGeoAccess()
+		service.RefreshHostFirewall()
+	}
 	if err == nil && needRestart {
 		a.xrayService.SetToNeedRestart()
 	}
@@ -283,6 +298,10 @@ func (a *InboundController) importInbound(c *gin.Context) {
 
 	inbound, needRestart, err := a.inboundService.AddInbound(inbound)
 	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.create"), inbound, err)
+	if err == nil {
+		service.RefreshGeoAccess()
+		service.RefreshHostFirewall()
+	}
 	if err == nil && needRestart {
 		a.xrayService.SetToNeedRestart()
 	}
@@ -291,3 +310,18 @@ func (a *InboundController) importInbound(c *gin.Context) {
 func (a *InboundController) onlines(c *gin.Context) {
 	jsonObj(c, a.xrayService.GetOnlineUsers(), nil)
 }
+
+func (a *InboundController) blockedIps(c *gin.Context) {
+	jsonObj(c, service.GetBlockedList(), nil)
+}
+
+// unblockIp lifts the blocks of "ip" on "port", or on all ports without one.
+func (a *InboundController) unblockIp(c *gin.Context) {
+	port, err := strconv.ParseUint(c.DefaultPostForm("port", "0"), 10, 16)
+	if err != nil {
+		jsonMsg(c, "unblock ip", err)
+		return
+	}
+	count, err := a.ipAccessService.Unblock(c.PostForm("ip"), uint16(port))
+	jsonMsgObj(c, "unblock ip", count, err)
+}
@@ -5,7 +5,6 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/alireza0/x-ui/logger"
 	"github.com/alireza0/x-ui/web/service"
 	"github.com/alireza0/x-ui/web/session"
 
@@ -66,20 +65,20 @@ func (a *IndexController) login(c *gin.Context) {
 	safeUser := template.HTMLEscapeString(form.Username)
 	safePass := template.HTMLEscapeString(form.Password)
 	if user == nil {
-		logger.Infof("wrong username or password: \"%s\" \"%s\"", safeUser, safePass)
+		requestLog(c).Infof("wrong username or password: \"%s\" \"%s\"", safeUser, safePass)
 		a.tgbot.UserLoginNotify(safeUser, getRemoteIp(c), timeStr, 0)
 		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.wrongUsernameOrPassword"))
 		return
 	} else {
-		logger.Infof("%s Successful Login ,Ip Address: %s\n", safeUser, getRemoteIp(c))
+		requestLog(c).Infof("%s Successful Login ,Ip Address: %s\n", safeUser, getRemoteIp(c))
 		a.tgbot.UserLoginNotify(safeUser, getRemoteIp(c), timeStr, 1)
 	}
 
 	err = session.SetLoginUser(c, user)
 	if err == nil {
-		logger.Infof("%s logged in successfully", user.Username)
+		requestLog(c).Infof("%s logged in successfully", user.Username)
 	} else {
-		logger.Error("Unable to set login user")
+		requestLog(c).Error("Unable to set login user")
 	}
 	jsonMsg(c, I18nWeb(c, "pages.login.toasts.successLogin"), err)
 }
@@ -87,7 +86,7 @@ func (a *IndexController) login(c *gin.Context) {
 func (a *IndexController) logout(c *gin.Context) {
 	user := session.GetLoginUser(c)
 	if user != nil {
-		logger.Infof("%s logged out successfully", user.Username)
+		requestLog(c).Infof("%s logged out successfully", user.Username)
 	}
 	session.ClearSession(c)
 	c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path"))
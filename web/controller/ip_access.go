@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IpAccessController struct {
+	ipAccessService service.IpAccessService
+}
+
+func NewIpAccessController(g *gin.RouterGroup) *IpAccessController {
+	a := &IpAccessController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *IpAccessController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/ipAccess")
+
+	g.POST("/list", a.getRules)
+	g.POST("/ban", a.ban)
+	g.POST("/allow", a.allow)
+	g.POST("/del/:id", a.delRule)
+}
+
+func (a *IpAccessController) getRules(c *gin.Context) {
+	rules, err := a.ipAccessService.List()
+	if err != nil {
+		jsonMsg(c, "get ip access rules", err)
+		return
+	}
+	jsonObj(c, rules, nil)
+}
+
+// ban takes "cidr", an optional "port" (0 for all ports) and "minutes" (0
+// for a permanent ban).
+func (a *IpAccessController) ban(c *gin.Context) {
+	port, err := strconv.ParseUint(c.DefaultPostForm("port", "0"), 10, 16)
+	if err != nil {
+		jsonMsg(c, "ban ip", err)
+		return
+	}
+	minutes, err := strconv.Atoi(c.DefaultPostForm("minutes", "0"))
+	if err != nil {
+		jsonMsg(c, "ban ip", err)
+		return
+	}
+	rule, err := a.ipAccessService.Ban(c.PostForm("cidr"), uint16(port), minutes, c.PostForm("remark"))
+	jsonMsgObj(c, "ban ip", rule, err)
+	if err == nil {
+		service.RefreshIpAccess()
+	}
+}
+
+func (a *IpAccessController) allow(c *gin.Context) {
+	rule, err := a.ipAccessService.Allow(c.PostForm("cidr"), c.PostForm("remark"))
+	jsonMsgObj(c, "allow ip", rule, err)
+	if err == nil {
+		service.RefreshIpAccess()
+	}
+}
+
+func (a *IpAccessController) delRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		jsonMsg(c, "delete ip access rule", err)
+		return
+	}
+	err = a.ipAccessService.Delete(id)
+	jsonMsg(c, "delete ip access rule", err)
+	if err == nil {
+		service.RefreshIpAccess()
+	}
+}
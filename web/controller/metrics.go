@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/metrics"
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	metricsService service.MetricsService
+	settingService service.SettingService
+}
+
+func NewMetricsController() *MetricsController {
+	return &MetricsController{}
+}
+
+// Handler serves the metrics in Prometheus text format. When a user/password
+// or a token is configured, the scraper has to present one of them.
+func (a *MetricsController) Handler(c *gin.Context) {
+	if !a.authorized(c) {
+		c.Header("WWW-Authenticate", `Basic realm="metrics"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	w := metrics.NewWriter()
+	if err := a.metricsService.Collect(w); err != nil {
+		logger.Warning("collect metrics failed:", err)
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", metrics.ContentType)
+	w.WriteTo(c.Writer)
+}
+
+func (a *MetricsController) authorized(c *gin.Context) bool {
+	user, _ := a.settingService.GetMetricsUser()
+	password, _ := a.settingService.GetMetricsPassword()
+	token, _ := a.settingService.GetMetricsToken()
+	if user == "" && password == "" && token == "" {
+		return true
+	}
+
+	if token != "" {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if given == "" || given == c.GetHeader("Authorization") {
+			given = c.Query("token")
+		}
+		if given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	if user != "" || password != "" {
+		givenUser, givenPassword, ok := c.Request.BasicAuth()
+		if ok &&
+			subtle.ConstantTimeCompare([]byte(givenUser), []byte(user)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(givenPassword), []byte(password)) == 1 {
+			return true
+		}
+	}
+	return false
+}
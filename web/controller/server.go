@@ -1,11 +1,13 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
 	"time"
 
+	"github.com/alireza0/x-ui/web/events"
 	"github.com/alireza0/x-ui/web/global"
 	"github.com/alireza0/x-ui/web/service"
 
@@ -17,7 +19,8 @@ var filenameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
 type ServerController struct {
 	BaseController
 
-	serverService service.ServerService
+	serverService       service.ServerService
+	serverMetricService service.ServerMetricService
 
 	lastStatus        *service.Status
 	lastGetStatusTime time.Time
@@ -40,17 +43,27 @@ func (a *ServerController) initRouter(g *gin.RouterGroup) {
 
 	g.Use(a.checkLogin)
 	g.GET("/status", a.status)
+	g.GET("/getMetricsHistory/:range", a.getMetricsHistory)
 	g.GET("/getDb", a.getDb)
 	g.GET("/getConfigJson", a.getConfigJson)
 	g.GET("/getNewmldsa65", a.getNewmldsa65)
 	g.GET("/getNewVlessEnc", a.getNewVlessEnc)
 	g.GET("/getXrayVersion", a.getXrayVersion)
+	g.GET("/getXrayApiHealth", a.getXrayApiHealth)
+	g.GET("/getXrayRestarts", a.getXrayRestarts)
+	g.GET("/getCrashReports", a.getCrashReports)
+	g.GET("/getCrashReport/:name", a.getCrashReport)
+	g.GET("/getInstalledXray", a.getInstalledXray)
 	g.GET("/getNewX25519Cert", a.getNewX25519Cert)
 
 	g.POST("/getNewEchCert", a.getNewEchCert)
 	g.POST("/stopXrayService", a.stopXrayService)
 	g.POST("/restartXrayService", a.restartXrayService)
+	g.POST("/reloadCert", a.reloadCert)
 	g.POST("/installXray/:version", a.installXray)
+	g.POST("/installXrayArchive", a.installXrayArchive)
+	g.POST("/activateXray/:version", a.activateXray)
+	g.POST("/removeXray/:version", a.removeXray)
 	g.POST("/logs/:count", a.getLogs)
 	g.POST("/importDB", a.importDB)
 }
@@ -64,10 +77,14 @@ func (a *ServerController) startTask() {
 	c := webServer.GetCron()
 	c.AddFunc("@every 2s", func() {
 		now := time.Now()
-		if now.Sub(a.lastGetStatusTime) > time.Minute*3 {
+		streaming := events.HasSubscribers()
+		if now.Sub(a.lastGetStatusTime) > time.Minute*3 && !streaming {
 			return
 		}
 		a.refreshStatus()
+		if streaming {
+			events.Publish(events.Status, a.lastStatus)
+		}
 	})
 }
 
@@ -77,6 +94,11 @@ func (a *ServerController) status(c *gin.Context) {
 	jsonObj(c, a.lastStatus, nil)
 }
 
+func (a *ServerController) getMetricsHistory(c *gin.Context) {
+	history, err := a.serverMetricService.GetHistory(c.Param("range"))
+	jsonObj(c, history, err)
+}
+
 func (a *ServerController) getXrayVersion(c *gin.Context) {
 	now := time.Now()
 	if now.Sub(a.lastGetVersionsTime) <= time.Minute {
@@ -96,12 +118,68 @@ func (a *ServerController) getXrayVersion(c *gin.Context) {
 	jsonObj(c, versions, nil)
 }
 
+func (a *ServerController) getXrayApiHealth(c *gin.Context) {
+	jsonObj(c, a.serverService.GetXrayAPIHealth(), nil)
+}
+
+func (a *ServerController) getXrayRestarts(c *gin.Context) {
+	jsonObj(c, a.serverService.GetXrayRestarts(), nil)
+}
+
+func (a *ServerController) getCrashReports(c *gin.Context) {
+	reports, err := a.serverService.GetCrashReports()
+	if err != nil {
+		jsonMsg(c, "get crash reports", err)
+		return
+	}
+	jsonObj(c, reports, nil)
+}
+
+func (a *ServerController) getCrashReport(c *gin.Context) {
+	report, err := a.serverService.ReadCrashReport(c.Param("name"))
+	if err != nil {
+		jsonMsg(c, "get crash report", err)
+		return
+	}
+	jsonObj(c, report, nil)
+}
+
 func (a *ServerController) installXray(c *gin.Context) {
 	version := c.Param("version")
 	err := a.serverService.UpdateXray(version)
 	jsonMsg(c, I18nWeb(c, "install")+" xray", err)
 }
 
+func (a *ServerController) installXrayArchive(c *gin.Context) {
+	file, _, err := c.Request.FormFile("archive")
+	if err != nil {
+		jsonMsg(c, "Error reading xray archive", err)
+		return
+	}
+	defer file.Close()
+	err = a.serverService.InstallXrayArchive(file)
+	jsonMsg(c, I18nWeb(c, "install")+" xray", err)
+}
+
+func (a *ServerController) getInstalledXray(c *gin.Context) {
+	versions, err := a.serverService.GetInstalledXrayVersions()
+	if err != nil {
+		jsonMsg(c, "get installed xray versions", err)
+		return
+	}
+	jsonObj(c, versions, nil)
+}
+
+func (a *ServerController) activateXray(c *gin.Context) {
+	err := a.serverService.ActivateXrayVersion(c.Param("version"))
+	jsonMsg(c, "activate xray "+c.Param("version"), err)
+}
+
+func (a *ServerController) removeXray(c *gin.Context) {
+	err := a.serverService.RemoveXrayVersion(c.Param("version"))
+	jsonMsg(c, I18nWeb(c, "delete")+" xray "+c.Param("version"), err)
+}
+
 func (a *ServerController) stopXrayService(c *gin.Context) {
 	a.lastGetStatusTime = time.Now()
 	err := a.serverService.StopXrayService()
@@ -121,6 +199,16 @@ func (a *ServerController) restartXrayService(c *gin.Context) {
 	jsonMsg(c, "Xray restarted", err)
 }
 
+// reloadCert loads the certificate files of the panel and subscription
+// listeners again, for deploy hooks of external certificate tools.
+func (a *ServerController) reloadCert(c *gin.Context) {
+	err := global.GetWebServer().ReloadCert()
+	if subServer := global.GetSubServer(); subServer != nil {
+		err = errors.Join(err, subServer.ReloadCert())
+	}
+	jsonMsg(c, "reload certificate", err)
+}
+
 func (a *ServerController) getLogs(c *gin.Context) {
 	count := c.Param("count")
 	level := c.PostForm("level")
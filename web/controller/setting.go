@@ -2,9 +2,11 @@ package controller
 
 import (
 	"errors"
+	"net"
 	"time"
 
 	"github.com/alireza0/x-ui/web/entity"
+	"github.com/alireza0/x-ui/web/network"
 	"github.com/alireza0/x-ui/web/service"
 	"github.com/alireza0/x-ui/web/session"
 
@@ -22,6 +24,7 @@ type SettingController struct {
 	settingService service.SettingService
 	userService    service.UserService
 	panelService   service.PanelService
+	notifyService  service.NotifyService
 }
 
 func NewSettingController(g *gin.RouterGroup) *SettingController {
@@ -38,6 +41,7 @@ func (a *SettingController) initRouter(g *gin.RouterGroup) {
 	g.POST("/update", a.updateSetting)
 	g.POST("/updateUser", a.updateUser)
 	g.POST("/restartPanel", a.restartPanel)
+	g.POST("/testNotify/:channel", a.testNotify)
 	g.GET("/getDefaultJsonConfig", a.getDefaultXrayConfig)
 }
 
@@ -66,6 +70,14 @@ func (a *SettingController) updateSetting(c *gin.Context) {
 		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
 		return
 	}
+	if allowed, err := network.ParseNetworks(allSetting.WebAllowedIps); err == nil && len(allowed) > 0 {
+		// refuse a list that would lock out the admin saving it
+		remoteIp := getRemoteIp(c)
+		if ip := net.ParseIP(remoteIp); ip == nil || !allowed.Contains(ip) {
+			jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), errors.New(I18nWeb(c, "pages.settings.toasts.allowedIpsLockout", "ip=="+remoteIp)))
+			return
+		}
+	}
 	err = a.settingService.UpdateAllSetting(allSetting)
 	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
 }
@@ -108,3 +120,9 @@ func (a *SettingController) getDefaultXrayConfig(c *gin.Context) {
 	}
 	jsonObj(c, defaultJsonConfig, nil)
 }
+
+func (a *SettingController) testNotify(c *gin.Context) {
+	channel := c.Param("channel")
+	err := a.notifyService.Test(channel)
+	jsonMsg(c, I18nWeb(c, "pages.settings.notifyTest")+" "+channel, err)
+}
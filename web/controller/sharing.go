@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SharingController struct {
+	sharingService service.SharingService
+}
+
+func NewSharingController(g *gin.RouterGroup) *SharingController {
+	a := &SharingController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *SharingController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/sharing")
+
+	g.POST("/flags", a.getFlags)
+	g.POST("/history/:email", a.getHistory)
+	g.POST("/clearFlags", a.clearFlags)
+}
+
+// getFlags returns the flags of the last "days" days, seven by default.
+func (a *SharingController) getFlags(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 {
+		days = 7
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	since := time.Now().AddDate(0, 0, -days).Unix()
+	flags, err := a.sharingService.GetFlags(c.Query("email"), since, limit)
+	if err != nil {
+		jsonMsg(c, "get sharing flags", err)
+		return
+	}
+	jsonObj(c, flags, nil)
+}
+
+func (a *SharingController) getHistory(c *gin.Context) {
+	history, err := a.sharingService.GetHistory(c.Param("email"))
+	if err != nil {
+		jsonMsg(c, "get ip history", err)
+		return
+	}
+	jsonObj(c, history, nil)
+}
+
+func (a *SharingController) clearFlags(c *gin.Context) {
+	err := a.sharingService.ClearFlags()
+	jsonMsg(c, "clear sharing flags", err)
+}
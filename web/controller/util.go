@@ -8,20 +8,21 @@ import (
 	"github.com/alireza0/x-ui/config"
 	"github.com/alireza0/x-ui/logger"
 	"github.com/alireza0/x-ui/web/entity"
+	"github.com/alireza0/x-ui/web/service"
 
 	"github.com/gin-gonic/gin"
 )
 
+// requestLog returns a logger of the web component tagged with the request id.
+func requestLog(c *gin.Context) *logger.Entry {
+	return logger.WithComponent("web").WithFields(logger.Fields{
+		"requestId": c.GetString("request_id"),
+		"ip":        getRemoteIp(c),
+	})
+}
+
 func getRemoteIp(c *gin.Context) string {
-	value := c.GetHeader("X-Forwarded-For")
-	if value != "" {
-		ips := strings.Split(value, ",")
-		return ips[0]
-	} else {
-		addr := c.Request.RemoteAddr
-		ip, _, _ := net.SplitHostPort(addr)
-		return ip
-	}
+	return service.TrustedProxies().ClientIP(c.Request)
 }
 
 func jsonMsg(c *gin.Context, msg string, err error) {
@@ -44,7 +45,7 @@ func jsonMsgObj(c *gin.Context, msg string, obj interface{}, err error) {
 	} else {
 		m.Success = false
 		m.Msg = msg + I18nWeb(c, "fail") + ": " + err.Error()
-		logger.Warning(msg+I18nWeb(c, "fail")+": ", err)
+		requestLog(c).Warning(msg+I18nWeb(c, "fail")+": ", err)
 	}
 	c.JSON(http.StatusOK, m)
 }
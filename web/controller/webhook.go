@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/alireza0/x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookController(g *gin.RouterGroup) *WebhookController {
+	a := &WebhookController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *WebhookController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/webhook")
+
+	g.POST("/deliveries", a.getDeliveries)
+	g.POST("/replay/:id", a.replay)
+}
+
+func (a *WebhookController) getDeliveries(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	deliveries, err := a.webhookService.GetDeliveries(c.Query("status"), limit)
+	if err != nil {
+		jsonMsg(c, "get webhook deliveries", err)
+		return
+	}
+	jsonObj(c, deliveries, nil)
+}
+
+func (a *WebhookController) replay(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		jsonMsg(c, "replay webhook", err)
+		return
+	}
+	delivery, err := a.webhookService.Replay(id)
+	jsonMsgObj(c, "replay webhook", delivery, err)
+}
@@ -7,11 +7,19 @@ import (
 type XUIController struct {
 	BaseController
 
-	inboundController      *InboundController
-	outboundController     *OutboundController
-	routingRuleController  *RoutingRuleController
-	settingController      *SettingController
+	inboundController     *InboundController
+	outboundController    *OutboundController
+	routingRuleController *RoutingRuleController
+	settingController     *SettingController
 	xraySettingController *XraySettingController
+	geoController         *GeoController
+	alertController       *AlertController
+	webhookController     *WebhookController
+	accessLogController   *AccessLogController
+	sharingController     *SharingController
+	geoIPController       *GeoIPController
+	ipAccessController    *IpAccessController
+	certificateController *CertificateController
 }
 
 func NewXUIController(g *gin.RouterGroup) *XUIController {
@@ -36,6 +44,14 @@ func (a *XUIController) initRouter(g *gin.RouterGroup) {
 	a.routingRuleController = NewRoutingRuleController(g)
 	a.settingController = NewSettingController(g)
 	a.xraySettingController = NewXraySettingController(g)
+	a.geoController = NewGeoController(g)
+	a.alertController = NewAlertController(g)
+	a.webhookController = NewWebhookController(g)
+	a.accessLogController = NewAccessLogController(g)
+	a.sharingController = NewSharingController(g)
+	a.geoIPController = NewGeoIPController(g)
+	a.ipAccessController = NewIpAccessController(g)
+	a.certificateController = NewCertificateController(g)
 }
 
 func (a *XUIController) index(c *gin.Context) {
@@ -2,11 +2,17 @@ package entity
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"net"
+	"net/mail"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/alireza0/x-ui/hostfw"
 	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/web/network"
 )
 
 type Msg struct {
@@ -16,45 +22,96 @@ type Msg struct {
 }
 
 type AllSetting struct {
-	WebListen        string `json:"webListen" form:"webListen"`
-	WebDomain        string `json:"webDomain" form:"webDomain"`
-	WebPort          int    `json:"webPort" form:"webPort"`
-	WebCertFile      string `json:"webCertFile" form:"webCertFile"`
-	WebKeyFile       string `json:"webKeyFile" form:"webKeyFile"`
-	WebBasePath      string `json:"webBasePath" form:"webBasePath"`
-	SessionMaxAge    int    `json:"sessionMaxAge" form:"sessionMaxAge"`
-	PageSize         int    `json:"pageSize" form:"pageSize"`
-	ExpireDiff       int    `json:"expireDiff" form:"expireDiff"`
-	TrafficDiff      int    `json:"trafficDiff" form:"trafficDiff"`
-	RemarkModel      string `json:"remarkModel" form:"remarkModel"`
-	OutboundTestUrl  string `json:"outboundTestUrl" form:"outboundTestUrl"`
-	TgBotEnable      bool   `json:"tgBotEnable" form:"tgBotEnable"`
-	TgBotToken       string `json:"tgBotToken" form:"tgBotToken"`
-	TgBotChatId      string `json:"tgBotChatId" form:"tgBotChatId"`
-	TgRunTime        string `json:"tgRunTime" form:"tgRunTime"`
-	TgBotBackup      bool   `json:"tgBotBackup" form:"tgBotBackup"`
-	TgBotLoginNotify bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"`
-	TgCpu            int    `json:"tgCpu" form:"tgCpu"`
-	TgLang           string `json:"tgLang" form:"tgLang"`
-	TimeLocation     string `json:"timeLocation" form:"timeLocation"`
-	SubEnable        bool   `json:"subEnable" form:"subEnable"`
-	SubListen        string `json:"subListen" form:"subListen"`
-	SubPort          int    `json:"subPort" form:"subPort"`
-	SubPath          string `json:"subPath" form:"subPath"`
-	SubDomain        string `json:"subDomain" form:"subDomain"`
-	SubCertFile      string `json:"subCertFile" form:"subCertFile"`
-	SubKeyFile       string `json:"subKeyFile" form:"subKeyFile"`
-	SubUpdates       int    `json:"subUpdates" form:"subUpdates"`
-	SubEncrypt       bool   `json:"subEncrypt" form:"subEncrypt"`
-	SubShowInfo      bool   `json:"subShowInfo" form:"subShowInfo"`
-	SubURI           string `json:"subURI" form:"subURI"`
-	SubJsonPath      string `json:"subJsonPath" form:"subJsonPath"`
-	SubJsonURI       string `json:"subJsonURI" form:"subJsonURI"`
-	SubJsonFragment  string `json:"subJsonFragment" form:"subJsonFragment"`
-	SubJsonNoises    string `json:"subJsonNoises" form:"subJsonNoises"`
-	SubJsonMux       string `json:"subJsonMux" form:"subJsonMux"`
-	SubJsonRules       string `json:"subJsonRules" form:"subJsonRules"`
-	IpBlockAfterRemove bool   `json:"ipBlockAfterRemove" form:"ipBlockAfterRemove"`
+	WebListen             string `json:"webListen" form:"webListen"`
+	WebListenSocket       string `json:"webListenSocket" form:"webListenSocket"`
+	WebProxyProtocol      bool   `json:"webProxyProtocol" form:"webProxyProtocol"`
+	TrustedProxies        string `json:"trustedProxies" form:"trustedProxies"`
+	WebAllowedIps         string `json:"webAllowedIps" form:"webAllowedIps"`
+	ApiAllowedIps         string `json:"apiAllowedIps" form:"apiAllowedIps"`
+	WebDomain             string `json:"webDomain" form:"webDomain"`
+	WebPort               int    `json:"webPort" form:"webPort"`
+	WebCertFile           string `json:"webCertFile" form:"webCertFile"`
+	WebKeyFile            string `json:"webKeyFile" form:"webKeyFile"`
+	WebAcme               bool   `json:"webAcme" form:"webAcme"`
+	AcmeEmail             string `json:"acmeEmail" form:"acmeEmail"`
+	AcmeDirectory         string `json:"acmeDirectory" form:"acmeDirectory"`
+	AcmeChallenge         string `json:"acmeChallenge" form:"acmeChallenge"`
+	AcmeHttpPort          int    `json:"acmeHttpPort" form:"acmeHttpPort"`
+	CertExpiryWarnDays    int    `json:"certExpiryWarnDays" form:"certExpiryWarnDays"`
+	WebBasePath           string `json:"webBasePath" form:"webBasePath"`
+	SessionMaxAge         int    `json:"sessionMaxAge" form:"sessionMaxAge"`
+	PageSize              int    `json:"pageSize" form:"pageSize"`
+	ExpireDiff            int    `json:"expireDiff" form:"expireDiff"`
+	TrafficDiff           int    `json:"trafficDiff" form:"trafficDiff"`
+	RemarkModel           string `json:"remarkModel" form:"remarkModel"`
+	OutboundTestUrl       string `json:"outboundTestUrl" form:"outboundTestUrl"`
+	TgBotEnable           bool   `json:"tgBotEnable" form:"tgBotEnable"`
+	TgBotToken            string `json:"tgBotToken" form:"tgBotToken"`
+	TgBotChatId           string `json:"tgBotChatId" form:"tgBotChatId"`
+	TgRunTime             string `json:"tgRunTime" form:"tgRunTime"`
+	TgBotBackup           bool   `json:"tgBotBackup" form:"tgBotBackup"`
+	TgBotLoginNotify      bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"`
+	TgCpu                 int    `json:"tgCpu" form:"tgCpu"`
+	TgCpuPeriod           int    `json:"tgCpuPeriod" form:"tgCpuPeriod"`
+	TgLang                string `json:"tgLang" form:"tgLang"`
+	TimeLocation          string `json:"timeLocation" form:"timeLocation"`
+	SubEnable             bool   `json:"subEnable" form:"subEnable"`
+	SubListen             string `json:"subListen" form:"subListen"`
+	SubListenSocket       string `json:"subListenSocket" form:"subListenSocket"`
+	SubProxyProtocol      bool   `json:"subProxyProtocol" form:"subProxyProtocol"`
+	SubPort               int    `json:"subPort" form:"subPort"`
+	SubPath               string `json:"subPath" form:"subPath"`
+	SubDomain             string `json:"subDomain" form:"subDomain"`
+	SubCertFile           string `json:"subCertFile" form:"subCertFile"`
+	SubKeyFile            string `json:"subKeyFile" form:"subKeyFile"`
+	SubAcme               bool   `json:"subAcme" form:"subAcme"`
+	SubUpdates            int    `json:"subUpdates" form:"subUpdates"`
+	SubEncrypt            bool   `json:"subEncrypt" form:"subEncrypt"`
+	SubShowInfo           bool   `json:"subShowInfo" form:"subShowInfo"`
+	SubURI                string `json:"subURI" form:"subURI"`
+	SubJsonPath           string `json:"subJsonPath" form:"subJsonPath"`
+	SubJsonURI            string `json:"subJsonURI" form:"subJsonURI"`
+	SubJsonFragment       string `json:"subJsonFragment" form:"subJsonFragment"`
+	SubJsonNoises         string `json:"subJsonNoises" form:"subJsonNoises"`
+	SubJsonMux            string `json:"subJsonMux" form:"subJsonMux"`
+	SubJsonRules          string `json:"subJsonRules" form:"subJsonRules"`
+	IpBlockAfterRemove    bool   `json:"ipBlockAfterRemove" form:"ipBlockAfterRemove"`
+	IpLimitBackend        string `json:"ipLimitBackend" form:"ipLimitBackend"`
+	IpLimitStrategy       string `json:"ipLimitStrategy" form:"ipLimitStrategy"`
+	IpBlockDuration       int    `json:"ipBlockDuration" form:"ipBlockDuration"`
+	IpBlockMaxDuration    int    `json:"ipBlockMaxDuration" form:"ipBlockMaxDuration"`
+	HostFirewall          string `json:"hostFirewall" form:"hostFirewall"`
+	HostFirewallPorts     string `json:"hostFirewallPorts" form:"hostFirewallPorts"`
+	XrayMirrorUrl         string `json:"xrayMirrorUrl" form:"xrayMirrorUrl"`
+	GeoUpdateSources      string `json:"geoUpdateSources" form:"geoUpdateSources"`
+	GeoUpdateCron         string `json:"geoUpdateCron" form:"geoUpdateCron"`
+	MetricsEnable         bool   `json:"metricsEnable" form:"metricsEnable"`
+	MetricsListen         string `json:"metricsListen" form:"metricsListen"`
+	MetricsUser           string `json:"metricsUser" form:"metricsUser"`
+	MetricsPassword       string `json:"metricsPassword" form:"metricsPassword"`
+	MetricsToken          string `json:"metricsToken" form:"metricsToken"`
+	MetricsClients        bool   `json:"metricsClients" form:"metricsClients"`
+	ApiToken              string `json:"apiToken" form:"apiToken"`
+	ServerMetricsInterval int    `json:"serverMetricsInterval" form:"serverMetricsInterval"`
+	NotifyRoutes          string `json:"notifyRoutes" form:"notifyRoutes"`
+	NotifyWebhookUrl      string `json:"notifyWebhookUrl" form:"notifyWebhookUrl"`
+	NotifyWebhookSecret   string `json:"notifyWebhookSecret" form:"notifyWebhookSecret"`
+	NotifySmtpHost        string `json:"notifySmtpHost" form:"notifySmtpHost"`
+	NotifySmtpPort        int    `json:"notifySmtpPort" form:"notifySmtpPort"`
+	NotifySmtpUser        string `json:"notifySmtpUser" form:"notifySmtpUser"`
+	NotifySmtpPassword    string `json:"notifySmtpPassword" form:"notifySmtpPassword"`
+	NotifySmtpFrom        string `json:"notifySmtpFrom" form:"notifySmtpFrom"`
+	NotifySmtpTo          string `json:"notifySmtpTo" form:"notifySmtpTo"`
+	ClientWebhooks        string `json:"clientWebhooks" form:"clientWebhooks"`
+	AccessLogIngest       bool   `json:"accessLogIngest" form:"accessLogIngest"`
+	AccessLogRetention    int    `json:"accessLogRetention" form:"accessLogRetention"`
+	AccessLogMaxRows      int    `json:"accessLogMaxRows" form:"accessLogMaxRows"`
+	IpHistoryRetention    int    `json:"ipHistoryRetention" form:"ipHistoryRetention"`
+	SharingDetect         bool   `json:"sharingDetect" form:"sharingDetect"`
+	SharingMaxSubnets     int    `json:"sharingMaxSubnets" form:"sharingMaxSubnets"`
+	SharingMinDistance    int    `json:"sharingMinDistance" form:"sharingMinDistance"`
+	SharingAction         string `json:"sharingAction" form:"sharingAction"`
+	SharingLimitIp        int    `json:"sharingLimitIp" form:"sharingLimitIp"`
 }
 
 func (s *AllSetting) CheckValid() error {
@@ -72,6 +129,30 @@ func (s *AllSetting) CheckValid() error {
 		}
 	}
 
+	if s.WebListenSocket != "" && !filepath.IsAbs(s.WebListenSocket) {
+		return common.NewError("web listen socket is not an absolute path:", s.WebListenSocket)
+	}
+
+	if s.SubListenSocket != "" && !filepath.IsAbs(s.SubListenSocket) {
+		return common.NewError("Sub listen socket is not an absolute path:", s.SubListenSocket)
+	}
+
+	if s.WebListenSocket != "" && filepath.Clean(s.WebListenSocket) == filepath.Clean(s.SubListenSocket) {
+		return common.NewError("Sub and Web could not use same socket:", s.SubListenSocket)
+	}
+
+	if _, err := network.ParseTrustedProxies(s.TrustedProxies); err != nil {
+		return err
+	}
+
+	if _, err := network.ParseNetworks(s.WebAllowedIps); err != nil {
+		return common.NewError("panel allowed ips:", err)
+	}
+
+	if _, err := network.ParseNetworks(s.ApiAllowedIps); err != nil {
+		return common.NewError("api allowed ips:", err)
+	}
+
 	if s.WebPort <= 0 || s.WebPort > 65535 {
 		return common.NewError("web port is not a valid port:", s.WebPort)
 	}
@@ -98,6 +179,40 @@ func (s *AllSetting) CheckValid() error {
 		}
 	}
 
+	if s.WebAcme && s.WebDomain == "" {
+		return common.NewError("automatic certificates need the panel domain")
+	}
+
+	if s.SubAcme && s.SubDomain == "" {
+		return common.NewError("automatic certificates need the subscription domain")
+	}
+
+	if s.WebAcme || s.SubAcme {
+		u, err := url.Parse(s.AcmeDirectory)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.NewError("acme directory url is not valid:", s.AcmeDirectory)
+		}
+		if s.AcmeEmail != "" {
+			if _, err := mail.ParseAddress(s.AcmeEmail); err != nil {
+				return common.NewError("acme email is not valid:", s.AcmeEmail)
+			}
+		}
+	}
+
+	switch s.AcmeChallenge {
+	case "http-01", "tls-alpn-01":
+	default:
+		return common.NewError("acme challenge is not valid:", s.AcmeChallenge)
+	}
+
+	if s.AcmeHttpPort <= 0 || s.AcmeHttpPort > 65535 {
+		return common.NewError("acme http port is not a valid port:", s.AcmeHttpPort)
+	}
+
+	if s.CertExpiryWarnDays < 0 || s.CertExpiryWarnDays > 365 {
+		return common.NewError("certificate expiry warning days is not valid:", s.CertExpiryWarnDays)
+	}
+
 	if !strings.HasPrefix(s.WebBasePath, "/") {
 		s.WebBasePath = "/" + s.WebBasePath
 	}
@@ -119,6 +234,128 @@ func (s *AllSetting) CheckValid() error {
 		s.SubJsonPath += "/"
 	}
 
+	if s.XrayMirrorUrl != "" {
+		u, err := url.Parse(s.XrayMirrorUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.NewError("xray mirror url is not valid:", s.XrayMirrorUrl)
+		}
+	}
+
+	if s.ServerMetricsInterval < 0 || s.ServerMetricsInterval > 3600 {
+		return common.NewError("server metrics interval is not valid:", s.ServerMetricsInterval)
+	}
+
+	// raw server metrics are kept for 3 hours
+	if s.TgCpuPeriod < 0 || s.TgCpuPeriod > 180 {
+		return common.NewError("cpu alert period is not valid:", s.TgCpuPeriod)
+	}
+
+	if s.NotifyRoutes != "" {
+		var routes map[string][]string
+		if err := json.Unmarshal([]byte(s.NotifyRoutes), &routes); err != nil {
+			return common.NewError("notify routes is not valid json:", err)
+		}
+	}
+
+	if s.NotifyWebhookUrl != "" {
+		u, err := url.Parse(s.NotifyWebhookUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.NewError("notify webhook url is not valid:", s.NotifyWebhookUrl)
+		}
+	}
+
+	if s.NotifySmtpHost != "" && (s.NotifySmtpPort <= 0 || s.NotifySmtpPort > 65535) {
+		return common.NewError("smtp port is not a valid port:", s.NotifySmtpPort)
+	}
+
+	if s.ClientWebhooks != "" {
+		var hooks []struct {
+			Url string `json:"url"`
+		}
+		if err := json.Unmarshal([]byte(s.ClientWebhooks), &hooks); err != nil {
+			return common.NewError("client webhooks is not valid json:", err)
+		}
+		for _, hook := range hooks {
+			u, err := url.Parse(hook.Url)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return common.NewError("client webhook url is not valid:", hook.Url)
+			}
+		}
+	}
+
+	if s.AccessLogRetention < 1 || s.AccessLogRetention > 365 {
+		return common.NewError("access log retention is not valid:", s.AccessLogRetention)
+	}
+
+	if s.AccessLogMaxRows < 0 {
+		return common.NewError("access log max rows is not valid:", s.AccessLogMaxRows)
+	}
+
+	if s.IpHistoryRetention < 1 || s.IpHistoryRetention > 365 {
+		return common.NewError("ip history retention is not valid:", s.IpHistoryRetention)
+	}
+
+	if s.SharingMaxSubnets < 0 || s.SharingMinDistance < 0 {
+		return common.NewError("sharing detection threshold is not valid")
+	}
+
+	switch s.SharingAction {
+	case "none", "disable", "limit":
+	default:
+		return common.NewError("sharing action is not valid:", s.SharingAction)
+	}
+
+	if s.SharingLimitIp < 1 {
+		return common.NewError("sharing ip limit is not valid:", s.SharingLimitIp)
+	}
+
+	switch s.IpLimitBackend {
+	case "auto", "nftables", "iptables", "none":
+	default:
+		return common.NewError("ip limit backend is not valid:", s.IpLimitBackend)
+	}
+
+	switch s.IpLimitStrategy {
+	case "newest", "lru", "subnet":
+	default:
+		return common.NewError("ip limit strategy is not valid:", s.IpLimitStrategy)
+	}
+
+	if s.IpBlockDuration < 1 || s.IpBlockMaxDuration < s.IpBlockDuration {
+		return common.NewError("ip block duration is not valid")
+	}
+
+	switch s.HostFirewall {
+	case "off", "open", "deny":
+	default:
+		return common.NewError("host firewall mode is not valid:", s.HostFirewall)
+	}
+
+	if _, err := hostfw.ParsePorts(s.HostFirewallPorts); err != nil {
+		return err
+	}
+
+	if s.MetricsListen != "" {
+		if _, _, err := net.SplitHostPort(s.MetricsListen); err != nil {
+			return common.NewError("metrics listen address is not valid:", s.MetricsListen)
+		}
+	}
+
+	if s.GeoUpdateSources != "" {
+		var sources []struct {
+			Name string `json:"name"`
+			Url  string `json:"url"`
+		}
+		if err := json.Unmarshal([]byte(s.GeoUpdateSources), &sources); err != nil {
+			return common.NewError("geo update sources is not valid json:", err)
+		}
+		for _, source := range sources {
+			if source.Name == "" || source.Url == "" {
+				return common.NewError("geo update source needs a name and url")
+			}
+		}
+	}
+
 	_, err := time.LoadLocation(s.TimeLocation)
 	if err != nil {
 		return common.NewError("time location not exist:", s.TimeLocation)
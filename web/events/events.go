@@ -0,0 +1,70 @@
+// Package events is an in-process broadcast hub for the live event stream.
+// Publishers never block: a subscriber that falls behind loses events.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	Status  = "status"
+	Traffic = "traffic"
+	Online  = "online"
+	Xray    = "xray"
+	Log     = "log"
+)
+
+const subscriberBuffer = 64
+
+type Event struct {
+	Type string `json:"type"`
+	Time int64  `json:"time"`
+	Data any    `json:"data"`
+}
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[chan Event]struct{}{}
+)
+
+// Subscribe registers a new listener. The returned function has to be
+// called to unsubscribe; it closes the channel.
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers, ch)
+			mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// HasSubscribers lets publishers skip building events nobody listens to.
+func HasSubscribers() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(subscribers) > 0
+}
+
+func Publish(typ string, data any) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(subscribers) == 0 {
+		return
+	}
+	event := Event{Type: typ, Time: time.Now().UnixMilli(), Data: data}
+	for ch := range subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
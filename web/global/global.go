@@ -15,10 +15,12 @@ var (
 type WebServer interface {
 	GetCron() *cron.Cron
 	GetCtx() context.Context
+	ReloadCert() error
 }
 
 type SubServer interface {
 	GetCtx() context.Context
+	ReloadCert() error
 }
 
 func SetWebServer(s WebServer) {
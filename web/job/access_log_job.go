@@ -0,0 +1,20 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+type AccessLogJob struct {
+	accessLogService service.AccessLogService
+}
+
+func NewAccessLogJob() *AccessLogJob {
+	return new(AccessLogJob)
+}
+
+func (j *AccessLogJob) Run() {
+	if err := j.accessLogService.Ingest(); err != nil {
+		logger.Warning("ingest access log failed:", err)
+	}
+}
@@ -0,0 +1,18 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/web/service"
+)
+
+// AcmeJob renews the automatic certificates before they expire.
+type AcmeJob struct {
+	acmeService service.AcmeService
+}
+
+func NewAcmeJob() *AcmeJob {
+	return new(AcmeJob)
+}
+
+func (j *AcmeJob) Run() {
+	j.acmeService.RenewDue()
+}
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+type AlertJob struct {
+	alertService service.AlertService
+}
+
+func NewAlertJob() *AlertJob {
+	return new(AlertJob)
+}
+
+func (j *AlertJob) Run() {
+	events, err := j.alertService.Evaluate()
+	if err != nil {
+		logger.Warning("evaluate alert rules failed:", err)
+		return
+	}
+	j.alertService.NotifyEvents(events)
+}
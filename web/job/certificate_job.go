@@ -0,0 +1,19 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/web/service"
+)
+
+// CertificateJob renews the stored certificates and warns about the ones
+// close to expiry.
+type CertificateJob struct {
+	certificateService service.CertificateService
+}
+
+func NewCertificateJob() *CertificateJob {
+	return new(CertificateJob)
+}
+
+func (j *CertificateJob) Run() {
+	j.certificateService.RenewDue()
+}
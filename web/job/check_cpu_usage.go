@@ -4,14 +4,19 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/alireza0/x-ui/logger"
 	"github.com/alireza0/x-ui/web/service"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 )
 
 type CheckCpuJob struct {
-	tgbotService   service.Tgbot
-	settingService service.SettingService
+	tgbotService        service.Tgbot
+	notifyService       service.NotifyService
+	settingService      service.SettingService
+	serverMetricService service.ServerMetricService
+
+	alerted bool
 }
 
 func NewCheckCpuJob() *CheckCpuJob {
@@ -26,13 +31,42 @@ func (j *CheckCpuJob) Run() {
 		return
 	}
 
-	// get latest status of server
-	percent, err := cpu.Percent(1*time.Second, false)
-	if err == nil && percent[0] > float64(threshold) {
-		msg := j.tgbotService.I18nBot("tgbot.messages.cpuThreshold",
-			"Percent=="+strconv.FormatFloat(percent[0], 'f', 2, 64),
-			"Threshold=="+strconv.Itoa(threshold))
+	period, _ := j.settingService.GetTgCpuPeriod()
+	interval, _ := j.settingService.GetServerMetricsInterval()
+	if period <= 0 || interval <= 0 {
+		// get latest status of server
+		percent, err := cpu.Percent(1*time.Second, false)
+		if err == nil && percent[0] > float64(threshold) {
+			msg := j.tgbotService.I18nBot("tgbot.messages.cpuThreshold",
+				"Percent=="+strconv.FormatFloat(percent[0], 'f', 2, 64),
+				"Threshold=="+strconv.Itoa(threshold))
+
+			j.notifyService.Notify(service.NotifyCpu, msg)
+		}
+		return
+	}
 
-		j.tgbotService.SendMsgToTgbotAdmins(msg)
+	// alert once when the average load crosses the threshold, again only after it recovered
+	avg, ok, err := j.serverMetricService.GetCpuAverage(time.Duration(period) * time.Minute)
+	if err != nil {
+		logger.Warning("check cpu usage failed:", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if avg <= float64(threshold) {
+		j.alerted = false
+		return
 	}
+	if j.alerted {
+		return
+	}
+	j.alerted = true
+	msg := j.tgbotService.I18nBot("tgbot.messages.cpuThresholdAverage",
+		"Percent=="+strconv.FormatFloat(avg, 'f', 2, 64),
+		"Minutes=="+strconv.Itoa(period),
+		"Threshold=="+strconv.Itoa(threshold))
+
+	j.notifyService.Notify(service.NotifyCpu, msg)
 }
@@ -1,11 +1,13 @@
 package job
 
-import "github.com/alireza0/x-ui/web/service"
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
 
 type CheckXrayRunningJob struct {
-	xrayService service.XrayService
-
-	checkTime int
+	xrayService  service.XrayService
+	tgbotService service.Tgbot
 }
 
 func NewCheckXrayRunningJob() *CheckXrayRunningJob {
@@ -13,13 +15,11 @@ func NewCheckXrayRunningJob() *CheckXrayRunningJob {
 }
 
 func (j *CheckXrayRunningJob) Run() {
-	if j.xrayService.IsXrayRunning() {
-		j.checkTime = 0
-		return
+	event, err := j.xrayService.Supervise()
+	if err != nil {
+		logger.Warning("restart xray failed:", err)
 	}
-	j.checkTime++
-	if j.checkTime < 2 {
-		return
+	if event != nil {
+		j.tgbotService.SendXrayCrashAlert(event)
 	}
-	j.xrayService.SetToNeedRestart()
 }
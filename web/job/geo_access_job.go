@@ -0,0 +1,22 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+// GeoAccessJob rebuilds the country access rules when the inbounds or the
+// GeoIP files changed.
+type GeoAccessJob struct {
+	geoAccessService service.GeoAccessService
+}
+
+func NewGeoAccessJob() *GeoAccessJob {
+	return new(GeoAccessJob)
+}
+
+func (j *GeoAccessJob) Run() {
+	if err := j.geoAccessService.Apply(); err != nil {
+		logger.Warning("apply country access rules failed:", err)
+	}
+}
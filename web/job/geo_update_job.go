@@ -0,0 +1,20 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+type GeoUpdateJob struct {
+	geoService service.GeoService
+}
+
+func NewGeoUpdateJob() *GeoUpdateJob {
+	return new(GeoUpdateJob)
+}
+
+func (j *GeoUpdateJob) Run() {
+	if err := j.geoService.UpdateGeoFiles(); err != nil {
+		logger.Warning("update geo files failed:", err)
+	}
+}
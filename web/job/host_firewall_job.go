@@ -0,0 +1,22 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+// HostFirewallJob reconciles the host firewall, for inbounds disabled by
+// traffic or expiry and rules removed by other tools.
+type HostFirewallJob struct {
+	hostFirewallService service.HostFirewallService
+}
+
+func NewHostFirewallJob() *HostFirewallJob {
+	return new(HostFirewallJob)
+}
+
+func (j *HostFirewallJob) Run() {
+	if err := j.hostFirewallService.Apply(); err != nil {
+		logger.Warning("apply host firewall failed:", err)
+	}
+}
@@ -0,0 +1,22 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+// IpAccessJob lifts expired bans and keeps the firewall in sync with the
+// manual ban and allow lists.
+type IpAccessJob struct {
+	ipAccessService service.IpAccessService
+}
+
+func NewIpAccessJob() *IpAccessJob {
+	return new(IpAccessJob)
+}
+
+func (j *IpAccessJob) Run() {
+	if err := j.ipAccessService.Apply(); err != nil {
+		logger.Warning("apply ip access lists failed:", err)
+	}
+}
@@ -0,0 +1,20 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+// IpLimitStateJob saves the ip limit blocks and slots so they survive a
+// restart of the panel.
+type IpLimitStateJob struct{}
+
+func NewIpLimitStateJob() *IpLimitStateJob {
+	return new(IpLimitStateJob)
+}
+
+func (j *IpLimitStateJob) Run() {
+	if err := service.SaveIpLimitState(); err != nil {
+		logger.Warning("save iplimit state failed:", err)
+	}
+}
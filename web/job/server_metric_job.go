@@ -0,0 +1,30 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+type ServerMetricJob struct {
+	serverService       service.ServerService
+	serverMetricService service.ServerMetricService
+
+	lastStatus *service.Status
+}
+
+func NewServerMetricJob() *ServerMetricJob {
+	return new(ServerMetricJob)
+}
+
+func (j *ServerMetricJob) Run() {
+	status := j.serverService.GetStatus(j.lastStatus)
+	first := j.lastStatus == nil
+	j.lastStatus = status
+	// network speed needs a previous sample
+	if first {
+		return
+	}
+	if err := j.serverMetricService.Record(status); err != nil {
+		logger.Warning("record server metrics failed:", err)
+	}
+}
@@ -0,0 +1,36 @@
+package job
+
+import (
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/service"
+)
+
+// IpHistoryJob stores the addresses clients were online from.
+type IpHistoryJob struct {
+	sharingService service.SharingService
+}
+
+func NewIpHistoryJob() *IpHistoryJob {
+	return new(IpHistoryJob)
+}
+
+func (j *IpHistoryJob) Run() {
+	if err := j.sharingService.FlushHistory(); err != nil {
+		logger.Warning("save client ip history failed:", err)
+	}
+}
+
+// SharingJob flags clients whose history looks like a shared account.
+type SharingJob struct {
+	sharingService service.SharingService
+}
+
+func NewSharingJob() *SharingJob {
+	return new(SharingJob)
+}
+
+func (j *SharingJob) Run() {
+	if _, err := j.sharingService.Detect(); err != nil {
+		logger.Warning("detect account sharing failed:", err)
+	}
+}
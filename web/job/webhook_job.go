@@ -0,0 +1,15 @@
+package job
+
+import "github.com/alireza0/x-ui/web/service"
+
+type WebhookJob struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookJob() *WebhookJob {
+	return new(WebhookJob)
+}
+
+func (j *WebhookJob) Run() {
+	j.webhookService.ProcessDue()
+}
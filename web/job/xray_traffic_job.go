@@ -2,13 +2,16 @@ package job
 
 import (
 	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/events"
 	"github.com/alireza0/x-ui/web/service"
+	"github.com/alireza0/x-ui/xray"
 )
 
 type XrayTrafficJob struct {
 	xrayService     service.XrayService
 	inboundService  service.InboundService
 	outboundService service.OutboundService
+	alertService    service.AlertService
 }
 
 func NewXrayTrafficJob() *XrayTrafficJob {
@@ -35,4 +38,41 @@ func (j *XrayTrafficJob) Run() {
 	if needRestart {
 		j.xrayService.SetToNeedRestart()
 	}
+	j.alertService.ObserveClientTraffic(clientTraffics)
+	publishTraffic(traffics, clientTraffics)
+}
+
+// publishTraffic sends the non-zero traffic deltas of this run to the event stream.
+func publishTraffic(traffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) {
+	if !events.HasSubscribers() {
+		return
+	}
+	inbounds := make([]map[string]any, 0)
+	outbounds := make([]map[string]any, 0)
+	for _, traffic := range traffics {
+		if traffic.Up == 0 && traffic.Down == 0 {
+			continue
+		}
+		delta := map[string]any{"tag": traffic.Tag, "up": traffic.Up, "down": traffic.Down}
+		if traffic.IsInbound {
+			inbounds = append(inbounds, delta)
+		} else {
+			outbounds = append(outbounds, delta)
+		}
+	}
+	clients := make([]map[string]any, 0)
+	for _, traffic := range clientTraffics {
+		if traffic.Up == 0 && traffic.Down == 0 {
+			continue
+		}
+		clients = append(clients, map[string]any{"email": traffic.Email, "up": traffic.Up, "down": traffic.Down})
+	}
+	if len(inbounds) == 0 && len(outbounds) == 0 && len(clients) == 0 {
+		return
+	}
+	events.Publish(events.Traffic, map[string]any{
+		"inbounds":  inbounds,
+		"outbounds": outbounds,
+		"clients":   clients,
+	})
 }
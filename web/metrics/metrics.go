@@ -0,0 +1,172 @@
+// Package metrics renders panel metrics in the Prometheus text exposition
+// format and keeps timing statistics of the cron jobs.
+package metrics
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+type family struct {
+	name    string
+	typ     string
+	help    string
+	samples []sample
+}
+
+// Writer collects samples grouped by metric name, so that every family is
+// written with a single HELP and TYPE header.
+type Writer struct {
+	families []*family
+	index    map[string]*family
+}
+
+func NewWriter() *Writer {
+	return &Writer{index: map[string]*family{}}
+}
+
+// Gauge adds a gauge sample. labels are given as name, value pairs.
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.add(name, "gauge", help, value, labels)
+}
+
+// Counter adds a counter sample. labels are given as name, value pairs.
+func (w *Writer) Counter(name, help string, value float64, labels ...string) {
+	w.add(name, "counter", help, value, labels)
+}
+
+func (w *Writer) add(name, typ, help string, value float64, labels []string) {
+	f, ok := w.index[name]
+	if !ok {
+		f = &family{name: name, typ: typ, help: help}
+		w.index[name] = f
+		w.families = append(w.families, f)
+	}
+	f.samples = append(f.samples, sample{labels: formatLabels(labels), value: value})
+}
+
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, f := range w.families {
+		b.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+		b.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			b.WriteString(f.name + s.labels + " " + formatValue(s.value) + "\n")
+		}
+	}
+	n, err := io.WriteString(out, b.String())
+	return int64(n), err
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+// JobStat is the timing of one cron job.
+type JobStat struct {
+	Name         string
+	Runs         uint64
+	LastDuration time.Duration
+	TotalTime    time.Duration
+	LastRun      time.Time
+}
+
+var (
+	jobStatsMu sync.Mutex
+	jobStats   = map[string]*JobStat{}
+)
+
+// ObserveJob records one run of the named job.
+func ObserveJob(name string, start time.Time) {
+	d := time.Since(start)
+	jobStatsMu.Lock()
+	defer jobStatsMu.Unlock()
+	stat, ok := jobStats[name]
+	if !ok {
+		stat = &JobStat{Name: name}
+		jobStats[name] = stat
+	}
+	stat.Runs++
+	stat.LastDuration = d
+	stat.TotalTime += d
+	stat.LastRun = start
+}
+
+func GetJobStats() []JobStat {
+	jobStatsMu.Lock()
+	defer jobStatsMu.Unlock()
+	stats := make([]JobStat, 0, len(jobStats))
+	for _, stat := range jobStats {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+type timedJob struct {
+	name string
+	job  cron.Job
+}
+
+func (j *timedJob) Run() {
+	defer ObserveJob(j.name, time.Now())
+	j.job.Run()
+}
+
+// TimedJob wraps job so that its runs show up in the job metrics.
+func TimedJob(name string, job cron.Job) cron.Job {
+	return &timedJob{name: name, job: job}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/alireza0/x-ui/web/network"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IpAllowMiddleware answers requests from addresses outside allowed with the
+// same 404 as an unknown route. Requests under apiPath are checked against
+// apiAllowed instead when it is not empty. An empty list allows everyone.
+func IpAllowMiddleware(allowed, apiAllowed network.Networks, apiPath string, clientIp func(*http.Request) string) gin.HandlerFunc {
+	apiPath = strings.TrimSuffix(apiPath, "/")
+	return func(c *gin.Context) {
+		networks := allowed
+		path := c.Request.URL.Path
+		if len(apiAllowed) > 0 && (path == apiPath || strings.HasPrefix(path, apiPath+"/")) {
+			networks = apiAllowed
+		}
+		if len(networks) > 0 {
+			ip := net.ParseIP(clientIp(c.Request))
+			if ip == nil || !networks.Contains(ip) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alireza0/x-ui/web/network"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIpAllowMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	allowed, _ := network.ParseNetworks("10.0.0.0/8")
+	apiAllowed, _ := network.ParseNetworks("192.168.1.1")
+	clientIp := func(r *http.Request) string { return r.Header.Get("X-Test-Ip") }
+
+	engine := gin.New()
+	engine.Use(IpAllowMiddleware(allowed, apiAllowed, "/base/xui/API", clientIp))
+	engine.GET("/base/login", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	engine.GET("/base/xui/API/list", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	engine.GET("/base/xui/APIx", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	engine.NoRoute(func(c *gin.Context) { c.AbortWithStatus(http.StatusNotFound) })
+
+	serve := func(path, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Test-Ip", ip)
+		engine.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		path string
+		ip   string
+		want int
+	}{
+		{"/base/login", "10.1.2.3", http.StatusOK},
+		{"/base/login", "1.2.3.4", http.StatusNotFound},
+		{"/base/login", "", http.StatusNotFound},
+		{"/base/xui/API/list", "192.168.1.1", http.StatusOK},
+		{"/base/xui/API/list", "10.1.2.3", http.StatusNotFound},
+		{"/base/xui/APIx", "10.1.2.3", http.StatusOK},
+	}
+	for _, test := range tests {
+		if got := serve(test.path, test.ip).Code; got != test.want {
+			t.Errorf("%s from %q: got %d, want %d", test.path, test.ip, got, test.want)
+		}
+	}
+
+	denied := serve("/base/login", "1.2.3.4")
+	unknown := serve("/base/unknown", "10.1.2.3")
+	if denied.Body.String() != unknown.Body.String() || len(denied.Header()) != len(unknown.Header()) {
+		t.Errorf("denied response %v %q differs from unknown route %v %q",
+			denied.Header(), denied.Body, unknown.Header(), unknown.Body)
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/alireza0/x-ui/util/random"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIdMiddleware keeps the X-Request-Id of the client, or generates
+// one, and returns it in the response so log lines can be correlated.
+func RequestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-Id")
+		if id == "" || len(id) > 64 {
+			id = random.Seq(16)
+		}
+		c.Set("request_id", id)
+		c.Header("X-Request-Id", id)
+		c.Next()
+	}
+}
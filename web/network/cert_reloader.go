@@ -0,0 +1,107 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/logger"
+)
+
+// certCheckInterval is how often a watched pair is checked for changes.
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves a certificate pair from disk and loads it again when
+// the files change. A pair that fails to load leaves the previous one in
+// use, so a half written renewal never breaks the listener.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	signature string
+	failed    string
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the pair from disk, even if the files look unchanged.
+func (r *CertReloader) Reload() error {
+	signature, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.signature = signature
+	r.failed = ""
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch checks the files every few seconds and reloads the pair when their
+// size or modification time changes, until ctx is done.
+func (r *CertReloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		signature, err := r.stat()
+		if err != nil {
+			continue
+		}
+		r.mu.RLock()
+		changed := signature != r.signature && signature != r.failed
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			// the files may be written one after the other, retry on the
+			// next change
+			logger.Warning("reload certificate", r.certFile, "failed, keep serving the old one:", err)
+			r.mu.Lock()
+			r.failed = signature
+			r.mu.Unlock()
+			continue
+		}
+		logger.Info("certificate", r.certFile, "reloaded")
+	}
+}
+
+func (r *CertReloader) stat() (string, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return "", err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d:%d:%d", certInfo.ModTime().UnixNano(), certInfo.Size(),
+		keyInfo.ModTime().UnixNano(), keyInfo.Size()), nil
+}
@@ -0,0 +1,50 @@
+package network
+
+import (
+	"net"
+	"strings"
+
+	"github.com/alireza0/x-ui/util/common"
+)
+
+// Networks is a list of addresses and networks in CIDR notation.
+type Networks []*net.IPNet
+
+// ParseNetworks parses a comma separated list of addresses and networks in
+// CIDR notation. A single address is taken as a network of its own.
+func ParseNetworks(value string) (Networks, error) {
+	networks := make(Networks, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(strings.Trim(item, "[]"))
+			if ip == nil {
+				return nil, common.NewError("not a valid ip:", item)
+			}
+			bits := 8 * net.IPv6len
+			if v4 := ip.To4(); v4 != nil {
+				ip, bits = v4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, common.NewError("not a valid cidr:", item)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (n Networks) Contains(ip net.IP) bool {
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
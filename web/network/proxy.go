@@ -0,0 +1,139 @@
+package network
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alireza0/x-ui/util/common"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// proxyHeaderTimeout bounds how long a connection may take to send its
+// PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// TrustedProxyUnix is the trusted proxy entry that trusts the peers of a
+// unix socket.
+const TrustedProxyUnix = "unix"
+
+// TrustedProxies are the peers whose forwarded client addresses are
+// believed, both in PROXY protocol headers and in X-Forwarded-For. Peers on
+// a unix socket can be any local user, they are only trusted with Unix.
+type TrustedProxies struct {
+	Networks Networks
+	Unix     bool
+}
+
+// ParseTrustedProxies parses a comma separated list of addresses, networks
+// and the "unix" entry.
+func ParseTrustedProxies(value string) (TrustedProxies, error) {
+	var trusted TrustedProxies
+	items := strings.Split(value, ",")
+	networks := make([]string, 0, len(items))
+	for _, item := range items {
+		if strings.EqualFold(strings.TrimSpace(item), TrustedProxyUnix) {
+			trusted.Unix = true
+		} else {
+			networks = append(networks, item)
+		}
+	}
+	var err error
+	trusted.Networks, err = ParseNetworks(strings.Join(networks, ","))
+	if err != nil {
+		return TrustedProxies{}, common.NewError("trusted proxies:", err)
+	}
+	return trusted, nil
+}
+
+func (t TrustedProxies) Contains(ip net.IP) bool {
+	return t.Networks.Contains(ip)
+}
+
+// Trusts reports whether the peer at addr may forward client addresses.
+func (t TrustedProxies) Trusts(addr net.Addr) bool {
+	switch addr := addr.(type) {
+	case *net.UnixAddr:
+		return t.Unix
+	case *net.TCPAddr:
+		return t.Contains(addr.IP)
+	}
+	return false
+}
+
+// ClientIP returns the address of the client behind r. Forwarding headers
+// are only read when the peer is trusted, and X-Forwarded-For is walked from
+// the right so a client can not prepend a forged address.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !t.Contains(ip) {
+			return host
+		}
+	} else if !t.Unix {
+		// a request over a unix socket has no remote address
+		return host
+	}
+	if value := r.Header.Get("X-Forwarded-For"); value != "" {
+		ips := strings.Split(value, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(ips[i]))
+			if ip == nil {
+				break
+			}
+			if i == 0 || !t.Contains(ip) {
+				return ip.String()
+			}
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// NewProxyProtocolListener accepts PROXY protocol v1 and v2 headers from
+// trusted peers. The header is optional, so direct connections keep working,
+// and connections from other peers that send one are refused.
+func NewProxyProtocolListener(listener net.Listener, trusted TrustedProxies) net.Listener {
+	return &proxyproto.Listener{
+		Listener: listener,
+		ConnPolicy: func(options proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+			if trusted.Trusts(options.Upstream) {
+				return proxyproto.USE, nil
+			}
+			return proxyproto.REJECT, nil
+		},
+		ReadHeaderTimeout: proxyHeaderTimeout,
+	}
+}
+
+// ListenUnix listens on the unix socket at path, replacing a socket left
+// behind by a previous run.
+func ListenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, common.NewError("listen socket path exists and is not a socket:", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// a reverse proxy usually runs as another user, the addresses it
+	// forwards are only believed with the "unix" trusted proxy entry
+	if err := os.Chmod(path, 0o666); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,135 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := ParseTrustedProxies(" 127.0.0.1, ::1,10.0.0.0/8 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"127.0.0.1", "::1", "10.1.2.3"} {
+		if !trusted.Contains(net.ParseIP(ip)) {
+			t.Errorf("%s is not trusted", ip)
+		}
+	}
+	if trusted.Contains(net.ParseIP("127.0.0.2")) {
+		t.Error("127.0.0.2 is trusted")
+	}
+	unix := &net.UnixAddr{Name: "@", Net: "unix"}
+	if trusted.Trusts(unix) {
+		t.Error("unix socket peers are trusted without the unix entry")
+	}
+	if trusted, err := ParseTrustedProxies("127.0.0.1, UNIX"); err != nil || !trusted.Trusts(unix) || len(trusted.Networks) != 1 {
+		t.Errorf("unix entry: got %+v %v", trusted, err)
+	}
+	for _, value := range []string{"localhost", "10.0.0.0/33"} {
+		if _, err := ParseTrustedProxies(value); err == nil {
+			t.Errorf("%q was accepted", value)
+		}
+	}
+}
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	trusted, _ := ParseTrustedProxies("127.0.0.1,10.0.0.0/8")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIp     string
+		want       string
+	}{
+		{"direct", "1.2.3.4:5000", "", "", "1.2.3.4"},
+		{"untrusted peer", "1.2.3.4:5000", "5.6.7.8", "5.6.7.8", "1.2.3.4"},
+		{"trusted peer", "127.0.0.1:5000", "5.6.7.8", "", "5.6.7.8"},
+		{"forged entry", "127.0.0.1:5000", "9.9.9.9, 5.6.7.8", "", "5.6.7.8"},
+		{"proxy chain", "127.0.0.1:5000", "5.6.7.8, 10.0.0.2", "", "5.6.7.8"},
+		{"all trusted", "127.0.0.1:5000", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"real ip", "127.0.0.1:5000", "", "5.6.7.8", "5.6.7.8"},
+		{"unix socket", "@", "5.6.7.8", "", "@"},
+		{"no header", "127.0.0.1:5000", "", "", "127.0.0.1"},
+	}
+	for _, test := range tests {
+		r := &http.Request{RemoteAddr: test.remoteAddr, Header: http.Header{}}
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if test.realIp != "" {
+			r.Header.Set("X-Real-IP", test.realIp)
+		}
+		if got := trusted.ClientIP(r); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	trusted, _ = ParseTrustedProxies("unix")
+	r := &http.Request{RemoteAddr: "@", Header: http.Header{"X-Forwarded-For": {"5.6.7.8"}}}
+	if got := trusted.ClientIP(r); got != "5.6.7.8" {
+		t.Errorf("trusted unix socket: got %q", got)
+	}
+}
+
+// acceptOne dials listener, writes data and returns what the accepted
+// connection reports as its peer along with the bytes it read.
+func acceptOne(t *testing.T, listener net.Listener, data []byte) (net.Addr, []byte, error) {
+	t.Helper()
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write(data)
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	body, err := io.ReadAll(conn)
+	return conn.RemoteAddr(), body, err
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 4000}
+	server := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 443}
+	var v1, v2 bytes.Buffer
+	proxyproto.HeaderProxyFromAddrs(1, client, server).WriteTo(&v1)
+	proxyproto.HeaderProxyFromAddrs(2, client, server).WriteTo(&v2)
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, _ := ParseTrustedProxies("127.0.0.1")
+	listener := NewProxyProtocolListener(inner, trusted)
+	defer listener.Close()
+
+	for name, header := range map[string][]byte{"v1": v1.Bytes(), "v2": v2.Bytes()} {
+		addr, body, err := acceptOne(t, listener, append(header, "GET /"...))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if addr.String() != client.String() || string(body) != "GET /" {
+			t.Errorf("%s: got %s %q", name, addr, body)
+		}
+	}
+
+	// the header is optional for trusted peers
+	addr, body, err := acceptOne(t, listener, []byte("GET /"))
+	if err != nil || string(body) != "GET /" || addr.(*net.TCPAddr).IP.String() != "127.0.0.1" {
+		t.Errorf("direct: got %s %q %v", addr, body, err)
+	}
+
+	untrusted := NewProxyProtocolListener(inner, TrustedProxies{})
+	if _, _, err := acceptOne(t, untrusted, append(v1.Bytes(), "GET /"...)); err == nil {
+		t.Error("header from an untrusted peer was accepted")
+	}
+}
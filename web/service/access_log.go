@@ -0,0 +1,320 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/xray"
+)
+
+const (
+	AccessAccepted = "accepted"
+	AccessRejected = "rejected"
+)
+
+// accessLogRegex matches lines like
+//
+//	2024/01/02 15:04:05.123456 from tcp:1.2.3.4:5678 accepted tcp:example.com:443 [in >> out] email: a@b
+var accessLogRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})(?:\.\d+)? from (?:(?:tcp|udp):)?(\S+) (accepted|rejected) (.*)$`)
+
+var accessRouteRegex = regexp.MustCompile(`\s\[([^\[\]]*)\]$`)
+
+// parseAccessLine parses one access log line, ok is false for other lines
+// such as DNS queries.
+func parseAccessLine(line string) (entry *model.AccessLog, ok bool) {
+	matches := accessLogRegex.FindStringSubmatch(strings.TrimSpace(line))
+	if matches == nil {
+		return nil, false
+	}
+	t, err := time.ParseInLocation("2006/01/02 15:04:05", matches[1], time.Local)
+	if err != nil {
+		return nil, false
+	}
+	entry = &model.AccessLog{
+		Time:   t.Unix(),
+		Status: matches[3],
+	}
+	if host, _, err := net.SplitHostPort(matches[2]); err == nil {
+		entry.Source = host
+	} else {
+		entry.Source = matches[2]
+	}
+
+	rest := matches[4]
+	if idx := strings.LastIndex(rest, " email: "); idx >= 0 {
+		entry.Email = strings.TrimSpace(rest[idx+len(" email: "):])
+		rest = rest[:idx]
+	}
+	rest = strings.TrimSpace(rest)
+	if route := accessRouteRegex.FindStringSubmatch(rest); route != nil {
+		tags := strings.NewReplacer("->", "\x00", ">>", "\x00").Replace(route[1])
+		inbound, outbound, _ := strings.Cut(tags, "\x00")
+		entry.InboundTag = strings.TrimSpace(inbound)
+		entry.OutboundTag = strings.TrimSpace(outbound)
+		rest = rest[:len(rest)-len(route[0])]
+	}
+	rest = strings.TrimSpace(rest)
+
+	if entry.Status == AccessRejected {
+		entry.Reason = rest
+		return entry, true
+	}
+	target := rest
+	if network, addr, found := strings.Cut(rest, ":"); found && (network == "tcp" || network == "udp") {
+		entry.Network = network
+		target = addr
+	}
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		entry.Destination = strings.ToLower(host)
+		entry.Port, _ = strconv.Atoi(port)
+	} else {
+		entry.Destination = strings.ToLower(target)
+	}
+	return entry, true
+}
+
+// accessLogTail remembers how far the access log has been read.
+var accessLogTail struct {
+	sync.Mutex
+	path      string
+	offset    int64
+	info      os.FileInfo
+	lastPrune time.Time
+}
+
+type AccessLogService struct {
+	settingService SettingService
+}
+
+// GetAccessLogPath returns the access log of the xray template, or "" if
+// the template does not write one.
+func (s *AccessLogService) GetAccessLogPath() (string, error) {
+	template, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return "", err
+	}
+	xrayConfig := &xray.Config{}
+	if err := json.Unmarshal([]byte(template), xrayConfig); err != nil {
+		return "", err
+	}
+	if len(xrayConfig.LogConfig) == 0 {
+		return "", nil
+	}
+	var logConfig struct {
+		Access string `json:"access"`
+	}
+	if err := json.Unmarshal(xrayConfig.LogConfig, &logConfig); err != nil {
+		return "", err
+	}
+	if logConfig.Access == "" || logConfig.Access == "none" {
+		return "", nil
+	}
+	path, _ := sanitizeLogPath(logConfig.Access)
+	return path, nil
+}
+
+// Ingest reads the lines appended to the access log since the last call
+// and stores them. The first call after start skips the existing content.
+// A truncated or replaced file is read from the beginning.
+func (s *AccessLogService) Ingest() error {
+	enabled, err := s.settingService.GetAccessLogIngest()
+	if err != nil || !enabled {
+		return err
+	}
+	path, err := s.GetAccessLogPath()
+	if err != nil || path == "" {
+		return err
+	}
+
+	accessLogTail.Lock()
+	defer accessLogTail.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if accessLogTail.path != path || accessLogTail.info == nil {
+		accessLogTail.path = path
+		accessLogTail.info = info
+		accessLogTail.offset = info.Size()
+		return nil
+	}
+	if !os.SameFile(accessLogTail.info, info) || info.Size() < accessLogTail.offset {
+		accessLogTail.offset = 0
+	}
+	accessLogTail.info = info
+
+	if info.Size() > accessLogTail.offset {
+		if err := s.readFrom(path); err != nil {
+			return err
+		}
+	}
+
+	if time.Since(accessLogTail.lastPrune) > time.Hour {
+		accessLogTail.lastPrune = time.Now()
+		return s.prune()
+	}
+	return nil
+}
+
+func (s *AccessLogService) readFrom(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(accessLogTail.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	reader := bufio.NewReaderSize(file, 64*1024)
+	batch := make([]*model.AccessLog, 0, 500)
+	// the offset only moves past lines that are stored, so a failed insert
+	// is retried on the next run
+	read := accessLogTail.offset
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := db.Create(batch).Error; err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		accessLogTail.offset = read
+		return nil
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// keep a partial last line for the next run
+			break
+		}
+		read += int64(len(line))
+		if entry, ok := parseAccessLine(line); ok {
+			batch = append(batch, entry)
+			if len(batch) == cap(batch) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return flush()
+}
+
+// prune removes entries older than the retention and the oldest entries
+// beyond the row limit.
+func (s *AccessLogService) prune() error {
+	retention, err := s.settingService.GetAccessLogRetention()
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	since := time.Now().AddDate(0, 0, -retention).Unix()
+	if err := db.Where("time < ?", since).Delete(&model.AccessLog{}).Error; err != nil {
+		return err
+	}
+	maxRows, err := s.settingService.GetAccessLogMaxRows()
+	if err != nil || maxRows <= 0 {
+		return err
+	}
+	return db.Where("id <= (SELECT MAX(id) FROM access_logs) - ?", maxRows).
+		Delete(&model.AccessLog{}).Error
+}
+
+// AccessLogQuery filters Search. Destination matches the domain and its
+// subdomains, Ip matches the source or destination address. From and To
+// are unix seconds.
+type AccessLogQuery struct {
+	Email       string `json:"email" form:"email"`
+	Destination string `json:"destination" form:"destination"`
+	Ip          string `json:"ip" form:"ip"`
+	Status      string `json:"status" form:"status"`
+	From        int64  `json:"from" form:"from"`
+	To          int64  `json:"to" form:"to"`
+	Limit       int    `json:"limit" form:"limit"`
+}
+
+func (s *AccessLogService) Search(query *AccessLogQuery) ([]*model.AccessLog, error) {
+	db := database.GetDB().Model(model.AccessLog{})
+	if query.Email != "" {
+		db = db.Where("email = ?", query.Email)
+	}
+	if query.Destination != "" {
+		destination := strings.ToLower(strings.TrimPrefix(query.Destination, "."))
+		db = db.Where(`destination = ? OR destination LIKE ? ESCAPE '\'`, destination, "%."+escapeLike(destination))
+	}
+	if query.Ip != "" {
+		if net.ParseIP(query.Ip) == nil {
+			return nil, common.NewError("invalid ip:", query.Ip)
+		}
+		db = db.Where("source = ? OR destination = ?", query.Ip, query.Ip)
+	}
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.From > 0 {
+		db = db.Where("time >= ?", query.From)
+	}
+	if query.To > 0 {
+		db = db.Where("time <= ?", query.To)
+	}
+	limit := query.Limit
+	if limit <= 0 || limit > 10000 {
+		limit = 500
+	}
+	logs := make([]*model.AccessLog, 0)
+	err := db.Order("time desc, id desc").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with \ as the escape
+// character.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+type AccessDestination struct {
+	Destination string `json:"destination"`
+	Count       int64  `json:"count"`
+	LastSeen    int64  `json:"lastSeen"`
+}
+
+// GetTopDestinations returns the destinations email connected to most
+// often since the given unix time.
+func (s *AccessLogService) GetTopDestinations(email string, since int64, limit int) ([]*AccessDestination, error) {
+	if email == "" {
+		return nil, common.NewError("email is required")
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 20
+	}
+	destinations := make([]*AccessDestination, 0)
+	err := database.GetDB().Model(model.AccessLog{}).
+		Select("destination, COUNT(*) AS count, MAX(time) AS last_seen").
+		Where("email = ? AND time >= ? AND status = ?", email, since, AccessAccepted).
+		Group("destination").
+		Order("count desc, last_seen desc").
+		Limit(limit).
+		Scan(&destinations).Error
+	return destinations, err
+}
+
+// Clear removes all ingested entries.
+func (s *AccessLogService) Clear() error {
+	return database.GetDB().Where("1 = 1").Delete(&model.AccessLog{}).Error
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+)
+
+// initTestDB opens a fresh database in a temporary directory.
+func initTestDB(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XUI_DB_FOLDER", dir)
+	if err := database.InitDB(filepath.Join(dir, "x-ui.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseDB() })
+}
+
+func TestParseAccessLine(t *testing.T) {
+	stamp, _ := time.ParseInLocation("2006/01/02 15:04:05", "2024/01/02 15:04:05", time.Local)
+	tests := []struct {
+		line string
+		want *model.AccessLog
+	}{
+		{
+			"2024/01/02 15:04:05.123456 from tcp:1.2.3.4:5678 accepted tcp:Example.com:443 [in-vless >> direct] email: a@b\n",
+			&model.AccessLog{Source: "1.2.3.4", Status: AccessAccepted, Network: "tcp", Destination: "example.com", Port: 443,
+				InboundTag: "in-vless", OutboundTag: "direct", Email: "a@b"},
+		},
+		{
+			"2024/01/02 15:04:05 from [2001:db8::1]:5678 accepted udp:[2001:db8::2]:53 [in -> out]",
+			&model.AccessLog{Source: "2001:db8::1", Status: AccessAccepted, Network: "udp", Destination: "2001:db8::2", Port: 53,
+				InboundTag: "in", OutboundTag: "out"},
+		},
+		{
+			"2024/01/02 15:04:05 from 1.2.3.4:5678 accepted example.com",
+			&model.AccessLog{Source: "1.2.3.4", Status: AccessAccepted, Destination: "example.com"},
+		},
+		{
+			"2024/01/02 15:04:05 from tcp:1.2.3.4:5678 rejected  blocked by rule [in >> block] email: c@d",
+			&model.AccessLog{Source: "1.2.3.4", Status: AccessRejected, Reason: "blocked by rule",
+				InboundTag: "in", OutboundTag: "block", Email: "c@d"},
+		},
+		{"2024/01/02 15:04:05 127.0.0.1 got answer: example.com -> [1.2.3.4]", nil},
+		{"2024/01/02 15:04:05 from tcp:1.2.3.4:5678 proxied tcp:example.com:443", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		got, ok := parseAccessLine(test.line)
+		if test.want == nil {
+			if ok {
+				t.Errorf("%q parsed as %+v", test.line, got)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%q was not parsed", test.line)
+			continue
+		}
+		test.want.Time = stamp.Unix()
+		if *got != *test.want {
+			t.Errorf("%q:\ngot  %+v\nwant %+v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestAccessLogSearchDestination(t *testing.T) {
+	initTestDB(t)
+	for _, destination := range []string{"example.com", "www.example.com", "wwwxexample.com", "a_b.com", "x.a_b.com", "x.axb.com"} {
+		if err := database.GetDB().Create(&model.AccessLog{Destination: destination, Status: AccessAccepted}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := AccessLogService{}
+	tests := map[string]int{
+		"example.com":  2,
+		".example.com": 2,
+		"a_b.com":      2,
+		"%":            0,
+		"_.com":        0,
+	}
+	for destination, want := range tests {
+		logs, err := s.Search(&AccessLogQuery{Destination: destination})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != want {
+			t.Errorf("%q matched %d entries, want %d", destination, len(logs), want)
+		}
+	}
+}
+
+func TestAccessLogReadFromKeepsOffsetOnError(t *testing.T) {
+	initTestDB(t)
+	path := filepath.Join(t.TempDir(), "access.log")
+	content := "2024/01/02 15:04:05 from tcp:1.2.3.4:5678 accepted tcp:example.com:443\n" +
+		"2024/01/02 15:04:06 from tcp:1.2.3.4:5679 accepted tcp:example.org:443\n"
+	if err := os.WriteFile(path, []byte(content+"2024/01/02 15:04:07 partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	accessLogTail.Lock()
+	defer accessLogTail.Unlock()
+	defer func(offset int64) { accessLogTail.offset = offset }(accessLogTail.offset)
+	accessLogTail.offset = 0
+
+	s := AccessLogService{}
+	db := database.GetDB()
+	if err := db.Migrator().DropTable(&model.AccessLog{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.readFrom(path); err == nil {
+		t.Fatal("a failed insert returned no error")
+	}
+	if accessLogTail.offset != 0 {
+		t.Errorf("offset moved to %d after a failed insert", accessLogTail.offset)
+	}
+
+	if err := db.AutoMigrate(&model.AccessLog{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.readFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	if accessLogTail.offset != int64(len(content)) {
+		t.Errorf("offset is %d, want %d", accessLogTail.offset, len(content))
+	}
+	var count int64
+	db.Model(&model.AccessLog{}).Count(&count)
+	if count != 2 {
+		t.Errorf("stored %d entries, want 2", count)
+	}
+}
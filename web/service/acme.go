@@ -0,0 +1,430 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/config"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/web/locale"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	AcmeHttp01    = "http-01"
+	AcmeTlsAlpn01 = "tls-alpn-01"
+
+	acmeRenewBefore = 30 * 24 * time.Hour
+	acmeTimeout     = 5 * time.Minute
+)
+
+// acmeState holds the pending challenges and the issued certificates shared
+// by the panel and subscription listeners.
+var acmeState = struct {
+	sync.RWMutex
+	tokens    map[string]string
+	alpnCerts map[string]*tls.Certificate
+	certs     map[string]*tls.Certificate
+}{
+	tokens:    make(map[string]string),
+	alpnCerts: make(map[string]*tls.Certificate),
+	certs:     make(map[string]*tls.Certificate),
+}
+
+// acmeMu serializes orders so that a domain is never ordered twice at once.
+var acmeMu sync.Mutex
+
+func acmeDir() string {
+	return filepath.Join(config.GetDBFolderPath(), "acme")
+}
+
+func acmeCertPaths(domain string) (string, string) {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(domain))
+	return filepath.Join(acmeDir(), name+".crt"), filepath.Join(acmeDir(), name+".key")
+}
+
+// acmeCertificate returns the issued certificate of domain, or nil if there
+// is none yet.
+func acmeCertificate(domain string) *tls.Certificate {
+	acmeState.RLock()
+	cert, ok := acmeState.certs[domain]
+	acmeState.RUnlock()
+	if ok {
+		return cert
+	}
+
+	certFile, keyFile := acmeCertPaths(domain)
+	loaded, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		cert = &loaded
+	} else if !os.IsNotExist(err) {
+		logger.Warning("load acme certificate of", domain, "failed:", err)
+	}
+	acmeState.Lock()
+	acmeState.certs[domain] = cert
+	acmeState.Unlock()
+	return cert
+}
+
+// AcmeTLSConfig returns a server config that serves the issued certificate
+// of domain and answers tls-alpn-01 challenges. Until a certificate has
+// been issued, fallback is used if it is not nil. Renewed certificates are
+// picked up without a restart.
+func AcmeTLSConfig(domain string, fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	domain = strings.ToLower(domain)
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert := acmeCertificate(domain); cert != nil {
+				return cert, nil
+			}
+			if fallback != nil {
+				return fallback(hello)
+			}
+			return nil, common.NewError("no certificate has been issued for", domain)
+		},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if !slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+				return nil, nil
+			}
+			acmeState.RLock()
+			cert := acmeState.alpnCerts[strings.ToLower(hello.ServerName)]
+			acmeState.RUnlock()
+			if cert == nil {
+				return nil, common.NewError("no pending tls-alpn-01 challenge for", hello.ServerName)
+			}
+			return &tls.Config{
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{acme.ALPNProto},
+			}, nil
+		},
+	}
+}
+
+// ServeAcmeChallenge answers http-01 challenges. It must be reachable at
+// /.well-known/acme-challenge/ on port 80 of the domain.
+func ServeAcmeChallenge(w http.ResponseWriter, r *http.Request) {
+	acmeState.RLock()
+	keyAuth, ok := acmeState.tokens[r.URL.Path]
+	acmeState.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
+
+// RefreshAcme orders the missing and expiring certificates in the
+// background.
+func RefreshAcme() {
+	go func() {
+		var acmeService AcmeService
+		acmeService.RenewDue()
+	}()
+}
+
+type AcmeService struct {
+	settingService SettingService
+	notifyService  NotifyService
+}
+
+// GetDomains returns the domains whose certificate is issued by the ACME CA.
+func (s *AcmeService) GetDomains() []string {
+	domains := make([]string, 0, 2)
+	if enabled, _ := s.settingService.GetWebAcme(); enabled {
+		if domain, _ := s.settingService.GetWebDomain(); domain != "" {
+			domains = append(domains, strings.ToLower(domain))
+		}
+	}
+	subEnable, _ := s.settingService.GetSubEnable()
+	if enabled, _ := s.settingService.GetSubAcme(); enabled && subEnable {
+		if domain, _ := s.settingService.GetSubDomain(); domain != "" && !slices.Contains(domains, strings.ToLower(domain)) {
+			domains = append(domains, strings.ToLower(domain))
+		}
+	}
+	return domains
+}
+
+// RenewDue orders a certificate for every domain that has none or whose
+// certificate expires within 30 days. Failures are logged and notified.
+func (s *AcmeService) RenewDue() {
+	for _, domain := range s.GetDomains() {
+		cert := acmeCertificate(domain)
+		if cert != nil && cert.Leaf != nil && time.Until(cert.Leaf.NotAfter) > acmeRenewBefore {
+			continue
+		}
+		if err := s.Obtain(domain); err != nil {
+			logger.Warning("obtain certificate for", domain, "failed:", err)
+			s.notifyService.Notify(NotifyCert, locale.I18n(locale.Bot, "tgbot.messages.certRenewFailed",
+				"Domain=="+domain, "Error=="+html.EscapeString(err.Error())))
+		}
+	}
+}
+
+// Obtain orders a certificate for domain, stores it in the acme folder next
+// to the database and makes the listeners serve it.
+func (s *AcmeService) Obtain(domain string) error {
+	chain, key, err := s.Order([]string{domain})
+	if err != nil {
+		return err
+	}
+	cert, err := saveAcmeCertificate(domain, chain, key)
+	if err != nil {
+		return err
+	}
+	acmeState.Lock()
+	acmeState.certs[domain] = cert
+	acmeState.Unlock()
+	logger.Info("certificate for", domain, "issued, valid until", cert.Leaf.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+// Order has the ACME CA issue a certificate for domains and returns the
+// DER chain, leaf first, with its new key.
+func (s *AcmeService) Order(domains []string) ([][]byte, *ecdsa.PrivateKey, error) {
+	acmeMu.Lock()
+	defer acmeMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), acmeTimeout)
+	defer cancel()
+
+	client, err := s.client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	challengeType, err := s.settingService.GetAcmeChallenge()
+	if err != nil {
+		return nil, nil, err
+	}
+	if challengeType == AcmeHttp01 {
+		stop := s.serveHttpChallenges()
+		defer stop()
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := client.GetAuthorization(ctx, authzURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+		var challenge *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == challengeType {
+				challenge = c
+				break
+			}
+		}
+		if challenge == nil {
+			return nil, nil, common.NewErrorf("acme server offers no %s challenge for %s", challengeType, authz.Identifier.Value)
+		}
+
+		cleanup, err := s.prepareChallenge(client, challenge, strings.ToLower(authz.Identifier.Value))
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = client.Accept(ctx, challenge)
+		if err == nil {
+			_, err = client.WaitAuthorization(ctx, authz.URI)
+		}
+		cleanup()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chain, key, nil
+}
+
+// client returns an ACME client with a registered account. The account key
+// is created on first use.
+func (s *AcmeService) client(ctx context.Context) (*acme.Client, error) {
+	directory, err := s.settingService.GetAcmeDirectory()
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadAcmeAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: directory, UserAgent: "x-ui"}
+
+	account := &acme.Account{}
+	if email, _ := s.settingService.GetAcmeEmail(); email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	_, err = client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, err
+	}
+	return client, nil
+}
+
+// prepareChallenge publishes the response to challenge and returns a func
+// that withdraws it.
+func (s *AcmeService) prepareChallenge(client *acme.Client, challenge *acme.Challenge, domain string) (func(), error) {
+	switch challenge.Type {
+	case AcmeHttp01:
+		keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return nil, err
+		}
+		path := client.HTTP01ChallengePath(challenge.Token)
+		acmeState.Lock()
+		acmeState.tokens[path] = keyAuth
+		acmeState.Unlock()
+		return func() {
+			acmeState.Lock()
+			delete(acmeState.tokens, path)
+			acmeState.Unlock()
+		}, nil
+	case AcmeTlsAlpn01:
+		cert, err := client.TLSALPN01ChallengeCert(challenge.Token, domain)
+		if err != nil {
+			return nil, err
+		}
+		acmeState.Lock()
+		acmeState.alpnCerts[domain] = &cert
+		acmeState.Unlock()
+		return func() {
+			acmeState.Lock()
+			delete(acmeState.alpnCerts, domain)
+			acmeState.Unlock()
+		}, nil
+	}
+	return nil, common.NewError("unsupported acme challenge:", challenge.Type)
+}
+
+// serveHttpChallenges answers http-01 challenges on the acme http port for
+// the duration of an order. If the port is taken, the challenges can still
+// be answered by the panel or subscription server listening on it.
+func (s *AcmeService) serveHttpChallenges() func() {
+	port, err := s.settingService.GetAcmeHttpPort()
+	if err != nil {
+		return func() {}
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		logger.Debug("acme http challenge listener not started:", err)
+		return func() {}
+	}
+	server := &http.Server{
+		Handler:           http.HandlerFunc(ServeAcmeChallenge),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+	return func() {
+		server.Close()
+	}
+}
+
+func loadAcmeAccountKey() (crypto.Signer, error) {
+	path := filepath.Join(acmeDir(), "account.key")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, common.NewError("invalid acme account key:", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAcmeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func saveAcmeCertificate(domain string, chain [][]byte, key *ecdsa.PrivateKey) (*tls.Certificate, error) {
+	certPem, keyPem, err := encodeCertificate(chain, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, err
+	}
+	certFile, keyFile := acmeCertPaths(domain)
+	if err := writeAcmeFile(keyFile, keyPem); err != nil {
+		return nil, err
+	}
+	if err := writeAcmeFile(certFile, certPem); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func writeAcmeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
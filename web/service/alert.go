@@ -0,0 +1,526 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"html"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/web/locale"
+	"github.com/alireza0/x-ui/xray"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+)
+
+const (
+	AlertCpu           = "cpu"
+	AlertMem           = "mem"
+	AlertDisk          = "disk"
+	AlertSwap          = "swap"
+	AlertLoad          = "load"
+	AlertXrayStopped   = "xray_stopped"
+	AlertXrayRestarts  = "xray_restarts"
+	AlertOutboundTest  = "outbound_test"
+	AlertCertExpiry    = "cert_expiry"
+	AlertClientTraffic = "client_traffic"
+	AlertLoginFailures = "login_failures"
+)
+
+const (
+	AlertStateOk       = "ok"
+	AlertStatePending  = "pending"
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// alertTypes lists the known rule types. Rules fire when the value is above
+// the threshold, or below it for types marked as below.
+var alertTypes = map[string]struct{ below bool }{
+	AlertCpu:           {},
+	AlertMem:           {},
+	AlertDisk:          {},
+	AlertSwap:          {},
+	AlertLoad:          {},
+	AlertXrayStopped:   {},
+	AlertXrayRestarts:  {},
+	AlertOutboundTest:  {},
+	AlertCertExpiry:    {below: true},
+	AlertClientTraffic: {},
+	AlertLoginFailures: {},
+}
+
+const maxAlertEvents = 1000
+
+// Counters for the rate based rule types, fed by the traffic job and login.
+var (
+	alertLock          sync.Mutex
+	loginFailures      []time.Time
+	clientTrafficTrail []clientTrafficSample
+)
+
+type clientTrafficSample struct {
+	time  time.Time
+	bytes map[string]int64
+}
+
+func recordLoginFailure() {
+	alertLock.Lock()
+	defer alertLock.Unlock()
+	loginFailures = append(pruneTimes(loginFailures, time.Minute), time.Now())
+}
+
+func pruneTimes(times []time.Time, window time.Duration) []time.Time {
+	since := time.Now().Add(-window)
+	i := 0
+	for i < len(times) && times[i].Before(since) {
+		i++
+	}
+	return times[i:]
+}
+
+type AlertService struct {
+	settingService     SettingService
+	xrayService        XrayService
+	inboundService     InboundService
+	outboundService    OutboundService
+	certificateService CertificateService
+	notifyService      NotifyService
+}
+
+func (s *AlertService) GetRules() ([]*model.AlertRule, error) {
+	db := database.GetDB()
+	rules := make([]*model.AlertRule, 0)
+	err := db.Model(model.AlertRule{}).Find(&rules).Error
+	return rules, err
+}
+
+func (s *AlertService) checkRule(rule *model.AlertRule) error {
+	if _, ok := alertTypes[rule.Type]; !ok {
+		return common.NewError("unknown alert type:", rule.Type)
+	}
+	if rule.Duration < 0 || rule.Cooldown < 0 {
+		return common.NewError("alert duration and cooldown can not be negative")
+	}
+	if rule.Type == AlertOutboundTest && rule.Target == "" {
+		return common.NewError("outbound test alert needs an outbound tag")
+	}
+	if rule.Name == "" {
+		rule.Name = rule.Type
+	}
+	return nil
+}
+
+func (s *AlertService) AddRule(rule *model.AlertRule) error {
+	if err := s.checkRule(rule); err != nil {
+		return err
+	}
+	rule.Id = 0
+	rule.State = AlertStateOk
+	rule.Value = 0
+	rule.PendingSince = 0
+	rule.LastNotify = 0
+	return database.GetDB().Create(rule).Error
+}
+
+// UpdateRule saves the configuration of a rule. A rule whose condition
+// changed starts its evaluation over, and an incident it was firing is
+// resolved first.
+func (s *AlertService) UpdateRule(rule *model.AlertRule) error {
+	if err := s.checkRule(rule); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	old := &model.AlertRule{}
+	if err := db.First(old, rule.Id).Error; err != nil {
+		return err
+	}
+
+	fields := []string{"name", "type", "target", "threshold", "duration", "cooldown", "notify_resolve", "enable"}
+	rule.State = old.State
+	rule.Value = old.Value
+	rule.PendingSince = old.PendingSince
+	rule.LastNotify = old.LastNotify
+	changed := old.Type != rule.Type || old.Target != rule.Target ||
+		old.Threshold != rule.Threshold || old.Duration != rule.Duration ||
+		(old.Enable && !rule.Enable)
+	if changed {
+		if old.State == AlertStateFiring {
+			event := newAlertEvent(old, AlertStateResolved, time.Now().Unix())
+			if err := s.addEvent(event); err != nil {
+				logger.Warning("save alert event failed:", err)
+			}
+			if old.NotifyResolve && old.LastNotify >= old.PendingSince {
+				s.NotifyEvents([]*model.AlertEvent{event})
+			}
+		}
+		rule.State = AlertStateOk
+		rule.PendingSince = 0
+		fields = append(fields, "state", "pending_since")
+	}
+	return db.Model(&model.AlertRule{Id: rule.Id}).Select(fields).Updates(rule).Error
+}
+
+func (s *AlertService) DelRule(id int) error {
+	return database.GetDB().Delete(&model.AlertRule{}, id).Error
+}
+
+// GetEvents returns the latest firing and resolve events, newest first.
+func (s *AlertService) GetEvents(ruleId int, limit int) ([]*model.AlertEvent, error) {
+	if limit <= 0 || limit > maxAlertEvents {
+		limit = maxAlertEvents
+	}
+	db := database.GetDB().Model(model.AlertEvent{})
+	if ruleId > 0 {
+		db = db.Where("rule_id = ?", ruleId)
+	}
+	events := make([]*model.AlertEvent, 0)
+	err := db.Order("id desc").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (s *AlertService) ClearEvents() error {
+	return database.GetDB().Where("1 = 1").Delete(&model.AlertEvent{}).Error
+}
+
+func (s *AlertService) addEvent(event *model.AlertEvent) error {
+	db := database.GetDB()
+	if err := db.Create(event).Error; err != nil {
+		return err
+	}
+	return db.Where("id <= ?", event.Id-maxAlertEvents).Delete(&model.AlertEvent{}).Error
+}
+
+// ObserveClientTraffic remembers the client traffic of one collection run for
+// the client traffic rules.
+func (s *AlertService) ObserveClientTraffic(traffics []*xray.ClientTraffic) {
+	sample := clientTrafficSample{time: time.Now(), bytes: make(map[string]int64)}
+	for _, traffic := range traffics {
+		if traffic.Up+traffic.Down > 0 {
+			sample.bytes[traffic.Email] += traffic.Up + traffic.Down
+		}
+	}
+
+	alertLock.Lock()
+	defer alertLock.Unlock()
+	since := sample.time.Add(-time.Minute)
+	i := 0
+	for i < len(clientTrafficTrail) && clientTrafficTrail[i].time.Before(since) {
+		i++
+	}
+	clientTrafficTrail = append(clientTrafficTrail[i:], sample)
+}
+
+// Evaluate measures every enabled rule, advances its state and returns the
+// events that should be notified.
+func (s *AlertService) Evaluate() ([]*model.AlertEvent, error) {
+	rules, err := s.GetRules()
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	now := time.Now().Unix()
+	notify := make([]*model.AlertEvent, 0)
+	for _, rule := range rules {
+		if !rule.Enable {
+			continue
+		}
+		value, err := s.measure(rule)
+		if err != nil {
+			logger.Warning("evaluate alert", rule.Name, "failed:", err)
+			continue
+		}
+
+		breach := value > rule.Threshold
+		if alertTypes[rule.Type].below {
+			breach = value < rule.Threshold
+		}
+		rule.Value = value
+
+		var event *model.AlertEvent
+		notified := false
+		switch {
+		case breach && rule.State != AlertStatePending && rule.State != AlertStateFiring:
+			rule.State = AlertStatePending
+			rule.PendingSince = now
+			if rule.Duration == 0 {
+				event, notified = s.fire(rule, now)
+			}
+		case breach && rule.State == AlertStatePending:
+			if now-rule.PendingSince >= int64(rule.Duration) {
+				event, notified = s.fire(rule, now)
+			}
+		case !breach && rule.State == AlertStateFiring:
+			rule.State = AlertStateOk
+			event = newAlertEvent(rule, AlertStateResolved, now)
+			// resolve only incidents whose firing was notified
+			notified = rule.NotifyResolve && rule.LastNotify >= rule.PendingSince
+		case !breach:
+			rule.State = AlertStateOk
+		}
+
+		if event != nil {
+			if err := s.addEvent(event); err != nil {
+				logger.Warning("save alert event failed:", err)
+			}
+			if notified {
+				notify = append(notify, event)
+			}
+		}
+		err = db.Model(rule).Select("state", "value", "pending_since", "last_notify").Updates(rule).Error
+		if err != nil {
+			logger.Warning("save alert state failed:", err)
+		}
+	}
+	return notify, nil
+}
+
+// NotifyEvents sends a notification for each firing and resolve event.
+func (s *AlertService) NotifyEvents(events []*model.AlertEvent) {
+	for _, event := range events {
+		key := "tgbot.messages.alertFiring"
+		if event.State == AlertStateResolved {
+			key = "tgbot.messages.alertResolved"
+		}
+		msg := locale.I18n(locale.Bot, key,
+			"Name=="+html.EscapeString(event.Name),
+			"Value=="+strconv.FormatFloat(event.Value, 'f', 2, 64),
+			"Threshold=="+strconv.FormatFloat(event.Threshold, 'f', 2, 64))
+		s.notifyService.Notify(NotifyAlert, msg)
+	}
+}
+
+// fire moves rule to the firing state. The event is not notified while the
+// rule is still in the cooldown of its last notification.
+func (s *AlertService) fire(rule *model.AlertRule, now int64) (*model.AlertEvent, bool) {
+	rule.State = AlertStateFiring
+	event := newAlertEvent(rule, AlertStateFiring, now)
+	if rule.LastNotify > 0 && now-rule.LastNotify < int64(rule.Cooldown) {
+		return event, false
+	}
+	rule.LastNotify = now
+	return event, true
+}
+
+func newAlertEvent(rule *model.AlertRule, state string, now int64) *model.AlertEvent {
+	return &model.AlertEvent{
+		RuleId:    rule.Id,
+		Name:      rule.Name,
+		Type:      rule.Type,
+		State:     state,
+		Value:     rule.Value,
+		Threshold: rule.Threshold,
+		Time:      now,
+	}
+}
+
+func (s *AlertService) measure(rule *model.AlertRule) (float64, error) {
+	switch rule.Type {
+	case AlertCpu:
+		percents, err := cpu.Percent(0, false)
+		if err != nil || len(percents) == 0 {
+			return 0, err
+		}
+		return percents[0], nil
+	case AlertMem:
+		memInfo, err := mem.VirtualMemory()
+		if err != nil {
+			return 0, err
+		}
+		return memInfo.UsedPercent, nil
+	case AlertSwap:
+		swapInfo, err := mem.SwapMemory()
+		if err != nil {
+			return 0, err
+		}
+		return swapInfo.UsedPercent, nil
+	case AlertDisk:
+		path := rule.Target
+		if path == "" {
+			path = "/"
+		}
+		usage, err := disk.Usage(path)
+		if err != nil {
+			return 0, err
+		}
+		return usage.UsedPercent, nil
+	case AlertLoad:
+		avg, err := load.Avg()
+		if err != nil {
+			return 0, err
+		}
+		return avg.Load1, nil
+	case AlertXrayStopped:
+		if s.xrayService.IsXrayRunning() {
+			return 0, nil
+		}
+		return 1, nil
+	case AlertXrayRestarts:
+		// restarts within the last hour
+		since := time.Now().Add(-time.Hour)
+		count := 0
+		for _, event := range s.xrayService.GetSupervisorState().History {
+			if event.Time.After(since) {
+				count++
+			}
+		}
+		return float64(count), nil
+	case AlertOutboundTest:
+		return s.measureOutbound(rule.Target)
+	case AlertCertExpiry:
+		return s.measureCertExpiry(rule.Target)
+	case AlertClientTraffic:
+		// MB transferred by the busiest client, or the target client, within the last minute
+		alertLock.Lock()
+		defer alertLock.Unlock()
+		since := time.Now().Add(-time.Minute)
+		totals := make(map[string]int64)
+		for _, sample := range clientTrafficTrail {
+			if sample.time.Before(since) {
+				continue
+			}
+			for email, bytes := range sample.bytes {
+				if rule.Target == "" || rule.Target == email {
+					totals[email] += bytes
+				}
+			}
+		}
+		var busiest int64
+		for _, total := range totals {
+			busiest = max(busiest, total)
+		}
+		return float64(busiest) / 1024 / 1024, nil
+	case AlertLoginFailures:
+		alertLock.Lock()
+		defer alertLock.Unlock()
+		loginFailures = pruneTimes(loginFailures, time.Minute)
+		return float64(len(loginFailures)), nil
+	}
+	return 0, common.NewError("unknown alert type:", rule.Type)
+}
+
+func (s *AlertService) measureOutbound(tag string) (float64, error) {
+	outbounds, err := s.outboundService.GetAllOutbounds()
+	if err != nil {
+		return 0, err
+	}
+	for _, outbound := range outbounds {
+		if outbound.Tag != tag {
+			continue
+		}
+		result, err := s.outboundService.TestOutbound(outbound.Id)
+		if err != nil {
+			return 0, err
+		}
+		if result.Success {
+			return 0, nil
+		}
+		return 1, nil
+	}
+	return 0, common.NewError("outbound not found:", tag)
+}
+
+// measureCertExpiry returns the days left until the first certificate
+// expires. Without a target the panel, subscription and inbound
+// certificates are checked.
+func (s *AlertService) measureCertExpiry(target string) (float64, error) {
+	var certs [][]byte
+	if target != "" {
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return 0, err
+		}
+		certs = append(certs, data)
+	} else {
+		certs = s.collectCertificates()
+	}
+
+	days := math.Inf(1)
+	for _, data := range certs {
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			days = math.Min(days, time.Until(cert.NotAfter).Hours()/24)
+			// only the leaf certificate counts
+			break
+		}
+	}
+	if math.IsInf(days, 1) {
+		return 0, common.NewError("no certificates found")
+	}
+	return days, nil
+}
+
+func (s *AlertService) collectCertificates() [][]byte {
+	var certs [][]byte
+	readFile := func(path string) {
+		if path == "" {
+			return
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			certs = append(certs, data)
+		}
+	}
+
+	webCertFile, _ := s.settingService.GetCertFile()
+	readFile(webCertFile)
+	subCertFile, _ := s.settingService.GetSubCertFile()
+	readFile(subCertFile)
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return certs
+	}
+	for _, inbound := range inbounds {
+		if !inbound.Enable || inbound.StreamSettings == "" {
+			continue
+		}
+		var stream struct {
+			TlsSettings struct {
+				Certificates []struct {
+					CertificateId   int      `json:"certificateId"`
+					CertificateFile string   `json:"certificateFile"`
+					Certificate     []string `json:"certificate"`
+				} `json:"certificates"`
+			} `json:"tlsSettings"`
+		}
+		if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+			continue
+		}
+		for _, cert := range stream.TlsSettings.Certificates {
+			if cert.CertificateId > 0 {
+				if stored, err := s.certificateService.Get(cert.CertificateId); err == nil {
+					certs = append(certs, []byte(stored.Cert))
+				}
+			} else if cert.CertificateFile != "" {
+				readFile(cert.CertificateFile)
+			} else if len(cert.Certificate) > 0 {
+				certs = append(certs, []byte(strings.Join(cert.Certificate, "\n")))
+			}
+		}
+	}
+	return certs
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"html"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/web/locale"
+)
+
+// Sources of the stored certificates. Uploaded certificates are never
+// renewed, the others are issued again before they expire.
+const (
+	CertificateUpload     = "upload"
+	CertificateSelfSigned = "self_signed"
+	CertificateCa         = "ca"
+	CertificateInternal   = "internal"
+	CertificateAcme       = "acme"
+)
+
+// certificateBackdate moves the start of generated certificates back to
+// tolerate clients with a slow clock.
+const certificateBackdate = time.Hour
+
+type CertificateService struct {
+	settingService SettingService
+	notifyService  NotifyService
+	acmeService    AcmeService
+}
+
+func (s *CertificateService) GetAll() ([]*model.Certificate, error) {
+	certs := make([]*model.Certificate, 0)
+	err := database.GetDB().Order("id").Find(&certs).Error
+	return certs, err
+}
+
+func (s *CertificateService) Get(id int) (*model.Certificate, error) {
+	cert := &model.Certificate{}
+	err := database.GetDB().First(cert, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// Upload stores a certificate chain and its private key, both PEM encoded.
+func (s *CertificateService) Upload(name string, certPem string, keyPem string) (*model.Certificate, error) {
+	pair, err := tls.X509KeyPair([]byte(certPem), []byte(keyPem))
+	if err != nil {
+		return nil, common.NewError("invalid certificate or key:", err)
+	}
+	leaf := pair.Leaf
+	domains := slices.Clone(leaf.DNSNames)
+	for _, ip := range leaf.IPAddresses {
+		domains = append(domains, ip.String())
+	}
+	if name == "" {
+		name = leaf.Subject.CommonName
+	}
+	cert := &model.Certificate{
+		Name:      name,
+		Source:    CertificateUpload,
+		Domains:   strings.Join(domains, ","),
+		IsCa:      leaf.IsCA,
+		Cert:      strings.TrimSpace(certPem) + "\n",
+		Key:       strings.TrimSpace(keyPem) + "\n",
+		NotBefore: leaf.NotBefore.Unix(),
+		NotAfter:  leaf.NotAfter.Unix(),
+		UpdatedAt: time.Now().Unix(),
+	}
+	if err := database.GetDB().Create(cert).Error; err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// Generate creates a certificate for domains, valid for days. A self_signed
+// or ca certificate signs itself, an internal one is signed by the stored
+// ca certificate issuerId and an acme one is ordered from the ACME CA, which
+// decides the validity.
+func (s *CertificateService) Generate(name string, source string, domains string, days int, issuerId int) (*model.Certificate, error) {
+	names := parseCertificateDomains(domains)
+	switch source {
+	case CertificateCa:
+		if name == "" {
+			return nil, common.NewError("a ca certificate needs a name")
+		}
+	case CertificateSelfSigned, CertificateInternal, CertificateAcme:
+		if len(names) == 0 {
+			return nil, common.NewError("no domains given")
+		}
+	default:
+		return nil, common.NewError("unknown certificate source:", source)
+	}
+	if days < 0 || days > 36500 {
+		return nil, common.NewError("invalid validity in days:", days)
+	}
+	if days == 0 {
+		days = 365
+		if source == CertificateCa {
+			days = 3650
+		}
+	}
+	if name == "" {
+		name = names[0]
+	}
+
+	cert := &model.Certificate{
+		Name:     name,
+		Source:   source,
+		Domains:  strings.Join(names, ","),
+		IsCa:     source == CertificateCa,
+		IssuerId: issuerId,
+	}
+	if err := s.issue(cert, time.Duration(days)*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Create(cert).Error; err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// Renew issues certificate id again with the same validity. Generated
+// certificates keep their key, so leaves signed by a renewed ca stay valid.
+// Inbounds using it are reloaded.
+func (s *CertificateService) Renew(id int) (*model.Certificate, error) {
+	cert, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Source == CertificateUpload {
+		return nil, common.NewError("uploaded certificates cannot be renewed")
+	}
+	validity := time.Duration(cert.NotAfter-cert.NotBefore)*time.Second - certificateBackdate
+	if err := s.issue(cert, validity); err != nil {
+		return nil, err
+	}
+	cert.WarnedAt = 0
+	if err := database.GetDB().Save(cert).Error; err != nil {
+		return nil, err
+	}
+	logger.Infof("certificate %d (%s) renewed, valid until %s", cert.Id, cert.Name,
+		time.Unix(cert.NotAfter, 0).Format(time.DateOnly))
+	if len(s.InboundsUsing(cert.Id)) > 0 {
+		isNeedXrayRestart.Store(true)
+	}
+	return cert, nil
+}
+
+// Delete removes certificate id unless an inbound or another certificate
+// depends on it.
+func (s *CertificateService) Delete(id int) error {
+	if tags := s.InboundsUsing(id); len(tags) > 0 {
+		return common.NewError("certificate is used by inbounds:", strings.Join(tags, ", "))
+	}
+	var count int64
+	db := database.GetDB()
+	err := db.Model(&model.Certificate{}).Where("issuer_id = ?", id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("certificate has issued other certificates")
+	}
+	return db.Delete(&model.Certificate{}, id).Error
+}
+
+// InboundsUsing returns the tags of the inbounds whose tls settings select
+// certificate id.
+func (s *CertificateService) InboundsUsing(id int) []string {
+	var inbounds []*model.Inbound
+	err := database.GetDB().Model(&model.Inbound{}).Select("tag", "stream_settings").Find(&inbounds).Error
+	if err != nil {
+		return nil
+	}
+	tags := make([]string, 0)
+	for _, inbound := range inbounds {
+		var stream struct {
+			TlsSettings struct {
+				Certificates []struct {
+					CertificateId int `json:"certificateId"`
+				} `json:"certificates"`
+			} `json:"tlsSettings"`
+		}
+		if json.Unmarshal([]byte(inbound.StreamSettings), &stream) != nil {
+			continue
+		}
+		for _, c := range stream.TlsSettings.Certificates {
+			if c.CertificateId == id {
+				tags = append(tags, inbound.Tag)
+				break
+			}
+		}
+	}
+	return tags
+}
+
+// ResolveCertificates replaces the references to stored certificates in
+// the tls certificates of an inbound with the certificate and key inline.
+// References to missing certificates are dropped.
+func (s *CertificateService) ResolveCertificates(tlsSettings map[string]interface{}) {
+	entries, ok := tlsSettings["certificates"].([]interface{})
+	if !ok {
+		return
+	}
+	resolved := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		c, ok := entry.(map[string]interface{})
+		if !ok || c["certificateId"] == nil {
+			resolved = append(resolved, entry)
+			continue
+		}
+		var id int
+		switch v := c["certificateId"].(type) {
+		case float64:
+			id = int(v)
+		case string:
+			id, _ = strconv.Atoi(v)
+		}
+		delete(c, "certificateId")
+		cert, err := s.Get(id)
+		if err != nil {
+			logger.Warning("inbound certificate", id, "not found:", err)
+			continue
+		}
+		delete(c, "certificateFile")
+		delete(c, "keyFile")
+		c["certificate"] = strings.Split(strings.TrimSpace(cert.Cert), "\n")
+		c["key"] = strings.Split(strings.TrimSpace(cert.Key), "\n")
+		resolved = append(resolved, c)
+	}
+	tlsSettings["certificates"] = resolved
+}
+
+// RenewDue renews the generated certificates that expire within 30 days,
+// or within a third of their lifetime if that is shorter, and warns about
+// the certificates that expire within the configured days.
+func (s *CertificateService) RenewDue() {
+	certs, err := s.GetAll()
+	if err != nil {
+		logger.Warning("get certificates failed:", err)
+		return
+	}
+	now := time.Now()
+	for _, cert := range certs {
+		expiry := time.Unix(cert.NotAfter, 0)
+		renewBefore := min(acmeRenewBefore, time.Duration(cert.NotAfter-cert.NotBefore)*time.Second/3)
+		if cert.Source == CertificateUpload || expiry.Sub(now) > renewBefore {
+			continue
+		}
+		renewed, err := s.Renew(cert.Id)
+		if err != nil {
+			logger.Warning("renew certificate", cert.Id, "failed:", err)
+			s.notifyService.Notify(NotifyCert, locale.I18n(locale.Bot, "tgbot.messages.certRenewFailed",
+				"Domain=="+html.EscapeString(cert.Name), "Error=="+html.EscapeString(err.Error())))
+			continue
+		}
+		*cert = *renewed
+	}
+
+	warnDays, err := s.settingService.GetCertExpiryWarnDays()
+	if err != nil || warnDays <= 0 {
+		return
+	}
+	for _, cert := range certs {
+		expiry := time.Unix(cert.NotAfter, 0)
+		if cert.WarnedAt > 0 || expiry.Sub(now) > time.Duration(warnDays)*24*time.Hour {
+			continue
+		}
+		days := int(max(expiry.Sub(now), 0) / (24 * time.Hour))
+		s.notifyService.Notify(NotifyCert, locale.I18n(locale.Bot, "tgbot.messages.certExpiring",
+			"Name=="+html.EscapeString(cert.Name), "Days=="+strconv.Itoa(days), "Date=="+expiry.Format(time.DateOnly)))
+		database.GetDB().Model(cert).Update("warned_at", now.Unix())
+	}
+}
+
+// issue fills the chain, key and validity of cert according to its source.
+func (s *CertificateService) issue(cert *model.Certificate, validity time.Duration) error {
+	domains := parseCertificateDomains(cert.Domains)
+	if cert.Source == CertificateAcme {
+		chain, key, err := s.acmeService.Order(domains)
+		if err != nil {
+			return err
+		}
+		certPem, keyPem, err := encodeCertificate(chain, key)
+		if err != nil {
+			return err
+		}
+		return setCertificatePem(cert, certPem, keyPem)
+	}
+
+	var key crypto.Signer
+	if cert.Key != "" {
+		pair, err := tls.X509KeyPair([]byte(cert.Cert), []byte(cert.Key))
+		if err != nil {
+			return err
+		}
+		key, _ = pair.PrivateKey.(crypto.Signer)
+	}
+	if key == nil {
+		newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		key = newKey
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              now.Add(validity),
+		BasicConstraintsValid: true,
+	}
+	if cert.IsCa {
+		template.Subject = pkix.Name{CommonName: cert.Name, Organization: []string{"x-ui"}}
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.Subject = pkix.Name{CommonName: domains[0]}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		for _, domain := range domains {
+			if ip := net.ParseIP(domain); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, domain)
+			}
+		}
+	}
+
+	parent, parentKey := template, key
+	var chain [][]byte
+	if cert.Source == CertificateInternal {
+		issuer, err := s.Get(cert.IssuerId)
+		if err != nil {
+			return common.NewError("issuer certificate not found:", cert.IssuerId)
+		}
+		pair, err := tls.X509KeyPair([]byte(issuer.Cert), []byte(issuer.Key))
+		if err != nil {
+			return err
+		}
+		signer, ok := pair.PrivateKey.(crypto.Signer)
+		if !issuer.IsCa || !pair.Leaf.IsCA || !ok {
+			return common.NewError("issuer is not a ca certificate:", issuer.Name)
+		}
+		if template.NotAfter.After(pair.Leaf.NotAfter) {
+			template.NotAfter = pair.Leaf.NotAfter
+		}
+		parent, parentKey = pair.Leaf, signer
+		chain = pair.Certificate[:1]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return err
+	}
+	certPem, keyPem, err := encodeCertificate(append([][]byte{der}, chain...), key)
+	if err != nil {
+		return err
+	}
+	return setCertificatePem(cert, certPem, keyPem)
+}
+
+func setCertificatePem(cert *model.Certificate, certPem []byte, keyPem []byte) error {
+	pair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return err
+	}
+	cert.Cert = string(certPem)
+	cert.Key = string(keyPem)
+	cert.NotBefore = pair.Leaf.NotBefore.Unix()
+	cert.NotAfter = pair.Leaf.NotAfter.Unix()
+	cert.UpdatedAt = time.Now().Unix()
+	return nil
+}
+
+// encodeCertificate returns the PEM encoding of a DER chain and its key.
+func encodeCertificate(chain [][]byte, key crypto.Signer) ([]byte, []byte, error) {
+	var certPem []byte
+	for _, der := range chain {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPem, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parseCertificateDomains splits a comma or space separated list of names.
+func parseCertificateDomains(domains string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.FieldsFunc(domains, func(r rune) bool { return r == ',' || r == ' ' }) {
+		name = strings.ToLower(name)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/xray"
+)
+
+// GeoSource is a geo data file that is kept up to date from a URL.
+// The expected checksum is either given directly or fetched from Sha256Url.
+type GeoSource struct {
+	Name      string `json:"name"`
+	Url       string `json:"url"`
+	Sha256Url string `json:"sha256Url"`
+	Sha256    string `json:"sha256"`
+}
+
+var geoHttpClient = &http.Client{Timeout: 5 * time.Minute}
+
+type GeoService struct {
+	settingService     SettingService
+	xrayService        XrayService
+	routingRuleService RoutingRuleService
+}
+
+func (s *GeoService) GetGeoFiles() ([]xray.GeoFile, error) {
+	return xray.ListGeoFiles()
+}
+
+func (s *GeoService) GetGeoSources() ([]GeoSource, error) {
+	sourcesJson, err := s.settingService.GetGeoUpdateSources()
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]GeoSource, 0)
+	if strings.TrimSpace(sourcesJson) == "" {
+		return sources, nil
+	}
+	err = json.Unmarshal([]byte(sourcesJson), &sources)
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// UploadGeoFile installs an uploaded geo file and restarts xray so the new
+// data is loaded.
+func (s *GeoService) UploadGeoFile(name string, r io.Reader) error {
+	changed, err := xray.InstallGeoFile(name, r, "")
+	if err != nil {
+		return err
+	}
+	if changed {
+		return s.xrayService.RestartXray(true)
+	}
+	return nil
+}
+
+func (s *GeoService) DeleteGeoFile(name string) error {
+	rules, err := s.routingRuleService.BuildDbRulesArray()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(data), "ext:"+name+":") {
+		return common.NewError("geo file is used by routing rules:", name)
+	}
+	return xray.RemoveGeoFile(name)
+}
+
+// UpdateGeoFiles downloads every configured source and restarts xray once if
+// any file changed. Sources that fail are reported but do not stop the rest.
+func (s *GeoService) UpdateGeoFiles() error {
+	sources, err := s.GetGeoSources()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	changed := false
+	for _, source := range sources {
+		updated, err := s.updateGeoFile(source)
+		if err != nil {
+			logger.Warningf("update geo file %s failed: %v", source.Name, err)
+			errs = append(errs, common.NewErrorf("%s: %v", source.Name, err))
+			continue
+		}
+		if updated {
+			logger.Info("geo file updated:", source.Name)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := s.xrayService.RestartXray(true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *GeoService) updateGeoFile(source GeoSource) (bool, error) {
+	if err := xray.CheckGeoFileName(source.Name); err != nil {
+		return false, err
+	}
+	if source.Url == "" {
+		return false, common.NewError("no url for geo file", source.Name)
+	}
+
+	checksum := source.Sha256
+	if checksum == "" && source.Sha256Url != "" {
+		body, err := geoDownload(source.Sha256Url)
+		if err != nil {
+			return false, err
+		}
+		data, err := io.ReadAll(io.LimitReader(body, 4096))
+		body.Close()
+		if err != nil {
+			return false, err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return false, common.NewError("empty checksum file:", source.Sha256Url)
+		}
+		checksum = fields[0]
+	}
+
+	body, err := geoDownload(source.Url)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+	return xray.InstallGeoFile(source.Name, body, checksum)
+}
+
+func geoDownload(url string) (io.ReadCloser, error) {
+	resp, err := geoHttpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, common.NewErrorf("download %s failed: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
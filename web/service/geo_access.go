@@ -0,0 +1,241 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alireza0/x-ui/config"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/iplimit"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/util/geoip"
+)
+
+const (
+	GeoAccessAllow = "allow"
+	GeoAccessDeny  = "deny"
+)
+
+// Loopback and private networks stay reachable on allow-listed inbounds.
+var geoAccessLocalNetworks = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16",
+	"::1/128", "fc00::/7", "fe80::/10",
+}
+
+var geoAccessState struct {
+	sync.Mutex
+	signature string
+}
+
+// normalizeGeoAccess validates the country access fields of inbound and
+// stores the countries as sorted upper case codes.
+func normalizeGeoAccess(inbound *model.Inbound) error {
+	countries := parseCountries(inbound.GeoCountries)
+	switch inbound.GeoMode {
+	case "":
+		countries = nil
+	case GeoAccessAllow, GeoAccessDeny:
+		if len(countries) == 0 {
+			return common.NewError("country access needs at least one country")
+		}
+	default:
+		return common.NewError("invalid country access mode:", inbound.GeoMode)
+	}
+	for _, country := range countries {
+		if len(country) != 2 || strings.Trim(country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return common.NewError("invalid country code:", country)
+		}
+	}
+	inbound.GeoCountries = strings.Join(countries, ",")
+	return nil
+}
+
+func parseCountries(value string) []string {
+	seen := make(map[string]bool)
+	countries := make([]string, 0)
+	for _, country := range strings.Split(value, ",") {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if country != "" && !seen[country] {
+			seen[country] = true
+			countries = append(countries, country)
+		}
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// RefreshGeoAccess applies the country rules in the background.
+func RefreshGeoAccess() {
+	go func() {
+		var geoAccessService GeoAccessService
+		if err := geoAccessService.Apply(); err != nil {
+			logger.Warning("apply country access rules failed:", err)
+		}
+	}()
+}
+
+type GeoAccessService struct {
+	inboundService InboundService
+}
+
+// geoAccessSources returns the files the country networks are read from:
+// the .mmdb files of the bin folder, then geoip.dat for the countries the
+// databases do not have.
+func geoAccessSources() []string {
+	binFolder := config.GetBinFolderPath()
+	files, _ := filepath.Glob(filepath.Join(binFolder, "*.mmdb"))
+	return append(files, filepath.Join(binFolder, "geoip.dat"))
+}
+
+// Apply builds the firewall rules of the enabled inbounds with country
+// access. Nothing is done while the inbounds and the GeoIP files are the
+// same as on the last run.
+func (s *GeoAccessService) Apply() error {
+	if ipLimitFw == nil || !ipLimitFw.Supported() {
+		return nil
+	}
+	geoAccessState.Lock()
+	defer geoAccessState.Unlock()
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	portRules := make([]geoPortRule, 0)
+	countrySet := make(map[string]bool)
+	var signature strings.Builder
+	for _, inbound := range inbounds {
+		if !inbound.Enable || inbound.GeoMode == "" || inbound.Port <= 0 || inbound.Port > 65535 {
+			continue
+		}
+		countries := parseCountries(inbound.GeoCountries)
+		if len(countries) == 0 {
+			continue
+		}
+		for _, country := range countries {
+			countrySet[country] = true
+		}
+		portRules = append(portRules, geoPortRule{uint16(inbound.Port), inbound.GeoMode == GeoAccessAllow, countries})
+		fmt.Fprintf(&signature, "%d:%s:%s;", inbound.Port, inbound.GeoMode, strings.Join(countries, ","))
+	}
+	sources := geoAccessSources()
+	if len(portRules) > 0 {
+		for _, source := range sources {
+			if stat, err := os.Stat(source); err == nil {
+				fmt.Fprintf(&signature, "%s:%d:%d;", source, stat.Size(), stat.ModTime().UnixNano())
+			}
+		}
+	}
+	if signature.String() == geoAccessState.signature {
+		return nil
+	}
+
+	countries := make([]string, 0, len(countrySet))
+	for country := range countrySet {
+		countries = append(countries, country)
+	}
+	networks := make(map[string][]*net.IPNet)
+	if len(countries) > 0 {
+		networks, err = loadCountryNetworks(sources, countries)
+		if err != nil {
+			return err
+		}
+	}
+	rules := buildCountryRules(portRules, networks)
+	if err := ipLimitFw.SetCountryRules(rules); err != nil {
+		return err
+	}
+	geoAccessState.signature = signature.String()
+	if len(rules) > 0 {
+		logger.Infof("country access rules applied to %d inbound(s)", len(rules))
+	}
+	return nil
+}
+
+type geoPortRule struct {
+	port      uint16
+	allow     bool
+	countries []string
+}
+
+// buildCountryRules turns the port rules into firewall rules with the
+// networks of their countries. An allow rule none of whose countries has
+// networks is skipped, it would only let the local networks in.
+func buildCountryRules(portRules []geoPortRule, networks map[string][]*net.IPNet) []iplimit.CountryRule {
+	local := make([]*net.IPNet, 0, len(geoAccessLocalNetworks))
+	for _, cidr := range geoAccessLocalNetworks {
+		_, network, _ := net.ParseCIDR(cidr)
+		local = append(local, network)
+	}
+
+	rules := make([]iplimit.CountryRule, 0, len(portRules))
+	for _, r := range portRules {
+		rule := iplimit.CountryRule{Port: r.port, Allow: r.allow}
+		for _, country := range r.countries {
+			if len(networks[country]) == 0 {
+				logger.Warning("no GeoIP networks found for country", country)
+			}
+			rule.Networks = append(rule.Networks, networks[country]...)
+		}
+		if len(rule.Networks) == 0 {
+			if r.allow {
+				logger.Warningf("country allow list of port %d skipped, none of %s has GeoIP networks", r.port, strings.Join(r.countries, ","))
+			}
+			continue
+		}
+		if r.allow {
+			rule.Networks = append(rule.Networks, local...)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func loadCountryNetworks(sources []string, countries []string) (map[string][]*net.IPNet, error) {
+	result := make(map[string][]*net.IPNet)
+	remaining := countries
+	var lastErr error
+	for _, source := range sources {
+		if len(remaining) == 0 {
+			break
+		}
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+		var networks map[string][]*net.IPNet
+		var err error
+		if strings.HasSuffix(source, ".dat") {
+			networks, err = geoip.LoadGeodat(source, remaining)
+		} else {
+			var reader *geoip.Reader
+			if reader, err = geoip.Open(source); err == nil {
+				networks, err = reader.CountryNetworks(remaining)
+			}
+		}
+		if err != nil {
+			logger.Warning("read country networks from", filepath.Base(source), "failed:", err)
+			lastErr = err
+			continue
+		}
+		for country, list := range networks {
+			result[country] = append(result[country], list...)
+		}
+		missing := make([]string, 0, len(remaining))
+		for _, country := range remaining {
+			if len(result[country]) == 0 {
+				missing = append(missing, country)
+			}
+		}
+		remaining = missing
+	}
+	if len(result) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return result, nil
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBuildCountryRules(t *testing.T) {
+	_, de, _ := net.ParseCIDR("1.2.3.0/24")
+	networks := map[string][]*net.IPNet{"DE": {de}}
+	rules := buildCountryRules([]geoPortRule{
+		{port: 443, allow: true, countries: []string{"DE", "XX"}},
+		{port: 8443, allow: true, countries: []string{"XX"}},
+		{port: 2053, allow: false, countries: []string{"DE"}},
+		{port: 2083, allow: false, countries: []string{"XX"}},
+	}, networks)
+
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2: %+v", len(rules), rules)
+	}
+	if rules[0].Port != 443 || !rules[0].Allow || len(rules[0].Networks) != 1+len(geoAccessLocalNetworks) {
+		t.Errorf("unexpected allow rule %+v", rules[0])
+	}
+	if rules[1].Port != 2053 || rules[1].Allow || len(rules[1].Networks) != 1 {
+		t.Errorf("unexpected deny rule %+v", rules[1])
+	}
+}
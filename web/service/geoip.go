@@ -0,0 +1,227 @@
+package service
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/config"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/util/geoip"
+	"github.com/alireza0/x-ui/xray"
+)
+
+const (
+	maxGeoIPCache    = 4096
+	maxGeoIPFileSize = 512 << 20
+)
+
+// geoIPState holds the .mmdb files of the bin folder. They are loaded on
+// first use, a country or city database and an ASN database complement
+// each other.
+var geoIPState struct {
+	sync.RWMutex
+	loaded  bool
+	readers []*geoip.Reader
+	names   []string
+	cache   map[string]geoip.Info
+}
+
+func loadGeoIPLocked() {
+	geoIPState.loaded = true
+	geoIPState.readers = nil
+	geoIPState.names = nil
+	geoIPState.cache = make(map[string]geoip.Info)
+
+	files, err := filepath.Glob(filepath.Join(config.GetBinFolderPath(), "*.mmdb"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		reader, err := geoip.Open(file)
+		if err != nil {
+			logger.Warning("load geoip database", filepath.Base(file), "failed:", err)
+			continue
+		}
+		geoIPState.readers = append(geoIPState.readers, reader)
+		geoIPState.names = append(geoIPState.names, filepath.Base(file))
+	}
+}
+
+// ReloadGeoIP reads the .mmdb files of the bin folder again.
+func ReloadGeoIP() {
+	geoIPState.Lock()
+	defer geoIPState.Unlock()
+	loadGeoIPLocked()
+}
+
+// lookupIpInfo returns the GeoIP info of ip, ok is false if no database
+// knows the address.
+func lookupIpInfo(ip string) (geoip.Info, bool) {
+	geoIPState.RLock()
+	if geoIPState.loaded {
+		info, cached := geoIPState.cache[ip]
+		readers := len(geoIPState.readers)
+		geoIPState.RUnlock()
+		if cached || readers == 0 {
+			return info, !info.IsEmpty()
+		}
+	} else {
+		geoIPState.RUnlock()
+	}
+
+	geoIPState.Lock()
+	defer geoIPState.Unlock()
+	if !geoIPState.loaded {
+		loadGeoIPLocked()
+	}
+	info := geoip.Info{}
+	parsed := net.ParseIP(strings.Trim(ip, "[]"))
+	if parsed == nil {
+		return info, false
+	}
+	for _, reader := range geoIPState.readers {
+		if err := reader.LookupInfo(parsed, &info); err != nil {
+			logger.Debug("geoip lookup failed:", err)
+		}
+	}
+	if len(geoIPState.cache) >= maxGeoIPCache {
+		geoIPState.cache = make(map[string]geoip.Info)
+	}
+	geoIPState.cache[ip] = info
+	return info, !info.IsEmpty()
+}
+
+// hasGeoIP reports whether any database is loaded.
+func hasGeoIP() bool {
+	geoIPState.Lock()
+	defer geoIPState.Unlock()
+	if !geoIPState.loaded {
+		loadGeoIPLocked()
+	}
+	return len(geoIPState.readers) > 0
+}
+
+// enrichOnlineUsers fills the Geo field of users for the addresses known
+// to the GeoIP databases.
+func enrichOnlineUsers(users []xray.OnlineUserInfo) {
+	if !hasGeoIP() {
+		return
+	}
+	for i := range users {
+		for ip := range users[i].IPs {
+			info, ok := lookupIpInfo(ip)
+			if !ok {
+				continue
+			}
+			if users[i].Geo == nil {
+				users[i].Geo = make(map[string]geoip.Info)
+			}
+			users[i].Geo[ip] = info
+		}
+	}
+}
+
+type GeoIPDatabase struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"databaseType"`
+	IPVersion    uint   `json:"ipVersion"`
+	BuildTime    int64  `json:"buildTime"`
+}
+
+type GeoIPLookup struct {
+	Ip    string     `json:"ip"`
+	Found bool       `json:"found"`
+	Info  geoip.Info `json:"info"`
+}
+
+type GeoIPService struct{}
+
+// GetDatabases returns the loaded .mmdb files.
+func (s *GeoIPService) GetDatabases() []GeoIPDatabase {
+	hasGeoIP()
+	geoIPState.RLock()
+	defer geoIPState.RUnlock()
+	databases := make([]GeoIPDatabase, 0, len(geoIPState.readers))
+	for i, reader := range geoIPState.readers {
+		databases = append(databases, GeoIPDatabase{
+			Name:         geoIPState.names[i],
+			DatabaseType: reader.Metadata.DatabaseType,
+			IPVersion:    reader.Metadata.IPVersion,
+			BuildTime:    int64(reader.Metadata.BuildEpoch),
+		})
+	}
+	return databases
+}
+
+func (s *GeoIPService) Lookup(ips []string) ([]GeoIPLookup, error) {
+	result := make([]GeoIPLookup, 0, len(ips))
+	for _, ip := range ips {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue
+		}
+		if net.ParseIP(strings.Trim(ip, "[]")) == nil {
+			return nil, common.NewError("invalid ip address:", ip)
+		}
+		info, ok := lookupIpInfo(ip)
+		result = append(result, GeoIPLookup{Ip: ip, Found: ok, Info: info})
+	}
+	return result, nil
+}
+
+// Upload stores a .mmdb file in the bin folder, replacing a file with the
+// same name, and reloads the databases. The file is checked before it
+// replaces the old one.
+func (s *GeoIPService) Upload(name string, file io.Reader) error {
+	name = filepath.Base(name)
+	if !strings.HasSuffix(strings.ToLower(name), ".mmdb") || strings.HasPrefix(name, ".") {
+		return common.NewError("geoip database must be a .mmdb file:", name)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxGeoIPFileSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxGeoIPFileSize {
+		return common.NewError("geoip database is too large")
+	}
+	reader, err := geoip.FromBytes(data)
+	if err != nil {
+		return common.NewError("invalid geoip database:", err)
+	}
+
+	path := filepath.Join(config.GetBinFolderPath(), name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	logger.Infof("geoip database %s updated, type %s built %s", name, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).Format("2006-01-02"))
+	ReloadGeoIP()
+	RefreshGeoAccess()
+	return nil
+}
+
+// Delete removes a .mmdb file from the bin folder.
+func (s *GeoIPService) Delete(name string) error {
+	name = filepath.Base(name)
+	if !strings.HasSuffix(strings.ToLower(name), ".mmdb") {
+		return common.NewError("geoip database must be a .mmdb file:", name)
+	}
+	err := os.Remove(filepath.Join(config.GetBinFolderPath(), name))
+	if err != nil {
+		return err
+	}
+	ReloadGeoIP()
+	RefreshGeoAccess()
+	return nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/hostfw"
+	"github.com/alireza0/x-ui/logger"
+)
+
+// Host firewall modes. Open only adds accept rules, deny also drops every
+// port that is not opened.
+const (
+	HostFirewallOff  = "off"
+	HostFirewallOpen = "open"
+	HostFirewallDeny = "deny"
+)
+
+var hostFirewallState struct {
+	sync.Mutex
+	signature string
+	panelPort int
+}
+
+// SetHostFirewallPanelPort records the port the panel listens on. It stays
+// open after the port setting changed until the panel is restarted.
+func SetHostFirewallPanelPort(port int) {
+	hostFirewallState.Lock()
+	defer hostFirewallState.Unlock()
+	hostFirewallState.panelPort = port
+}
+
+// RefreshHostFirewall reconciles the host firewall in the background.
+func RefreshHostFirewall() {
+	go func() {
+		var hostFirewallService HostFirewallService
+		if err := hostFirewallService.Apply(); err != nil {
+			logger.Warning("apply host firewall failed:", err)
+		}
+	}()
+}
+
+// inboundTransports reports whether inbound listens on TCP and on UDP.
+func inboundTransports(inbound *model.Inbound) (tcp bool, udp bool) {
+	var settings struct {
+		Network string `json:"network"`
+		Udp     bool   `json:"udp"`
+	}
+	var stream struct {
+		Network string `json:"network"`
+	}
+	json.Unmarshal([]byte(inbound.Settings), &settings)
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+
+	switch strings.ToLower(string(inbound.Protocol)) {
+	case "wireguard", string(model.Hysteria):
+		return false, true
+	case "tun":
+		return false, false
+	case strings.ToLower(string(model.Dokodemo)), "tunnel", string(model.Shadowsocks):
+		network := settings.Network
+		if network == "" {
+			network = "tcp"
+		}
+		return strings.Contains(network, "tcp"), strings.Contains(network, "udp")
+	case "socks", "mixed":
+		return true, settings.Udp
+	}
+	switch stream.Network {
+	case "kcp", "quic":
+		return false, true
+	}
+	return true, false
+}
+
+type HostFirewallService struct {
+	inboundService InboundService
+	settingService SettingService
+}
+
+// GetRules returns the ports to open: the panel, the subscription server,
+// the extra ports of the settings and the enabled inbounds. The panel port
+// is always open so a deny policy cannot lock the admin out.
+func (s *HostFirewallService) GetRules() ([]hostfw.Rule, error) {
+	rules := make(map[uint16]*hostfw.Rule)
+	add := func(port int, tcp bool, udp bool) {
+		if port <= 0 || port > 65535 || (!tcp && !udp) {
+			return
+		}
+		rule, ok := rules[uint16(port)]
+		if !ok {
+			rule = &hostfw.Rule{Port: uint16(port)}
+			rules[uint16(port)] = rule
+		}
+		rule.TCP = rule.TCP || tcp
+		rule.UDP = rule.UDP || udp
+	}
+
+	webPort, err := s.settingService.GetPort()
+	if err != nil {
+		return nil, err
+	}
+	add(webPort, true, false)
+	if subEnable, _ := s.settingService.GetSubEnable(); subEnable {
+		subPort, _ := s.settingService.GetSubPort()
+		add(subPort, true, false)
+	}
+	portsSetting, _ := s.settingService.GetHostFirewallPorts()
+	extra, err := hostfw.ParsePorts(portsSetting)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range extra {
+		add(int(rule.Port), rule.TCP, rule.UDP)
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		if inbound.Enable {
+			tcp, udp := inboundTransports(inbound)
+			add(inbound.Port, tcp, udp)
+		}
+	}
+
+	result := make([]hostfw.Rule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, *rule)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Port < result[j].Port
+	})
+	return result, nil
+}
+
+// Apply reconciles the managed rules with the settings and the inbounds,
+// or removes them when the host firewall is off. Deny also keeps the ports
+// of sshd open.
+func (s *HostFirewallService) Apply() error {
+	mode, err := s.settingService.GetHostFirewall()
+	if err != nil {
+		return err
+	}
+	hostFirewallState.Lock()
+	defer hostFirewallState.Unlock()
+
+	if mode != HostFirewallOpen && mode != HostFirewallDeny {
+		if hostFirewallState.signature == HostFirewallOff {
+			return nil
+		}
+		// Off is the default, hosts without nftables should not warn.
+		if err := hostfw.Remove(); err != nil {
+			logger.Debug("remove host firewall failed:", err)
+		}
+		hostFirewallState.signature = HostFirewallOff
+		return nil
+	}
+
+	rules, err := s.GetRules()
+	if err != nil {
+		return err
+	}
+	if port := hostFirewallState.panelPort; port > 0 && port <= 65535 {
+		rules = mergeHostFirewallRule(rules, hostfw.Rule{Port: uint16(port), TCP: true})
+	}
+	if mode == HostFirewallDeny {
+		// a drop policy must not cut off the SSH access to the host
+		for _, port := range hostfw.SSHPorts() {
+			rules = mergeHostFirewallRule(rules, hostfw.Rule{Port: port, TCP: true})
+		}
+	}
+	var signature strings.Builder
+	signature.WriteString(mode)
+	for _, rule := range rules {
+		fmt.Fprintf(&signature, ";%d:%t:%t", rule.Port, rule.TCP, rule.UDP)
+	}
+	if signature.String() == hostFirewallState.signature {
+		return nil
+	}
+	if err := hostfw.Apply(rules, mode == HostFirewallDeny); err != nil {
+		return err
+	}
+	hostFirewallState.signature = signature.String()
+	logger.Infof("host firewall (%s) opened %d port(s)", mode, len(rules))
+	return nil
+}
+
+// mergeHostFirewallRule adds rule to the rules sorted by port.
+func mergeHostFirewallRule(rules []hostfw.Rule, rule hostfw.Rule) []hostfw.Rule {
+	i := sort.Search(len(rules), func(i int) bool {
+		return rules[i].Port >= rule.Port
+	})
+	if i < len(rules) && rules[i].Port == rule.Port {
+		rules[i].TCP = rules[i].TCP || rule.TCP
+		rules[i].UDP = rules[i].UDP || rule.UDP
+		return rules
+	}
+	return append(rules[:i], append([]hostfw.Rule{rule}, rules[i:]...)...)
+}
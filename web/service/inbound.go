@@ -15,9 +15,7 @@ import (
 	"gorm.io/gorm"
 )
 
-type InboundService struct {
-	xrayApi xray.XrayAPI
-}
+type InboundService struct{}
 
 const (
 	safeBatchSize = 500
@@ -156,6 +154,9 @@ func (s *InboundService) checkEmailExistForInbound(inbound *model.Inbound) (stri
 }
 
 func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, bool, error) {
+	if err := normalizeGeoAccess(inbound); err != nil {
+		return inbound, false, err
+	}
 	exist, err := s.checkPortExist(inbound.Listen, inbound.Port, 0)
 	if err != nil {
 		return inbound, false, err
@@ -201,9 +202,12 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 
 	db := database.GetDB()
 	tx := db.Begin()
+	var events webhookBatch
 	defer func() {
 		if err == nil {
-			tx.Commit()
+			if tx.Commit().Error == nil {
+				events.emit()
+			}
 		} else {
 			tx.Rollback()
 		}
@@ -222,23 +226,23 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 
 	needRestart := false
 	if inbound.Enable {
-		s.xrayApi.Init(p.GetAPIAddr())
+		xrayAPI.Init(p.GetAPIAddr())
 		inboundJson, err1 := json.MarshalIndent(inbound.GenXrayInboundConfig(), "", "  ")
 		if err1 != nil {
 			logger.Debug("Unable to marshal inbound config:", err1)
 		}
 
-		err1 = s.xrayApi.AddInbound(inboundJson)
+		err1 = xrayAPI.AddInbound(inboundJson)
 		if err1 == nil {
-			logger.Debug("New inbound added by api:", inbound.Tag)
+			logger.WithFields(logger.Fields{"inbound": inbound.Tag}).Debug("New inbound added by api")
 		} else {
 			logger.Debug("Unable to add inbound by api:", err1)
 			needRestart = true
 		}
-		s.xrayApi.Close()
 	}
 
 	s.syncIpLimitStore(ipLimitUpdatesFromClients(inbound, clients), nil)
+	events.addClientChanges(inbound.Id, inbound.Protocol, nil, clients)
 	return inbound, needRestart, err
 }
 
@@ -264,17 +268,16 @@ func (s *InboundService) DelInbound(id int) (bool, error) {
 	needRestart := false
 	result := db.Model(model.Inbound{}).Select("tag").Where("id = ? and enable = ?", id, true).First(&tag)
 	if result.Error == nil {
-		s.xrayApi.Init(p.GetAPIAddr())
-		err1 := s.xrayApi.DelInbound(tag)
+		xrayAPI.Init(p.GetAPIAddr())
+		err1 := xrayAPI.DelInbound(tag)
 		if err1 == nil {
-			logger.Debug("Inbound deleted by api:", tag)
+			logger.WithFields(logger.Fields{"inbound": tag}).Debug("Inbound deleted by api")
 		} else {
 			logger.Debug("Unable to delete inbound by api:", err1)
 			needRestart = true
 		}
-		s.xrayApi.Close()
 	} else {
-		logger.Debug("No enabled inbound founded to removing by api", tag)
+		logger.WithFields(logger.Fields{"inbound": tag}).Debug("No enabled inbound founded to removing by api")
 	}
 
 	// Delete client traffics of inbounds
@@ -284,7 +287,13 @@ func (s *InboundService) DelInbound(id int) (bool, error) {
 	}
 
 	s.syncIpLimitStore(nil, removeEmails)
-	return needRestart, db.Delete(model.Inbound{}, id).Error
+	err = db.Delete(model.Inbound{}, id).Error
+	if err == nil {
+		for _, email := range removeEmails {
+			emitWebhook(WebhookClientDeleted, map[string]any{"inboundId": id, "email": email})
+		}
+	}
+	return needRestart, err
 }
 
 func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
@@ -298,6 +307,9 @@ func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
 }
 
 func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound, bool, error) {
+	if err := normalizeGeoAccess(inbound); err != nil {
+		return inbound, false, err
+	}
 	exist, err := s.checkPortExist(inbound.Listen, inbound.Port, inbound.Id)
 	if err != nil {
 		return inbound, false, err
@@ -320,12 +332,12 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 
 	db := database.GetDB()
 	tx := db.Begin()
-
+	var events webhookBatch
 	defer func() {
 		if err != nil {
 			tx.Rollback()
-		} else {
-			tx.Commit()
+		} else if tx.Commit().Error == nil {
+			events.emit()
 		}
 	}()
 
@@ -346,6 +358,8 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	oldInbound.Settings = inbound.Settings
 	oldInbound.StreamSettings = inbound.StreamSettings
 	oldInbound.Sniffing = inbound.Sniffing
+	oldInbound.GeoMode = inbound.GeoMode
+	oldInbound.GeoCountries = inbound.GeoCountries
 	if inbound.Listen == "" || inbound.Listen == "0.0.0.0" || inbound.Listen == "::" || inbound.Listen == "::0" {
 		oldInbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
 	} else {
@@ -353,9 +367,9 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	}
 
 	needRestart := false
-	s.xrayApi.Init(p.GetAPIAddr())
-	if s.xrayApi.DelInbound(tag) == nil {
-		logger.Debug("Old inbound deleted by api:", tag)
+	xrayAPI.Init(p.GetAPIAddr())
+	if xrayAPI.DelInbound(tag) == nil {
+		logger.WithFields(logger.Fields{"inbound": tag}).Debug("Old inbound deleted by api")
 	}
 	if inbound.Enable {
 		inboundJson, err2 := json.MarshalIndent(oldInbound.GenXrayInboundConfig(), "", "  ")
@@ -363,16 +377,15 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 			logger.Debug("Unable to marshal updated inbound config:", err2)
 			needRestart = true
 		} else {
-			err2 = s.xrayApi.AddInbound(inboundJson)
+			err2 = xrayAPI.AddInbound(inboundJson)
 			if err2 == nil {
-				logger.Debug("Updated inbound added by api:", oldInbound.Tag)
+				logger.WithFields(logger.Fields{"inbound": oldInbound.Tag}).Debug("Updated inbound added by api")
 			} else {
 				logger.Debug("Unable to update inbound by api:", err2)
 				needRestart = true
 			}
 		}
 	}
-	s.xrayApi.Close()
 
 	syncInbound := *oldInbound
 	syncInbound.Enable = inbound.Enable
@@ -384,7 +397,11 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 		ipLimitUpdatesFromClients(&syncInbound, newClients),
 		ipLimitRemovedEmails(oldClients, newClients),
 	)
-	return inbound, needRestart, tx.Save(oldInbound).Error
+	err = tx.Save(oldInbound).Error
+	if err == nil {
+		events.addClientChanges(oldInbound.Id, oldInbound.Protocol, oldClients, newClients)
+	}
+	return inbound, needRestart, err
 }
 
 func (s *InboundService) updateClientTraffics(tx *gorm.DB, oldInbound *model.Inbound, newInbound *model.Inbound) error {
@@ -500,17 +517,17 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 
 	db := database.GetDB()
 	tx := db.Begin()
-
+	var events webhookBatch
 	defer func() {
 		if err != nil {
 			tx.Rollback()
-		} else {
-			tx.Commit()
+		} else if tx.Commit().Error == nil {
+			events.emit()
 		}
 	}()
 
 	needRestart := false
-	s.xrayApi.Init(p.GetAPIAddr())
+	xrayAPI.Init(p.GetAPIAddr())
 	for _, client := range clients {
 		if len(client.Email) > 0 {
 			s.AddClientStat(tx, data.Id, &client)
@@ -519,7 +536,7 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 				if oldInbound.Protocol == "shadowsocks" {
 					cipher = oldSettings["method"].(string)
 				}
-				err1 := s.xrayApi.AddUser(string(oldInbound.Protocol), oldInbound.Tag, map[string]interface{}{
+				err1 := xrayAPI.AddUser(string(oldInbound.Protocol), oldInbound.Tag, map[string]interface{}{
 					"email":    client.Email,
 					"id":       client.ID,
 					"auth":     client.Auth,
@@ -528,7 +545,7 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 					"cipher":   cipher,
 				})
 				if err1 == nil {
-					logger.Debug("Client added by api:", client.Email)
+					logger.WithFields(logger.Fields{"email": client.Email}).Debug("Client added by api")
 				} else {
 					logger.Debug("Error in adding client by api:", err1)
 					needRestart = true
@@ -538,11 +555,13 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 			needRestart = true
 		}
 	}
-	s.xrayApi.Close()
 
 	err = tx.Save(oldInbound).Error
 	if err == nil {
 		s.syncIpLimitStore(ipLimitUpdatesFromClients(oldInbound, clients), nil)
+		for _, client := range clients {
+			events.add(WebhookClientCreated, map[string]any{"inboundId": data.Id, "email": client.Email, "client": client})
+		}
 	}
 	return needRestart, err
 }
@@ -612,11 +631,11 @@ func (s *InboundService) DelInboundClient(inboundId int, clientId string) (bool,
 			return false, err
 		}
 		if needApiDel && notDepleted {
-			s.xrayApi.Init(p.GetAPIAddr())
+			xrayAPI.Init(p.GetAPIAddr())
 			onlineIPs := s.collectClientOnlineIPs(email)
-			err1 := s.xrayApi.RemoveUser(oldInbound.Tag, email)
+			err1 := xrayAPI.RemoveUser(oldInbound.Tag, email)
 			if err1 == nil {
-				logger.Debug("Client deleted by api:", email)
+				logger.WithFields(logger.Fields{"email": email}).Debug("Client deleted by api")
 				blockIPsForPort(onlineIPs, uint16(oldInbound.Port))
 				needRestart = false
 			} else {
@@ -627,12 +646,12 @@ func (s *InboundService) DelInboundClient(inboundId int, clientId string) (bool,
 					needRestart = true
 				}
 			}
-			s.xrayApi.Close()
 		}
 	}
 	err = db.Save(oldInbound).Error
 	if err == nil && email != "" {
 		s.syncIpLimitStore(nil, []string{email})
+		emitWebhook(WebhookClientDeleted, map[string]any{"inboundId": inboundId, "email": email})
 	}
 	return needRestart, err
 }
@@ -719,12 +738,12 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	oldInbound.Settings = string(newSettings)
 	db := database.GetDB()
 	tx := db.Begin()
-
+	var events webhookBatch
 	defer func() {
 		if err != nil {
 			tx.Rollback()
-		} else {
-			tx.Commit()
+		} else if tx.Commit().Error == nil {
+			events.emit()
 		}
 	}()
 
@@ -745,15 +764,15 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	}
 	needRestart := false
 	if len(oldEmail) > 0 {
-		s.xrayApi.Init(p.GetAPIAddr())
+		xrayAPI.Init(p.GetAPIAddr())
 		if oldClients[clientIndex].Enable {
 			var onlineIPs []string
 			if !clients[0].Enable {
 				onlineIPs = s.collectClientOnlineIPs(oldEmail)
 			}
-			err1 := s.xrayApi.RemoveUser(oldInbound.Tag, oldEmail)
+			err1 := xrayAPI.RemoveUser(oldInbound.Tag, oldEmail)
 			if err1 == nil {
-				logger.Debug("Old client deleted by api:", oldEmail)
+				logger.WithFields(logger.Fields{"email": oldEmail}).Debug("Old client deleted by api")
 				blockIPsForPort(onlineIPs, uint16(oldInbound.Port))
 			} else {
 				if strings.Contains(err1.Error(), fmt.Sprintf("User %s not found.", oldEmail)) {
@@ -769,7 +788,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 			if oldInbound.Protocol == "shadowsocks" {
 				cipher = oldSettings["method"].(string)
 			}
-			err1 := s.xrayApi.AddUser(string(oldInbound.Protocol), oldInbound.Tag, map[string]interface{}{
+			err1 := xrayAPI.AddUser(string(oldInbound.Protocol), oldInbound.Tag, map[string]interface{}{
 				"email":    clients[0].Email,
 				"id":       clients[0].ID,
 				"flow":     clients[0].Flow,
@@ -778,13 +797,12 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 				"cipher":   cipher,
 			})
 			if err1 == nil {
-				logger.Debug("Client edited by api:", clients[0].Email)
+				logger.WithFields(logger.Fields{"email": clients[0].Email}).Debug("Client edited by api")
 			} else {
 				logger.Debug("Error in adding client by api:", err1)
 				needRestart = true
 			}
 		}
-		s.xrayApi.Close()
 	} else {
 		logger.Debug("Client old email not found")
 		needRestart = true
@@ -798,6 +816,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 		update := ipLimitUpdatesFromClients(oldInbound, []model.Client{clients[0]})
 		update[0].ResetIPs = true
 		s.syncIpLimitStore(update, removeEmails)
+		events.add(WebhookClientUpdated, map[string]any{"inboundId": data.Id, "email": clients[0].Email, "oldEmail": oldEmail, "client": clients[0]})
 	}
 	return needRestart, err
 }
@@ -806,12 +825,12 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 	var err error
 	db := database.GetDB()
 	tx := db.Begin()
-
+	var events webhookBatch
 	defer func() {
 		if err != nil {
 			tx.Rollback()
-		} else {
-			tx.Commit()
+		} else if tx.Commit().Error == nil {
+			events.emit()
 		}
 	}()
 	err = s.addInboundTraffic(tx, inboundTraffics)
@@ -823,21 +842,21 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 		return err, false
 	}
 
-	needRestart0, count, err := s.autoRenewClients(tx)
+	needRestart0, count, err := s.autoRenewClients(tx, &events)
 	if err != nil {
 		logger.Warning("Error in renew clients:", err)
 	} else if count > 0 {
 		logger.Debugf("%v clients renewed", count)
 	}
 
-	needRestart1, count, err := s.disableInvalidClients(tx)
+	needRestart1, count, err := s.disableInvalidClients(tx, &events)
 	if err != nil {
 		logger.Warning("Error in disabling invalid clients:", err)
 	} else if count > 0 {
 		logger.Debugf("%v clients disabled", count)
 	}
 
-	needRestart2, count, err := s.disableInvalidInbounds(tx)
+	needRestart2, count, err := s.disableInvalidInbounds(tx, &events)
 	if err != nil {
 		logger.Warning("Error in disabling invalid inbounds:", err)
 	} else if count > 0 {
@@ -1012,7 +1031,7 @@ func (s *InboundService) adjustTraffics(tx *gorm.DB, inboundExpiryTimeMap map[in
 	return nil
 }
 
-func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
+func (s *InboundService) autoRenewClients(tx *gorm.DB, events *webhookBatch) (bool, int64, error) {
 	// check for time expired
 	var traffics []*xray.ClientTraffic
 	now := time.Now().Unix() * 1000
@@ -1094,26 +1113,40 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 	if err != nil {
 		return false, 0, err
 	}
+	for _, traffic := range traffics {
+		events.add(WebhookClientRenewed, map[string]any{"inboundId": traffic.InboundId, "email": traffic.Email, "expiryTime": traffic.ExpiryTime})
+	}
 	if p != nil {
-		err1 = s.xrayApi.Init(p.GetAPIAddr())
+		err1 = xrayAPI.Init(p.GetAPIAddr())
 		if err1 != nil {
 			return true, int64(len(traffics)), nil
 		}
 		for _, clientToAdd := range clientsToAdd {
-			err1 = s.xrayApi.AddUser(clientToAdd.protocol, clientToAdd.tag, clientToAdd.client)
+			err1 = xrayAPI.AddUser(clientToAdd.protocol, clientToAdd.tag, clientToAdd.client)
 			if err1 != nil {
 				needRestart = true
 			}
 		}
-		s.xrayApi.Close()
 	}
 	return needRestart, int64(len(traffics)), nil
 }
 
-func (s *InboundService) disableInvalidInbounds(tx *gorm.DB) (bool, int64, error) {
+func (s *InboundService) disableInvalidInbounds(tx *gorm.DB, events *webhookBatch) (bool, int64, error) {
 	now := time.Now().Unix() * 1000
 	needRestart := false
 
+	var invalidInbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).
+		Select("id, tag, remark, up, down, total, expiry_time").
+		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Find(&invalidInbounds).Error
+	if err != nil {
+		return false, 0, err
+	}
+	if len(invalidInbounds) == 0 {
+		return false, 0, nil
+	}
+
 	if p != nil {
 		var tags []string
 		err := tx.Table("inbounds").
@@ -1123,24 +1156,32 @@ func (s *InboundService) disableInvalidInbounds(tx *gorm.DB) (bool, int64, error
 		if err != nil {
 			return false, 0, err
 		}
-		s.xrayApi.Init(p.GetAPIAddr())
+		xrayAPI.Init(p.GetAPIAddr())
 		for _, tag := range tags {
-			err1 := s.xrayApi.DelInbound(tag)
+			err1 := xrayAPI.DelInbound(tag)
 			if err1 == nil {
-				logger.Debug("Inbound disabled by api:", tag)
+				logger.WithFields(logger.Fields{"inbound": tag}).Debug("Inbound disabled by api")
 			} else {
 				logger.Debug("Error in disabling inbound by api:", err1)
 				needRestart = true
 			}
 		}
-		s.xrayApi.Close()
 	}
 
 	result := tx.Model(model.Inbound{}).
 		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
 		Update("enable", false)
-	err := result.Error
+	err = result.Error
 	count := result.RowsAffected
+	if err == nil {
+		for _, inbound := range invalidInbounds {
+			reason := "expired"
+			if inbound.Total > 0 && inbound.Up+inbound.Down >= inbound.Total {
+				reason = "depleted"
+			}
+			events.add(WebhookInboundDisabled, map[string]any{"inboundId": inbound.Id, "tag": inbound.Tag, "remark": inbound.Remark, "reason": reason})
+		}
+	}
 	return needRestart, count, err
 }
 
@@ -1148,9 +1189,9 @@ func (s *InboundService) collectClientOnlineIPs(email string) []string {
 	if ipLimitFw == nil || !ipLimitFw.Supported() {
 		return nil
 	}
-	ipMap, err := s.xrayApi.GetUserOnlineIpList(email)
+	ipMap, err := xrayAPI.GetUserOnlineIpList(email)
 	if err != nil {
-		logger.Debug("get online ip list failed for ", email, ": ", err)
+		logger.WithFields(logger.Fields{"email": email}).Debug("get online ip list failed: ", err)
 		return nil
 	}
 	ips := make([]string, 0, len(ipMap))
@@ -1160,10 +1201,21 @@ func (s *InboundService) collectClientOnlineIPs(email string) []string {
 	return ips
 }
 
-func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error) {
+func (s *InboundService) disableInvalidClients(tx *gorm.DB, events *webhookBatch) (bool, int64, error) {
 	now := time.Now().Unix() * 1000
 	needRestart := false
 
+	var invalidClients []*xray.ClientTraffic
+	err := tx.Model(xray.ClientTraffic{}).
+		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Find(&invalidClients).Error
+	if err != nil {
+		return false, 0, err
+	}
+	if len(invalidClients) == 0 {
+		return false, 0, nil
+	}
+
 	if p != nil {
 		var results []struct {
 			Tag   string
@@ -1179,12 +1231,12 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 		if err != nil {
 			return false, 0, err
 		}
-		s.xrayApi.Init(p.GetAPIAddr())
+		xrayAPI.Init(p.GetAPIAddr())
 		for _, result := range results {
 			onlineIPs := s.collectClientOnlineIPs(result.Email)
-			err1 := s.xrayApi.RemoveUser(result.Tag, result.Email)
+			err1 := xrayAPI.RemoveUser(result.Tag, result.Email)
 			if err1 == nil {
-				logger.Debug("Client disabled by api:", result.Email)
+				logger.WithFields(logger.Fields{"email": result.Email}).Debug("Client disabled by api")
 				blockIPsForPort(onlineIPs, uint16(result.Port))
 			} else {
 				if strings.Contains(err1.Error(), fmt.Sprintf("User %s not found.", result.Email)) {
@@ -1195,13 +1247,28 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 				}
 			}
 		}
-		s.xrayApi.Close()
 	}
 	result := tx.Model(xray.ClientTraffic{}).
 		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
 		Update("enable", false)
-	err := result.Error
+	err = result.Error
 	count := result.RowsAffected
+	if err == nil {
+		for _, client := range invalidClients {
+			event := WebhookClientExpired
+			if client.Total > 0 && client.Up+client.Down >= client.Total {
+				event = WebhookClientDepleted
+			}
+			events.add(event, map[string]any{
+				"inboundId":  client.InboundId,
+				"email":      client.Email,
+				"up":         client.Up,
+				"down":       client.Down,
+				"total":      client.Total,
+				"expiryTime": client.ExpiryTime,
+			})
+		}
+	}
 	return needRestart, count, err
 }
 
@@ -1257,7 +1324,7 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 		}
 		for _, client := range clients {
 			if client.Email == clientEmail && client.Enable {
-				s.xrayApi.Init(p.GetAPIAddr())
+				xrayAPI.Init(p.GetAPIAddr())
 				cipher := ""
 				if string(inbound.Protocol) == "shadowsocks" {
 					var oldSettings map[string]interface{}
@@ -1267,7 +1334,7 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 					}
 					cipher = oldSettings["method"].(string)
 				}
-				err1 := s.xrayApi.AddUser(string(inbound.Protocol), inbound.Tag, map[string]interface{}{
+				err1 := xrayAPI.AddUser(string(inbound.Protocol), inbound.Tag, map[string]interface{}{
 					"email":    client.Email,
 					"id":       client.ID,
 					"flow":     client.Flow,
@@ -1275,12 +1342,11 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 					"cipher":   cipher,
 				})
 				if err1 == nil {
-					logger.Debug("Client enabled due to reset traffic:", clientEmail)
+					logger.WithFields(logger.Fields{"email": clientEmail}).Debug("Client enabled due to reset traffic")
 				} else {
 					logger.Debug("Error in enabling client by api:", err1)
 					needRestart = true
 				}
-				s.xrayApi.Close()
 				break
 			}
 		}
@@ -1331,9 +1397,12 @@ func (s *InboundService) ResetAllTraffics() error {
 func (s *InboundService) DelDepletedClients(id int) (err error) {
 	db := database.GetDB()
 	tx := db.Begin()
+	var events webhookBatch
 	defer func() {
 		if err == nil {
-			tx.Commit()
+			if tx.Commit().Error == nil {
+				events.emit()
+			}
 		} else {
 			tx.Rollback()
 		}
@@ -1392,18 +1461,16 @@ func (s *InboundService) DelDepletedClients(id int) (err error) {
 			if err != nil {
 				return err
 			}
+			for _, email := range emails {
+				events.add(WebhookClientDeleted, map[string]any{"inboundId": depletedClient.InboundId, "email": email})
+			}
 		} else {
-			// Delete inbound if no client remains
+			// Delete inbound if no client remains, it announces the clients
 			s.DelInbound(depletedClient.InboundId)
 		}
 	}
 
-	err = tx.Where(whereText+" and enable = ?", id, false).Delete(xray.ClientTraffic{}).Error
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return tx.Where(whereText+" and enable = ?", id, false).Delete(xray.ClientTraffic{}).Error
 }
 
 func (s *InboundService) GetClientTrafficTgBot(tgid string, tguname string) ([]*xray.ClientTraffic, error) {
@@ -1441,6 +1508,55 @@ func (s *InboundService) GetClientTrafficByEmail(email string) (traffic *xray.Cl
 	return nil, nil
 }
 
+// UpdateClientByEmail applies modify to the settings of the client with
+// email and saves them like an edit of the client.
+func (s *InboundService) UpdateClientByEmail(email string, modify func(client map[string]any)) (bool, error) {
+	traffic, err := s.GetClientTrafficByEmail(email)
+	if err != nil {
+		return false, err
+	}
+	if traffic == nil {
+		return false, common.NewError("client not found:", email)
+	}
+	inbound, err := s.GetInbound(traffic.InboundId)
+	if err != nil {
+		return false, err
+	}
+	var settings map[string]any
+	err = json.Unmarshal([]byte(inbound.Settings), &settings)
+	if err != nil {
+		return false, err
+	}
+
+	clientKey := "id"
+	switch inbound.Protocol {
+	case "trojan":
+		clientKey = "password"
+	case "shadowsocks":
+		clientKey = "email"
+	case "hysteria":
+		clientKey = "auth"
+	}
+
+	clients, _ := settings["clients"].([]any)
+	for _, c := range clients {
+		client, ok := c.(map[string]any)
+		if !ok || client["email"] != email {
+			continue
+		}
+		clientId, _ := client[clientKey].(string)
+		modify(client)
+		newSettings, err := json.Marshal(map[string]any{"clients": []any{client}})
+		if err != nil {
+			return false, err
+		}
+		data := *inbound
+		data.Settings = string(newSettings)
+		return s.UpdateInboundClient(&data, clientId)
+	}
+	return false, common.NewError("client not found:", email)
+}
+
 func (s *InboundService) GetClientTrafficByID(id string) ([]xray.ClientTraffic, error) {
 	db := database.GetDB()
 	var traffics []xray.ClientTraffic
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/iplimit"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+)
+
+const (
+	IpAccessBan   = "ban"
+	IpAccessAllow = "allow"
+)
+
+var ipAccessState struct {
+	sync.Mutex
+	signature string
+}
+
+// parseIpAccessCidr accepts an address or a network in CIDR notation.
+func parseIpAccessCidr(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(strings.Trim(value, "[]"))
+		if ip == nil {
+			return nil, common.NewError("invalid ip:", value)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, common.NewError("invalid cidr:", value)
+	}
+	return network, nil
+}
+
+// RefreshIpAccess applies the manual ban and allow lists in the background.
+func RefreshIpAccess() {
+	go func() {
+		var ipAccessService IpAccessService
+		if err := ipAccessService.Apply(); err != nil {
+			logger.Warning("apply ip access lists failed:", err)
+		}
+	}()
+}
+
+type IpAccessService struct{}
+
+// List returns the rules that have not expired, newest first.
+func (s *IpAccessService) List() ([]*model.IpAccessRule, error) {
+	rules := make([]*model.IpAccessRule, 0)
+	err := database.GetDB().
+		Where("expires_at = 0 OR expires_at > ?", time.Now().Unix()).
+		Order("id desc").
+		Find(&rules).Error
+	return rules, err
+}
+
+// Ban blocks cidr on port, or on all ports if port is 0. The ban is lifted
+// after minutes, or never if minutes is 0.
+func (s *IpAccessService) Ban(cidr string, port uint16, minutes int, remark string) (*model.IpAccessRule, error) {
+	if minutes < 0 {
+		return nil, common.NewError("invalid ban duration:", minutes)
+	}
+	rule := &model.IpAccessRule{Type: IpAccessBan, Port: port, Remark: remark}
+	if minutes > 0 {
+		rule.ExpiresAt = time.Now().Add(time.Duration(minutes) * time.Minute).Unix()
+	}
+	return s.save(rule, cidr)
+}
+
+// Allow keeps cidr from ever being blocked by the ip limit, country rules
+// or bans.
+func (s *IpAccessService) Allow(cidr string, remark string) (*model.IpAccessRule, error) {
+	return s.save(&model.IpAccessRule{Type: IpAccessAllow, Remark: remark}, cidr)
+}
+
+// save stores rule, replacing a rule of the same type for the same network
+// and port.
+func (s *IpAccessService) save(rule *model.IpAccessRule, cidr string) (*model.IpAccessRule, error) {
+	network, err := parseIpAccessCidr(cidr)
+	if err != nil {
+		return nil, err
+	}
+	rule.Cidr = network.String()
+	rule.CreatedAt = time.Now().Unix()
+
+	db := database.GetDB()
+	existing := &model.IpAccessRule{}
+	err = db.Where("type = ? AND cidr = ? AND port = ?", rule.Type, rule.Cidr, rule.Port).First(existing).Error
+	if err == nil {
+		rule.Id = existing.Id
+	} else if !database.IsNotFound(err) {
+		return nil, err
+	}
+	if err := db.Save(rule).Error; err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *IpAccessService) Delete(id int64) error {
+	return database.GetDB().Delete(&model.IpAccessRule{}, id).Error
+}
+
+// Apply removes the expired rules and loads the others into the firewall.
+// Blocks of the ip limit on allowed addresses are lifted at once.
+func (s *IpAccessService) Apply() error {
+	if ipLimitFw == nil || !ipLimitFw.Supported() {
+		return nil
+	}
+	ipAccessState.Lock()
+	defer ipAccessState.Unlock()
+
+	db := database.GetDB()
+	err := db.Where("expires_at > 0 AND expires_at <= ?", time.Now().Unix()).
+		Delete(&model.IpAccessRule{}).Error
+	if err != nil {
+		return err
+	}
+	rules, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	bans := make([]iplimit.BanRule, 0)
+	allowed := make([]*net.IPNet, 0)
+	var signature strings.Builder
+	for _, rule := range rules {
+		network, err := parseIpAccessCidr(rule.Cidr)
+		if err != nil {
+			logger.Warning("skip ip access rule", rule.Id, ":", err)
+			continue
+		}
+		switch rule.Type {
+		case IpAccessBan:
+			bans = append(bans, iplimit.BanRule{Network: network, Port: rule.Port})
+		case IpAccessAllow:
+			allowed = append(allowed, network)
+		default:
+			continue
+		}
+		fmt.Fprintf(&signature, "%s:%s:%d;", rule.Type, rule.Cidr, rule.Port)
+	}
+
+	ipLimitMu.Lock()
+	ipAllowNets = allowed
+	unblock := make([]blockedKey, 0)
+	for key := range blockedIPs {
+		if ipAllowListed(key.IP) {
+			unblock = append(unblock, key)
+			delete(blockedIPs, key)
+		}
+	}
+	ipLimitMu.Unlock()
+	for _, key := range unblock {
+		if err := ipLimitFw.Unblock(iplimit.BlockKey{IP: key.IP, Port: key.Port}); err != nil {
+			logger.Debug("unblock ip failed:", err)
+		}
+	}
+
+	if signature.String() == ipAccessState.signature {
+		return nil
+	}
+	if err := ipLimitFw.SetAccessLists(bans, allowed); err != nil {
+		return err
+	}
+	ipAccessState.signature = signature.String()
+	return nil
+}
+
+// Unblock lifts the ip limit blocks of ip on port, or on all ports if port
+// is 0. A client that is still over its limit is blocked again on the next
+// check.
+func (s *IpAccessService) Unblock(ip string, port uint16) (int, error) {
+	if ipLimitFw == nil || !ipLimitFw.Supported() {
+		return 0, common.NewError("ip limit firewall is not supported")
+	}
+	addr := net.ParseIP(strings.Trim(strings.TrimSpace(ip), "[]"))
+	if addr == nil {
+		return 0, common.NewError("invalid ip:", ip)
+	}
+
+	ipLimitMu.Lock()
+	keys := make([]blockedKey, 0)
+	for key := range blockedIPs {
+		if (port == 0 || key.Port == port) && addr.Equal(net.ParseIP(strings.Trim(key.IP, "[]"))) {
+			keys = append(keys, key)
+			delete(blockedIPs, key)
+		}
+	}
+	ipLimitMu.Unlock()
+	if len(keys) == 0 {
+		return 0, common.NewError("ip is not blocked:", ip)
+	}
+
+	for _, key := range keys {
+		if err := ipLimitFw.Unblock(iplimit.BlockKey{IP: key.IP, Port: key.Port}); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/logger"
+
+	"gorm.io/gorm"
+)
+
+var ipLimitState struct {
+	sync.Mutex
+	signature string
+}
+
+// SaveIpLimitState checkpoints the blocks, slots and offenses of the ip
+// limit so a restart of the panel does not lift them. Nothing is written
+// while the state is the same as on the last save.
+func SaveIpLimitState() error {
+	if ipLimitFw == nil || !ipLimitFw.Supported() {
+		return nil
+	}
+	ipLimitState.Lock()
+	defer ipLimitState.Unlock()
+
+	now := time.Now().Unix()
+	blocks := make([]*model.IpLimitBlock, 0)
+	clients := make(map[string]*model.IpLimitClient)
+	ipLimitMu.RLock()
+	for key, entry := range blockedIPs {
+		if entry.Deadline > now {
+			blocks = append(blocks, &model.IpLimitBlock{Ip: key.IP, Port: key.Port, Email: entry.Email, ExpiresAt: entry.Deadline})
+		}
+	}
+	for email, state := range ipLimitClients {
+		if len(state.Allowed) == 0 {
+			continue
+		}
+		units := make([]string, 0, len(state.Allowed))
+		for unit := range state.Allowed {
+			units = append(units, unit)
+		}
+		sort.Strings(units)
+		clients[email] = &model.IpLimitClient{Email: email, Allowed: strings.Join(units, ",")}
+	}
+	for email, offense := range ipLimitOffenses {
+		client, ok := clients[email]
+		if !ok {
+			client = &model.IpLimitClient{Email: email}
+			clients[email] = client
+		}
+		client.Offenses = offense.count
+		client.LastOffense = offense.last
+	}
+	ipLimitMu.RUnlock()
+
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].Ip == blocks[j].Ip {
+			return blocks[i].Port < blocks[j].Port
+		}
+		return blocks[i].Ip < blocks[j].Ip
+	})
+	emails := make([]string, 0, len(clients))
+	for email := range clients {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	var signature strings.Builder
+	for _, block := range blocks {
+		fmt.Fprintf(&signature, "%s:%d:%s:%d;", block.Ip, block.Port, block.Email, block.ExpiresAt)
+	}
+	for _, email := range emails {
+		client := clients[email]
+		fmt.Fprintf(&signature, "%s:%s:%d:%d;", email, client.Allowed, client.Offenses, client.LastOffense)
+	}
+	if signature.String() == ipLimitState.signature {
+		return nil
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&model.IpLimitBlock{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("1 = 1").Delete(&model.IpLimitClient{}).Error; err != nil {
+			return err
+		}
+		if len(blocks) > 0 {
+			if err := tx.CreateInBatches(blocks, 100).Error; err != nil {
+				return err
+			}
+		}
+		for _, email := range emails {
+			if err := tx.Create(clients[email]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ipLimitState.signature = signature.String()
+	return nil
+}
+
+// restoreIpLimitState loads the saved state into the store. Expired blocks
+// and offenses are dropped, slots are only restored for clients that still
+// have an ip limit. The caller applies the blocks to the firewall.
+func restoreIpLimitState() error {
+	db := database.GetDB()
+	now := time.Now().Unix()
+	var blocks []*model.IpLimitBlock
+	if err := db.Where("expires_at > ?", now).Find(&blocks).Error; err != nil {
+		return err
+	}
+	var clients []*model.IpLimitClient
+	if err := db.Find(&clients).Error; err != nil {
+		return err
+	}
+
+	ipLimitMu.Lock()
+	defer ipLimitMu.Unlock()
+	for _, block := range blocks {
+		blockedIPs[blockedKey{IP: block.Ip, Port: block.Port}] = blockedEntry{Email: block.Email, Deadline: block.ExpiresAt}
+	}
+	for _, client := range clients {
+		if client.Offenses > 0 && now-client.LastOffense <= int64(ipLimitOffenseWindow.Seconds()) {
+			ipLimitOffenses[client.Email] = &ipLimitOffense{count: client.Offenses, last: client.LastOffense}
+		}
+		state, ok := ipLimitClients[client.Email]
+		if !ok || client.Allowed == "" {
+			continue
+		}
+		state.Allowed = make(map[string]struct{})
+		for _, unit := range strings.Split(client.Allowed, ",") {
+			if len(state.Allowed) < int(state.IpLimit) {
+				state.Allowed[unit] = struct{}{}
+			}
+		}
+	}
+	if len(blocks) > 0 {
+		logger.Infof("restored %d ip limit block(s)", len(blocks))
+	}
+	return nil
+}
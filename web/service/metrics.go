@@ -0,0 +1,120 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/alireza0/x-ui/web/metrics"
+)
+
+var (
+	metricsStatusMu   sync.Mutex
+	metricsLastStatus *Status
+)
+
+type MetricsService struct {
+	serverService   ServerService
+	inboundService  InboundService
+	outboundService OutboundService
+	xrayService     XrayService
+	settingService  SettingService
+}
+
+// Collect gathers the panel and proxy metrics into w.
+func (s *MetricsService) Collect(w *metrics.Writer) error {
+	s.collectStatus(w)
+	s.collectXray(w)
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	withClients, _ := s.settingService.GetMetricsClients()
+	for _, inbound := range inbounds {
+		labels := []string{"id", strconv.Itoa(inbound.Id), "tag", inbound.Tag, "remark", inbound.Remark, "protocol", string(inbound.Protocol), "port", strconv.Itoa(inbound.Port)}
+		w.Counter("xui_inbound_up_bytes_total", "Uploaded bytes of an inbound.", float64(inbound.Up), labels...)
+		w.Counter("xui_inbound_down_bytes_total", "Downloaded bytes of an inbound.", float64(inbound.Down), labels...)
+		w.Gauge("xui_inbound_enabled", "Whether an inbound is enabled.", boolValue(inbound.Enable), labels...)
+		w.Gauge("xui_inbound_clients", "Number of clients of an inbound.", float64(len(inbound.ClientStats)), labels...)
+		if !withClients {
+			continue
+		}
+		for _, client := range inbound.ClientStats {
+			clientLabels := []string{"email", client.Email, "inbound", inbound.Tag}
+			w.Counter("xui_client_up_bytes_total", "Uploaded bytes of a client.", float64(client.Up), clientLabels...)
+			w.Counter("xui_client_down_bytes_total", "Downloaded bytes of a client.", float64(client.Down), clientLabels...)
+			w.Gauge("xui_client_quota_bytes", "Traffic quota of a client, 0 means unlimited.", float64(client.Total), clientLabels...)
+			w.Gauge("xui_client_expiry_timestamp_seconds", "Expiry time of a client, 0 means never.", float64(client.ExpiryTime)/1000, clientLabels...)
+			w.Gauge("xui_client_enabled", "Whether a client is enabled.", boolValue(client.Enable), clientLabels...)
+		}
+	}
+
+	outbounds, err := s.outboundService.GetAllOutbounds()
+	if err != nil {
+		return err
+	}
+	for _, outbound := range outbounds {
+		labels := []string{"tag", outbound.Tag, "protocol", outbound.Protocol}
+		w.Counter("xui_outbound_up_bytes_total", "Uploaded bytes of an outbound.", float64(outbound.Up), labels...)
+		w.Counter("xui_outbound_down_bytes_total", "Downloaded bytes of an outbound.", float64(outbound.Down), labels...)
+	}
+
+	w.Gauge("xui_online_clients", "Number of clients currently online.", float64(len(GetOnlineUsersCache())))
+	w.Gauge("xui_iplimit_blocked_ips", "Number of IPs currently blocked by the IP limit.", float64(GetBlockedCount()))
+
+	for _, stat := range metrics.GetJobStats() {
+		w.Counter("xui_job_runs_total", "Number of runs of a background job.", float64(stat.Runs), "job", stat.Name)
+		w.Gauge("xui_job_last_duration_seconds", "Duration of the last run of a background job.", stat.LastDuration.Seconds(), "job", stat.Name)
+		w.Counter("xui_job_duration_seconds_total", "Total run time of a background job.", stat.TotalTime.Seconds(), "job", stat.Name)
+		w.Gauge("xui_job_last_run_timestamp_seconds", "Start time of the last run of a background job.", float64(stat.LastRun.Unix()), "job", stat.Name)
+	}
+	return nil
+}
+
+func (s *MetricsService) collectStatus(w *metrics.Writer) {
+	metricsStatusMu.Lock()
+	status := s.serverService.GetStatus(metricsLastStatus)
+	metricsLastStatus = status
+	metricsStatusMu.Unlock()
+
+	w.Gauge("xui_cpu_usage_percent", "CPU usage of the host in percent.", status.Cpu)
+	w.Gauge("xui_cpu_count", "Number of logical CPUs.", float64(status.CpuCount))
+	w.Gauge("xui_memory_used_bytes", "Used memory of the host.", float64(status.Mem.Current))
+	w.Gauge("xui_memory_total_bytes", "Total memory of the host.", float64(status.Mem.Total))
+	w.Gauge("xui_swap_used_bytes", "Used swap of the host.", float64(status.Swap.Current))
+	w.Gauge("xui_swap_total_bytes", "Total swap of the host.", float64(status.Swap.Total))
+	w.Gauge("xui_disk_used_bytes", "Used space of the root filesystem.", float64(status.Disk.Current))
+	w.Gauge("xui_disk_total_bytes", "Total space of the root filesystem.", float64(status.Disk.Total))
+	w.Gauge("xui_host_uptime_seconds", "Uptime of the host.", float64(status.Uptime))
+	periods := []string{"1", "5", "15"}
+	for i, load := range status.Loads {
+		if i < len(periods) {
+			w.Gauge("xui_load_average", "System load average.", load, "period", periods[i])
+		}
+	}
+	w.Gauge("xui_tcp_connections", "Number of TCP connections.", float64(status.TcpCount))
+	w.Gauge("xui_udp_connections", "Number of UDP connections.", float64(status.UdpCount))
+	w.Gauge("xui_network_speed_bytes_per_second", "Network throughput of the host.", float64(status.NetIO.Up), "direction", "up")
+	w.Gauge("xui_network_speed_bytes_per_second", "Network throughput of the host.", float64(status.NetIO.Down), "direction", "down")
+	w.Counter("xui_network_bytes_total", "Network traffic of the host since boot.", float64(status.NetTraffic.Sent), "direction", "sent")
+	w.Counter("xui_network_bytes_total", "Network traffic of the host since boot.", float64(status.NetTraffic.Recv), "direction", "recv")
+	w.Gauge("xui_app_goroutines", "Number of goroutines of the panel.", float64(status.AppStats.Threads))
+	w.Gauge("xui_app_memory_bytes", "Memory obtained from the OS by the panel.", float64(status.AppStats.Mem))
+	w.Gauge("xui_xray_info", "Xray version and state.", 1, "version", status.Xray.Version, "state", string(status.Xray.State))
+	w.Gauge("xui_xray_uptime_seconds", "Uptime of the xray process.", float64(status.AppStats.Uptime))
+}
+
+func (s *MetricsService) collectXray(w *metrics.Writer) {
+	w.Gauge("xui_xray_up", "Whether xray is running.", boolValue(s.xrayService.IsXrayRunning()))
+	state := s.xrayService.GetSupervisorState()
+	w.Counter("xui_xray_crashes_total", "Unexpected xray exits since the panel started.", float64(state.Crashes))
+	w.Gauge("xui_xray_crash_loop", "Whether xray is crash-looping.", boolValue(state.CrashLoop))
+	w.Gauge("xui_xray_rolled_back", "Whether xray runs the last known-good config.", boolValue(state.RolledBack))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
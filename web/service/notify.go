@@ -0,0 +1,414 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/web/locale"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Notification events that can be routed to channels.
+const (
+	NotifyLogin     = "login"
+	NotifyBackup    = "backup"
+	NotifyReport    = "report"
+	NotifyCpu       = "cpu"
+	NotifyDepleted  = "depleted"
+	NotifyExpiring  = "expiring"
+	NotifyXrayCrash = "xray_crash"
+	NotifyAlert     = "alert"
+	NotifySharing   = "sharing"
+	NotifyCert      = "cert"
+	NotifyTest      = "test"
+)
+
+const (
+	ChannelTelegram = "telegram"
+	ChannelWebhook  = "webhook"
+	ChannelEmail    = "email"
+)
+
+// Notification is a message for the admins. Message is formatted with the
+// HTML subset understood by Telegram, Files are paths of attachments.
+type Notification struct {
+	Event   string
+	Message string
+	Files   []string
+	Time    time.Time
+}
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// Text returns the message without HTML markup.
+func (n *Notification) Text() string {
+	text := htmlTagRegex.ReplaceAllString(n.Message, "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+type Notifier interface {
+	Name() string
+	Send(n *Notification) error
+}
+
+// TelegramNotifier sends to the admins of the running bot.
+type TelegramNotifier struct{}
+
+func (t *TelegramNotifier) Name() string {
+	return ChannelTelegram
+}
+
+func (t *TelegramNotifier) Send(n *Notification) error {
+	if !isRunning {
+		return common.NewError("telegram bot is not running")
+	}
+	tgbot := &Tgbot{}
+	// a file Telegram refuses must not keep the others from the admins
+	var errs []error
+	for _, adminId := range adminIds {
+		tgbot.SendMsgToTgbot(adminId, n.Message)
+		for _, file := range n.Files {
+			_, err := bot.Send(tgbotapi.NewDocument(adminId, tgbotapi.FilePath(file)))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s to %d: %w", filepath.Base(file), adminId, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WebhookNotifier posts the notification as JSON. With a secret the body is
+// signed with HMAC-SHA256 in the X-XUI-Signature header.
+type WebhookNotifier struct {
+	Url    string
+	Secret string
+	Client *http.Client
+}
+
+func (w *WebhookNotifier) Name() string {
+	return ChannelWebhook
+}
+
+func (w *WebhookNotifier) Send(n *Notification) error {
+	files := make([]string, 0, len(n.Files))
+	for _, file := range n.Files {
+		files = append(files, filepath.Base(file))
+	}
+	body, err := json.Marshal(map[string]any{
+		"event":    n.Event,
+		"hostname": hostname,
+		"time":     n.Time.Unix(),
+		"message":  n.Text(),
+		"html":     n.Message,
+		"files":    files,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-XUI-Event", n.Event)
+	if w.Secret != "" {
+		req.Header.Set("X-XUI-Signature", signPayload(w.Secret, body))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return common.NewErrorf("webhook %s returned %s", w.Url, resp.Status)
+	}
+	return nil
+}
+
+// signPayload returns the X-XUI-Signature header value for body.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+const smtpDialTimeout = 10 * time.Second
+
+// smtpTimeout bounds a whole SMTP conversation.
+var smtpTimeout = time.Minute
+
+// EmailNotifier sends mails over SMTP. Port 465 uses implicit TLS, other
+// ports upgrade with STARTTLS when the server offers it.
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (e *EmailNotifier) Name() string {
+	return ChannelEmail
+}
+
+func (e *EmailNotifier) Send(n *Notification) error {
+	msg, err := e.buildMessage(n)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	var conn net.Conn
+	if e.Port == 465 {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpDialTimeout}, "tcp", addr, &tls.Config{ServerName: e.Host})
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpDialTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	// a stalled server must not hold the notification queue forever
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if e.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: e.Host}); err != nil {
+				return err
+			}
+		}
+	}
+	if e.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return common.NewError("smtp server does not support authentication:", e.Host)
+		}
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (e *EmailNotifier) buildMessage(n *Notification) ([]byte, error) {
+	var buf bytes.Buffer
+	subject := "x-ui " + n.Event
+	if hostname != "" {
+		subject += " on " + hostname
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", e.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	text := strings.ReplaceAll(n.Text(), "\n", "\r\n")
+	if len(n.Files) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(text + "\r\n")
+		return buf.Bytes(), nil
+	}
+
+	boundary := fmt.Sprintf("x-ui-%d", n.Time.UnixNano())
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, text)
+	for _, file := range n.Files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(file)
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		buf.WriteString("Content-Type: application/octet-stream\r\n")
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(&buf, "Content-Disposition: attachment; filename=%q\r\n\r\n", name)
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			buf.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		buf.WriteString(encoded + "\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+type NotifyService struct {
+	settingService SettingService
+}
+
+// GetNotifiers returns the configured channels by name.
+func (s *NotifyService) GetNotifiers() map[string]Notifier {
+	notifiers := map[string]Notifier{
+		ChannelTelegram: &TelegramNotifier{},
+	}
+
+	webhookUrl, err := s.settingService.GetNotifyWebhookUrl()
+	if err == nil && webhookUrl != "" {
+		secret, _ := s.settingService.GetNotifyWebhookSecret()
+		notifiers[ChannelWebhook] = &WebhookNotifier{Url: webhookUrl, Secret: secret}
+	}
+
+	smtpHost, err := s.settingService.GetNotifySmtpHost()
+	if err == nil && smtpHost != "" {
+		email := &EmailNotifier{Host: smtpHost}
+		email.Port, _ = s.settingService.GetNotifySmtpPort()
+		email.Username, _ = s.settingService.GetNotifySmtpUser()
+		email.Password, _ = s.settingService.GetNotifySmtpPassword()
+		email.From, _ = s.settingService.GetNotifySmtpFrom()
+		to, _ := s.settingService.GetNotifySmtpTo()
+		for _, addr := range strings.Split(to, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				email.To = append(email.To, addr)
+			}
+		}
+		if email.From == "" {
+			email.From = email.Username
+		}
+		if len(email.To) > 0 {
+			notifiers[ChannelEmail] = email
+		}
+	}
+	return notifiers
+}
+
+// IsEnabled reports whether any channel can deliver notifications.
+func (s *NotifyService) IsEnabled() bool {
+	if enabled, err := s.settingService.GetTgbotenabled(); err == nil && enabled {
+		return true
+	}
+	return len(s.GetNotifiers()) > 1
+}
+
+// GetRoute returns the channels of event. Events without a route use the
+// "*" route, or Telegram if there is none.
+func (s *NotifyService) GetRoute(event string) []string {
+	routesJson, err := s.settingService.GetNotifyRoutes()
+	if err != nil {
+		return []string{ChannelTelegram}
+	}
+	routes := make(map[string][]string)
+	if strings.TrimSpace(routesJson) != "" {
+		if err := json.Unmarshal([]byte(routesJson), &routes); err != nil {
+			logger.Warning("parse notify routes failed:", err)
+		}
+	}
+	if route, ok := routes[event]; ok {
+		return route
+	}
+	if route, ok := routes["*"]; ok {
+		return route
+	}
+	return []string{ChannelTelegram}
+}
+
+// notifyQueueSize bounds the notifications waiting for delivery.
+const notifyQueueSize = 100
+
+var (
+	notifyQueue     chan *Notification
+	notifyQueueOnce sync.Once
+)
+
+// Notify queues msg for every channel routed for event and returns at once,
+// so a slow channel never holds up the caller. Notifications are delivered
+// one at a time in order and failures are logged.
+func (s *NotifyService) Notify(event string, msg string, files ...string) {
+	if msg == "" {
+		return
+	}
+	notifyQueueOnce.Do(func() {
+		notifyQueue = make(chan *Notification, notifyQueueSize)
+		go func() {
+			var notifyService NotifyService
+			for n := range notifyQueue {
+				notifyService.deliver(n)
+			}
+		}()
+	})
+	n := &Notification{Event: event, Message: msg, Files: files, Time: time.Now()}
+	select {
+	case notifyQueue <- n:
+	default:
+		logger.Warning("notification queue is full, dropped a", event, "notification")
+	}
+}
+
+func (s *NotifyService) deliver(n *Notification) {
+	notifiers := s.GetNotifiers()
+	for _, name := range s.GetRoute(n.Event) {
+		notifier, ok := notifiers[name]
+		if !ok {
+			continue
+		}
+		if name == ChannelTelegram && !isRunning {
+			continue
+		}
+		if err := notifier.Send(n); err != nil {
+			logger.Warningf("send %s notification to %s failed: %v", n.Event, name, err)
+		}
+	}
+}
+
+// Test sends a test notification to one channel and returns its error.
+func (s *NotifyService) Test(channel string) error {
+	notifier, ok := s.GetNotifiers()[channel]
+	if !ok {
+		return common.NewError("notification channel is not configured:", channel)
+	}
+	msg := locale.I18n(locale.Bot, "tgbot.messages.notifyTest", "Hostname=="+hostname)
+	return notifier.Send(&Notification{Event: NotifyTest, Message: msg, Time: time.Now()})
+}
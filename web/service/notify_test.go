@@ -0,0 +1,182 @@
+package service
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifierSend(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Url: server.URL, Secret: "s3cret"}
+	n := &Notification{Event: NotifyLogin, Message: "<b>admin</b> logged in &amp; out", Time: time.Unix(1700000000, 0)}
+	if err := notifier.Send(n); err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get("X-XUI-Signature") != want {
+		t.Errorf("signature %q, want %q", header.Get("X-XUI-Signature"), want)
+	}
+	if header.Get("X-XUI-Event") != NotifyLogin || header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", header)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["event"] != NotifyLogin || payload["message"] != "admin logged in & out" ||
+		payload["html"] != n.Message || payload["time"] != float64(1700000000) {
+		t.Errorf("unexpected payload %s", body)
+	}
+}
+
+func TestWebhookNotifierSendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Url: server.URL}
+	if err := notifier.Send(&Notification{Event: NotifyTest, Message: "test"}); err == nil {
+		t.Error("a failed delivery returned no error")
+	}
+}
+
+// smtpSink accepts one mail and returns its envelope and data.
+func smtpSink(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		lines := make([]string, 0)
+		io.WriteString(conn, "220 sink ready\r\n")
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if inData {
+				if line == "." {
+					inData = false
+					io.WriteString(conn, "250 queued\r\n")
+					continue
+				}
+				lines = append(lines, line)
+				continue
+			}
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				io.WriteString(conn, "250 sink\r\n")
+			case line == "DATA":
+				inData = true
+				io.WriteString(conn, "354 go ahead\r\n")
+			case line == "QUIT":
+				io.WriteString(conn, "221 bye\r\n")
+				received <- lines
+				return
+			default:
+				io.WriteString(conn, "250 ok\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestEmailNotifierSend(t *testing.T) {
+	addr, received := smtpSink(t)
+	host, port, _ := net.SplitHostPort(addr)
+	notifier := &EmailNotifier{Host: host, From: "panel@example.com", To: []string{"admin@example.com", "ops@example.com"}}
+	notifier.Port, _ = net.LookupPort("tcp", port)
+
+	n := &Notification{Event: NotifyAlert, Message: "cpu is <b>high</b>", Time: time.Now()}
+	if err := notifier.Send(n); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	select {
+	case lines = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+	mail := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<panel@example.com>",
+		"RCPT TO:<admin@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"To: admin@example.com, ops@example.com",
+		"Subject: x-ui alert",
+		"Content-Type: text/plain; charset=utf-8",
+		"cpu is high",
+	} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("mail is missing %q:\n%s", want, mail)
+		}
+	}
+}
+
+func TestEmailNotifierTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { smtpTimeout = timeout }(smtpTimeout)
+	smtpTimeout = 200 * time.Millisecond
+
+	// a server that accepts but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	notifier := &EmailNotifier{Host: host, From: "panel@example.com", To: []string{"admin@example.com"}}
+	notifier.Port, _ = net.LookupPort("tcp", port)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- notifier.Send(&Notification{Event: NotifyTest, Message: "test", Time: time.Now()})
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("a silent server returned no error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send did not time out")
+	}
+}
@@ -1,13 +1,17 @@
 package service
 
 import (
+	"net"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/alireza0/x-ui/database/model"
 	"github.com/alireza0/x-ui/iplimit"
 	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/geoip"
+	"github.com/alireza0/x-ui/web/events"
 	"github.com/alireza0/x-ui/xray"
 )
 
@@ -16,7 +20,9 @@ var (
 	onlineUsers        []xray.OnlineUserInfo
 	ipLimitMu          sync.RWMutex
 	ipLimitClients     map[string]*IpLimitClientState
-	blockedIPs         map[blockedKey]int64
+	blockedIPs         map[blockedKey]blockedEntry
+	ipAllowNets        []*net.IPNet
+	ipLimitOffenses    map[string]*ipLimitOffense
 	ipLimitFw          iplimit.Firewall
 	ipBlockAfterRemove bool
 )
@@ -26,10 +32,50 @@ type blockedKey struct {
 	Port uint16
 }
 
+// blockedEntry is the client that caused a block and when it ends.
+type blockedEntry struct {
+	Email    string
+	Deadline int64
+}
+
+// BlockedIp is one address blocked by the ip limit.
+type BlockedIp struct {
+	Ip        string      `json:"ip"`
+	Port      uint16      `json:"port"`
+	Email     string      `json:"email"`
+	ExpiresAt int64       `json:"expiresAt"`
+	Geo       *geoip.Info `json:"geo,omitempty"`
+}
+
+// Strategies for clients over their ip limit.
+const (
+	IpLimitNewest = "newest"
+	IpLimitLru    = "lru"
+	IpLimitSubnet = "subnet"
+)
+
+// Repeat offenses of a client are forgotten after a day without a block.
+const ipLimitOffenseWindow = 24 * time.Hour
+
+// ipLimitPolicy is the global handling of clients over their ip limit.
+type ipLimitPolicy struct {
+	Strategy    string
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+type ipLimitOffense struct {
+	count int
+	last  int64
+}
+
 type IpLimitClientState struct {
-	IpLimit uint16
-	Port    uint16
-	IPs     []string
+	IpLimit  uint16
+	Port     uint16
+	Strategy string
+	IPs      []string
+	// Allowed holds the addresses, or networks with IpLimitSubnet, that
+	// may connect.
 	Allowed map[string]struct{}
 }
 
@@ -37,6 +83,7 @@ type IpLimitClientUpdate struct {
 	Email         string
 	LimitIP       uint16
 	Port          uint16
+	Strategy      string
 	ClientEnable  bool
 	StatEnable    bool
 	InboundEnable bool
@@ -60,14 +107,52 @@ func cloneOnlineUsers(users []xray.OnlineUserInfo) []xray.OnlineUserInfo {
 
 func SetOnlineUsersCache(users []xray.OnlineUserInfo) {
 	onlineUsersMu.Lock()
+	previous := onlineUsers
 	onlineUsers = cloneOnlineUsers(users)
 	onlineUsersMu.Unlock()
+
+	recordIpHistory(users)
+
+	publishOnlineTransitions(previous, users)
+}
+
+// publishOnlineTransitions sends the emails that came online or went offline
+// between two snapshots of the online users cache.
+func publishOnlineTransitions(previous, current []xray.OnlineUserInfo) {
+	if !events.HasSubscribers() {
+		return
+	}
+	before := make(map[string]bool, len(previous))
+	for _, u := range previous {
+		before[u.Email] = true
+	}
+	online := make([]string, 0)
+	for _, u := range current {
+		if !before[u.Email] {
+			online = append(online, u.Email)
+		}
+		delete(before, u.Email)
+	}
+	offline := make([]string, 0, len(before))
+	for email := range before {
+		offline = append(offline, email)
+	}
+	if len(online) == 0 && len(offline) == 0 {
+		return
+	}
+	events.Publish(events.Online, map[string]any{
+		"online":  online,
+		"offline": offline,
+		"count":   len(current),
+	})
 }
 
 func GetOnlineUsersCache() []xray.OnlineUserInfo {
 	onlineUsersMu.RLock()
-	defer onlineUsersMu.RUnlock()
-	return cloneOnlineUsers(onlineUsers)
+	users := cloneOnlineUsers(onlineUsers)
+	onlineUsersMu.RUnlock()
+	enrichOnlineUsers(users)
+	return users
 }
 
 func ClearOnlineUsersCache() {
@@ -78,12 +163,20 @@ func InitOnlineStore(fw iplimit.Firewall, blockAfterRemove bool) error {
 	ipLimitFw = fw
 	ipBlockAfterRemove = blockAfterRemove
 	ipLimitClients = make(map[string]*IpLimitClientState)
-	blockedIPs = make(map[blockedKey]int64)
+	blockedIPs = make(map[blockedKey]blockedEntry)
+	ipLimitOffenses = make(map[string]*ipLimitOffense)
 
 	var inboundService InboundService
 	if err := RefreshIpLimitClients(&inboundService); err != nil {
 		return err
 	}
+	if !fw.Supported() {
+		return nil
+	}
+	if err := restoreIpLimitState(); err != nil {
+		return err
+	}
+	reapplyBlocks()
 	return nil
 }
 
@@ -116,9 +209,10 @@ func RefreshIpLimitClients(inboundService *InboundService) error {
 			}
 			ipLimitMu.RUnlock()
 			newMap[client.Email] = &IpLimitClientState{
-				IpLimit: client.LimitIP,
-				Port:    uint16(inbound.Port),
-				IPs:     existingIPs,
+				IpLimit:  client.LimitIP,
+				Port:     uint16(inbound.Port),
+				Strategy: client.IpStrategy,
+				IPs:      existingIPs,
 			}
 		}
 	}
@@ -139,6 +233,7 @@ func ipLimitUpdatesFromClients(inbound *model.Inbound, clients []model.Client) [
 			Email:         client.Email,
 			LimitIP:       uint16(client.LimitIP),
 			Port:          uint16(inbound.Port),
+			Strategy:      client.IpStrategy,
 			ClientEnable:  client.Enable,
 			StatEnable:    isClientStatEnabled(inbound, client.Email),
 			InboundEnable: inbound.Enable,
@@ -188,9 +283,10 @@ func applyIpLimitMemoryChanges(updates []IpLimitClientUpdate, removeEmails []str
 			}
 		}
 		ipLimitClients[update.Email] = &IpLimitClientState{
-			IpLimit: update.LimitIP,
-			Port:    update.Port,
-			IPs:     existingIPs,
+			IpLimit:  update.LimitIP,
+			Port:     update.Port,
+			Strategy: update.Strategy,
+			IPs:      existingIPs,
 		}
 	}
 }
@@ -206,8 +302,9 @@ func blockIPsForPort(ips []string, port uint16) {
 	if len(ips) == 0 || !ipBlockAfterRemove || ipLimitFw == nil || !ipLimitFw.Supported() {
 		return
 	}
+	duration := loadIpLimitPolicy().Duration
 	for _, ip := range ips {
-		if err := ipLimitFw.Block(iplimit.BlockKey{IP: ip, Port: port}); err != nil {
+		if err := ipLimitFw.Block(iplimit.BlockKey{IP: ip, Port: port}, duration); err != nil {
 			logger.Debug("block ip failed:", err)
 		}
 	}
@@ -244,7 +341,63 @@ func sortIPsByLastSeen(ips map[string]int64) []string {
 	return result
 }
 
-func updateIpLimitOnlineIPs(onlineUsers []xray.OnlineUserInfo) {
+// loadIpLimitPolicy reads the ip limit settings, invalid values fall back
+// to the defaults.
+func loadIpLimitPolicy() ipLimitPolicy {
+	var settingService SettingService
+	policy := ipLimitPolicy{
+		Strategy:    IpLimitNewest,
+		Duration:    iplimit.BlockDuration,
+		MaxDuration: time.Hour,
+	}
+	if strategy, err := settingService.GetIpLimitStrategy(); err == nil {
+		policy.Strategy = strategy
+	}
+	if seconds, err := settingService.GetIpBlockDuration(); err == nil && seconds > 0 {
+		policy.Duration = time.Duration(seconds) * time.Second
+	}
+	if seconds, err := settingService.GetIpBlockMaxDuration(); err == nil && seconds > 0 {
+		policy.MaxDuration = time.Duration(seconds) * time.Second
+	}
+	policy.MaxDuration = max(policy.MaxDuration, policy.Duration)
+	return policy
+}
+
+// escalate records an offense of email and returns its block duration,
+// which doubles for each repeat offense up to MaxDuration. The caller holds
+// ipLimitMu.
+func (p ipLimitPolicy) escalate(email string, now time.Time) time.Duration {
+	offense := ipLimitOffenses[email]
+	if offense == nil || now.Unix()-offense.last > int64(ipLimitOffenseWindow.Seconds()) {
+		offense = &ipLimitOffense{}
+		ipLimitOffenses[email] = offense
+	}
+	offense.count++
+	offense.last = now.Unix()
+	duration := p.Duration
+	for i := 1; i < offense.count && duration < p.MaxDuration; i++ {
+		duration *= 2
+	}
+	return min(duration, p.MaxDuration)
+}
+
+// ipLimitUnit returns what counts against the limit for ip: the address,
+// or its /24 or /64 network with IpLimitSubnet.
+func ipLimitUnit(ip string, strategy string) string {
+	if strategy != IpLimitSubnet {
+		return ip
+	}
+	addr := net.ParseIP(strings.Trim(ip, "[]"))
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return addr.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+func updateIpLimitOnlineIPs(onlineUsers []xray.OnlineUserInfo, policy ipLimitPolicy) {
 	onlineMap := make(map[string]xray.OnlineUserInfo, len(onlineUsers))
 	for _, user := range onlineUsers {
 		onlineMap[user.Email] = user
@@ -253,7 +406,12 @@ func updateIpLimitOnlineIPs(onlineUsers []xray.OnlineUserInfo) {
 	ipLimitMu.Lock()
 	defer ipLimitMu.Unlock()
 
-	deadline := time.Now().Add(iplimit.BlockDuration).Unix()
+	now := time.Now()
+	for email, offense := range ipLimitOffenses {
+		if now.Unix()-offense.last > int64(ipLimitOffenseWindow.Seconds()) {
+			delete(ipLimitOffenses, email)
+		}
+	}
 
 	for email, state := range ipLimitClients {
 		if state.Allowed == nil {
@@ -262,70 +420,156 @@ func updateIpLimitOnlineIPs(onlineUsers []xray.OnlineUserInfo) {
 		info, online := onlineMap[email]
 		if !online {
 			state.IPs = nil
-			for ip := range state.Allowed {
-				delete(state.Allowed, ip)
+			for unit := range state.Allowed {
+				delete(state.Allowed, unit)
 			}
 			continue
 		}
 
-		for ip := range state.Allowed {
-			if _, ok := info.IPs[ip]; !ok {
-				delete(state.Allowed, ip)
+		strategy := state.Strategy
+		if strategy == "" {
+			strategy = policy.Strategy
+		}
+		ordered := sortIPsByLastSeen(info.IPs)
+		state.IPs = ordered
+
+		// Addresses in the allow list are never blocked and do not use a slot.
+		units := make(map[string]string, len(ordered))
+		present := make(map[string]struct{}, len(ordered))
+		for _, ip := range ordered {
+			if !ipAllowListed(ip) {
+				units[ip] = ipLimitUnit(ip, strategy)
+				present[units[ip]] = struct{}{}
+			}
+		}
+		for unit := range state.Allowed {
+			if _, ok := present[unit]; !ok {
+				delete(state.Allowed, unit)
 			}
 		}
 
 		limit := int(state.IpLimit)
-		ordered := sortIPsByLastSeen(info.IPs)
-		state.IPs = ordered
+		if strategy == IpLimitLru {
+			// The most recently seen units win, older ones are evicted.
+			for unit := range state.Allowed {
+				delete(state.Allowed, unit)
+			}
+			for i := len(ordered) - 1; i >= 0 && len(state.Allowed) < limit; i-- {
+				if unit, ok := units[ordered[i]]; ok {
+					state.Allowed[unit] = struct{}{}
+				}
+			}
+		}
+
+		var duration time.Duration
 		for _, ip := range ordered {
-			if _, ok := state.Allowed[ip]; ok {
+			unit, ok := units[ip]
+			if !ok {
+				continue
+			}
+			if _, ok := state.Allowed[unit]; ok {
 				continue // already within the safe set
 			}
 			if len(state.Allowed) < limit {
-				state.Allowed[ip] = struct{}{} // reserve a safe slot
+				state.Allowed[unit] = struct{}{} // reserve a safe slot
 				continue
 			}
 			// Beyond the limit: block this IP on the client's inbound port.
 			key := blockedKey{IP: ip, Port: state.Port}
-			if _, exists := blockedIPs[key]; !exists {
-				logger.Debug("blocked ip: ", ip, " for user:", email)
+			if entry, exists := blockedIPs[key]; exists {
+				entry.Deadline = max(entry.Deadline, now.Add(policy.Duration).Unix())
+				blockedIPs[key] = entry
+				continue
+			}
+			// Blocks of one run are a single offense.
+			if duration == 0 {
+				duration = policy.escalate(email, now)
 			}
-			blockedIPs[key] = deadline
+			logger.WithFields(logger.Fields{"email": email, "ip": ip, "duration": duration}).Debug("blocked ip")
+			emitWebhook(WebhookClientIpLimit, map[string]any{
+				"email":    email,
+				"ip":       ip,
+				"port":     state.Port,
+				"limitIp":  state.IpLimit,
+				"duration": int64(duration.Seconds()),
+			})
+			blockedIPs[key] = blockedEntry{Email: email, Deadline: now.Add(duration).Unix()}
+		}
+	}
+}
+
+// ipAllowListed reports whether ip is in the manual allow list. The caller
+// holds ipLimitMu.
+func ipAllowListed(ip string) bool {
+	if len(ipAllowNets) == 0 {
+		return false
+	}
+	addr := net.ParseIP(strings.Trim(ip, "[]"))
+	if addr == nil {
+		return false
+	}
+	for _, network := range ipAllowNets {
+		if network.Contains(addr) {
+			return true
 		}
 	}
+	return false
 }
 
 func ProcessIpLimitCron(onlineUsers []xray.OnlineUserInfo) {
 	if !ipLimitFw.Supported() {
 		return
 	}
-	updateIpLimitOnlineIPs(onlineUsers)
+	updateIpLimitOnlineIPs(onlineUsers, loadIpLimitPolicy())
 	reapplyBlocks()
 }
 
-func GetBlockedList() []xray.OnlineUserInfo {
+// GetBlockedList returns the addresses blocked by the ip limit with the
+// client that caused each block.
+func GetBlockedList() []BlockedIp {
 	ipLimitMu.RLock()
-	defer ipLimitMu.RUnlock()
-	if len(blockedIPs) == 0 {
-		return nil
+	blocked := make([]BlockedIp, 0, len(blockedIPs))
+	for key, entry := range blockedIPs {
+		blocked = append(blocked, BlockedIp{
+			Ip:        key.IP,
+			Port:      key.Port,
+			Email:     entry.Email,
+			ExpiresAt: entry.Deadline,
+		})
 	}
-	ips := make(map[string]int64, len(blockedIPs))
-	for key, deadline := range blockedIPs {
-		ips[key.IP] = deadline
+	ipLimitMu.RUnlock()
+
+	sort.Slice(blocked, func(i, j int) bool {
+		if blocked[i].Ip == blocked[j].Ip {
+			return blocked[i].Port < blocked[j].Port
+		}
+		return blocked[i].Ip < blocked[j].Ip
+	})
+	for i := range blocked {
+		if info, ok := lookupIpInfo(blocked[i].Ip); ok {
+			blocked[i].Geo = &info
+		}
 	}
-	return []xray.OnlineUserInfo{{IPs: ips}}
+	return blocked
+}
+
+func GetBlockedCount() int {
+	ipLimitMu.RLock()
+	defer ipLimitMu.RUnlock()
+	return len(blockedIPs)
 }
 
 func reapplyBlocks() {
 	ipLimitMu.Lock()
 	defer ipLimitMu.Unlock()
 	now := time.Now().Unix()
-	for key, deadline := range blockedIPs {
-		if deadline <= now {
+	for key, entry := range blockedIPs {
+		if entry.Deadline <= now || ipAllowListed(key.IP) {
 			delete(blockedIPs, key)
 			continue
 		}
-		if err := ipLimitFw.Block(iplimit.BlockKey{IP: key.IP, Port: key.Port}); err != nil {
+		remaining := time.Duration(entry.Deadline-now) * time.Second
+		if err := ipLimitFw.Block(iplimit.BlockKey{IP: key.IP, Port: key.Port}, remaining); err != nil {
 			logger.Debug("block ip limit failed:", err)
 		}
 	}
@@ -13,7 +13,6 @@ import (
 )
 
 type OutboundService struct {
-	xrayApi        xray.XrayAPI
 	settingService SettingService
 }
 
@@ -71,12 +70,12 @@ func (s *OutboundService) AddOutbound(outbound *model.Outbound) (*model.Outbound
 
 	needRestart := false
 	if p != nil && p.IsRunning() {
-		s.xrayApi.Init(p.GetAPIAddr())
+		xrayAPI.Init(p.GetAPIAddr())
 		outboundJson, err1 := json.MarshalIndent(outbound.GenXrayOutboundConfig(), "", "  ")
 		if err1 != nil {
 			logger.Debug("Unable to marshal outbound config:", err1)
 		} else {
-			err1 = s.xrayApi.AddOutbound(outboundJson)
+			err1 = xrayAPI.AddOutbound(outboundJson)
 			if err1 == nil {
 				logger.Debug("New outbound added by api:", outbound.Tag)
 			} else {
@@ -84,7 +83,6 @@ func (s *OutboundService) AddOutbound(outbound *model.Outbound) (*model.Outbound
 				needRestart = true
 			}
 		}
-		s.xrayApi.Close()
 	}
 
 	return outbound, needRestart, nil
@@ -99,15 +97,14 @@ func (s *OutboundService) DelOutbound(id int) (bool, error) {
 
 	needRestart := false
 	if p != nil && p.IsRunning() {
-		s.xrayApi.Init(p.GetAPIAddr())
-		err1 := s.xrayApi.DelOutbound(outbound.Tag)
+		xrayAPI.Init(p.GetAPIAddr())
+		err1 := xrayAPI.DelOutbound(outbound.Tag)
 		if err1 == nil {
 			logger.Debug("Outbound deleted by api:", outbound.Tag)
 		} else {
 			logger.Debug("Unable to delete outbound by api:", err1)
 			needRestart = true
 		}
-		s.xrayApi.Close()
 	}
 
 	return needRestart, db.Delete(model.Outbound{}, id).Error
@@ -139,8 +136,8 @@ func (s *OutboundService) UpdateOutbound(outbound *model.Outbound) (*model.Outbo
 
 	needRestart := false
 	if p != nil && p.IsRunning() {
-		s.xrayApi.Init(p.GetAPIAddr())
-		if s.xrayApi.DelOutbound(oldTag) == nil {
+		xrayAPI.Init(p.GetAPIAddr())
+		if xrayAPI.DelOutbound(oldTag) == nil {
 			logger.Debug("Old outbound deleted by api:", oldTag)
 		}
 		outboundJson, err2 := json.MarshalIndent(oldOutbound.GenXrayOutboundConfig(), "", "  ")
@@ -148,7 +145,7 @@ func (s *OutboundService) UpdateOutbound(outbound *model.Outbound) (*model.Outbo
 			logger.Debug("Unable to marshal updated outbound config:", err2)
 			needRestart = true
 		} else {
-			err2 = s.xrayApi.AddOutbound(outboundJson)
+			err2 = xrayAPI.AddOutbound(outboundJson)
 			if err2 == nil {
 				logger.Debug("Updated outbound added by api:", oldOutbound.Tag)
 			} else {
@@ -156,7 +153,6 @@ func (s *OutboundService) UpdateOutbound(outbound *model.Outbound) (*model.Outbo
 				needRestart = true
 			}
 		}
-		s.xrayApi.Close()
 	}
 
 	db := database.GetDB()
@@ -14,7 +14,6 @@ import (
 )
 
 type RoutingRuleService struct {
-	xrayApi        xray.XrayAPI
 	settingService SettingService
 }
 
@@ -93,28 +92,30 @@ func (s *RoutingRuleService) SaveAllRules(rules []*model.RoutingRule) (bool, err
 		if err != nil {
 			return false, err
 		}
+		if err := validateGeoReferences(ruleJSON); err != nil {
+			return false, common.NewErrorf("rule %s: %v", r.Tag, err)
+		}
 		ruleJSONs = append(ruleJSONs, ruleJSON)
 	}
 
 	needRestart := false
 	if p != nil && p.IsRunning() {
-		if err := s.xrayApi.Init(p.GetAPIAddr()); err != nil {
+		if err := xrayAPI.Init(p.GetAPIAddr()); err != nil {
 			return true, err
 		}
-		defer s.xrayApi.Close()
 
 		oldTags, err := s.loadDbRuleTags()
 		if err != nil {
 			return true, err
 		}
 		for _, tag := range oldTags {
-			if err := s.xrayApi.DelRule(tag); err != nil {
+			if err := xrayAPI.DelRule(tag); err != nil {
 				logger.Debug("Unable to delete routing rule by api:", err)
 				needRestart = true
 			}
 		}
 		for _, ruleJSON := range ruleJSONs {
-			if err := s.xrayApi.AddRule(ruleJSON, true); err != nil {
+			if err := xrayAPI.AddRule(ruleJSON, true); err != nil {
 				// xray rejected the rule: keep the database untouched and ask for a
 				// restart so the previous (still stored) rules get restored.
 				isNeedXrayRestart.Store(true)
@@ -209,6 +210,31 @@ func (s *RoutingRuleService) loadDbRuleTags() ([]string, error) {
 	return tags, nil
 }
 
+// validateGeoReferences checks geosite:, geoip: and ext: entries of a rule
+// against the geo files present in the bin folder.
+func validateGeoReferences(ruleJSON []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(ruleJSON, &raw); err != nil {
+		return err
+	}
+	for _, value := range raw {
+		list, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			str, ok := item.(string)
+			if !ok {
+				continue
+			}
+			if err := xray.ValidateGeoReference(str); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func routingRuleTag(rule *model.RoutingRule) string {
 	if rule.Tag != "" {
 		return rule.Tag
@@ -223,7 +249,7 @@ func (s *RoutingRuleService) applyMergedRulesViaApi(rules []interface{}) (bool,
 		return true, err
 	}
 	for _, tag := range tags {
-		if err := s.xrayApi.DelRule(tag); err != nil {
+		if err := xrayAPI.DelRule(tag); err != nil {
 			logger.Debug("Unable to delete routing rule by api:", err)
 			needRestart = true
 		}
@@ -234,7 +260,7 @@ func (s *RoutingRuleService) applyMergedRulesViaApi(rules []interface{}) (bool,
 			needRestart = true
 			continue
 		}
-		if err := s.xrayApi.AddRule(ruleJSON, true); err != nil {
+		if err := xrayAPI.AddRule(ruleJSON, true); err != nil {
 			logger.Debug("Unable to apply routing rule by api:", err)
 			return true, err
 		}
@@ -252,8 +278,7 @@ func (s *RoutingRuleService) ReloadRoutingRules() (bool, error) {
 		return false, nil
 	}
 
-	s.xrayApi.Init(p.GetAPIAddr())
-	defer s.xrayApi.Close()
+	xrayAPI.Init(p.GetAPIAddr())
 
 	needRestart, err := s.applyMergedRulesViaApi(rules)
 	if err != nil {
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+)
+
+type metricTier struct {
+	resolution int
+	retention  time.Duration
+}
+
+// Raw samples are kept for a few hours and averaged into minute and
+// ten-minute rows that cover the longer ranges.
+var metricTiers = []metricTier{
+	{0, 3 * time.Hour},
+	{60, 2 * 24 * time.Hour},
+	{600, 8 * 24 * time.Hour},
+}
+
+var metricRanges = map[string]struct {
+	span       time.Duration
+	resolution int
+}{
+	"hour": {time.Hour, 0},
+	"day":  {24 * time.Hour, 60},
+	"week": {7 * 24 * time.Hour, 600},
+}
+
+// metricAccumulator averages the rows of one bucket of a downsampled tier.
+type metricAccumulator struct {
+	resolution int
+	bucket     int64
+	count      int
+	sum        model.ServerMetric
+}
+
+func (a *metricAccumulator) add(m *model.ServerMetric) *model.ServerMetric {
+	bucket := m.Time - m.Time%int64(a.resolution)
+	var flushed *model.ServerMetric
+	if a.count > 0 && bucket != a.bucket {
+		flushed = a.average()
+		a.count = 0
+		a.sum = model.ServerMetric{}
+	}
+	a.bucket = bucket
+	a.count++
+	a.sum.Cpu += m.Cpu
+	a.sum.Mem += m.Mem
+	a.sum.Swap += m.Swap
+	a.sum.Disk += m.Disk
+	a.sum.Load += m.Load
+	a.sum.NetUp += m.NetUp
+	a.sum.NetDown += m.NetDown
+	a.sum.TcpCount += m.TcpCount
+	a.sum.UdpCount += m.UdpCount
+	return flushed
+}
+
+func (a *metricAccumulator) average() *model.ServerMetric {
+	n := a.count
+	return &model.ServerMetric{
+		Resolution: a.resolution,
+		Time:       a.bucket,
+		Cpu:        a.sum.Cpu / float64(n),
+		Mem:        a.sum.Mem / uint64(n),
+		Swap:       a.sum.Swap / uint64(n),
+		Disk:       a.sum.Disk / uint64(n),
+		Load:       a.sum.Load / float64(n),
+		NetUp:      a.sum.NetUp / uint64(n),
+		NetDown:    a.sum.NetDown / uint64(n),
+		TcpCount:   a.sum.TcpCount / n,
+		UdpCount:   a.sum.UdpCount / n,
+	}
+}
+
+var (
+	metricLock         sync.Mutex
+	metricAccumulators []*metricAccumulator
+)
+
+func init() {
+	for _, tier := range metricTiers[1:] {
+		metricAccumulators = append(metricAccumulators, &metricAccumulator{resolution: tier.resolution})
+	}
+}
+
+type ServerMetricService struct{}
+
+// Record stores a raw sample of status and rolls finished buckets into the
+// downsampled tiers. Rows older than the retention of their tier are removed.
+func (s *ServerMetricService) Record(status *Status) error {
+	sample := &model.ServerMetric{
+		Time:     status.T.Unix(),
+		Cpu:      status.Cpu,
+		Mem:      status.Mem.Current,
+		Swap:     status.Swap.Current,
+		Disk:     status.Disk.Current,
+		NetUp:    status.NetIO.Up,
+		NetDown:  status.NetIO.Down,
+		TcpCount: status.TcpCount,
+		UdpCount: status.UdpCount,
+	}
+	if len(status.Loads) > 0 {
+		sample.Load = status.Loads[0]
+	}
+
+	metricLock.Lock()
+	defer metricLock.Unlock()
+
+	rows := []*model.ServerMetric{sample}
+	next := sample
+	for _, acc := range metricAccumulators {
+		next = acc.add(next)
+		if next == nil {
+			break
+		}
+		rows = append(rows, next)
+	}
+
+	db := database.GetDB()
+	if err := db.Create(rows).Error; err != nil {
+		return err
+	}
+	if len(rows) > 1 {
+		return s.prune(status.T)
+	}
+	return nil
+}
+
+func (s *ServerMetricService) prune(now time.Time) error {
+	db := database.GetDB()
+	for _, tier := range metricTiers {
+		err := db.Where("resolution = ? AND time < ?", tier.resolution, now.Add(-tier.retention).Unix()).
+			Delete(&model.ServerMetric{}).Error
+		if err != nil {
+			logger.Warning("prune server metrics failed:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHistory returns the samples of the last hour, day or week at the
+// resolution kept for that range.
+func (s *ServerMetricService) GetHistory(rangeName string) ([]*model.ServerMetric, error) {
+	r, ok := metricRanges[rangeName]
+	if !ok {
+		return nil, common.NewError("invalid metrics range:", rangeName)
+	}
+	since := time.Now().Add(-r.span).Unix()
+	metrics := make([]*model.ServerMetric, 0)
+	err := database.GetDB().
+		Where("resolution = ? AND time >= ?", r.resolution, since).
+		Order("time asc").
+		Find(&metrics).Error
+	return metrics, err
+}
+
+// GetCpuAverage returns the average cpu usage of the raw samples within
+// window. ok is false if the samples do not yet cover most of the window.
+// A window longer than the raw samples are kept is refused, as it could
+// never be covered.
+func (s *ServerMetricService) GetCpuAverage(window time.Duration) (avg float64, ok bool, err error) {
+	if window > metricTiers[0].retention {
+		return 0, false, common.NewError("cpu average window is longer than the raw samples are kept:", window)
+	}
+	now := time.Now()
+	since := now.Add(-window).Unix()
+	var result struct {
+		Avg   float64
+		Count int64
+		First int64
+	}
+	err = database.GetDB().Model(&model.ServerMetric{}).
+		Select("AVG(cpu) AS avg, COUNT(*) AS count, MIN(time) AS first").
+		Where("resolution = 0 AND time >= ?", since).
+		Scan(&result).Error
+	if err != nil || result.Count == 0 {
+		return 0, false, err
+	}
+	covered := now.Unix() - result.First
+	return result.Avg, covered >= int64(window.Seconds()*0.9), nil
+}
@@ -20,48 +20,99 @@ import (
 )
 
 var defaultValueMap = map[string]string{
-	"xrayTemplateConfig": config.GetDefaultXrayTemplate(),
-	"webListen":          "",
-	"webDomain":          "",
-	"webPort":            "54321",
-	"webCertFile":        "",
-	"webKeyFile":         "",
-	"secret":             random.Seq(32),
-	"webBasePath":        "/",
-	"sessionMaxAge":      "0",
-	"pageSize":           "0",
-	"expireDiff":         "0",
-	"trafficDiff":        "0",
-	"remarkModel":        "-ieo",
-	"outboundTestUrl":    "https://www.gstatic.com/generate_204",
-	"timeLocation":       "Asia/Tehran",
-	"tgBotEnable":        "false",
-	"tgBotToken":         "",
-	"tgBotChatId":        "",
-	"tgRunTime":          "@daily",
-	"tgBotBackup":        "false",
-	"tgBotLoginNotify":   "false",
-	"tgCpu":              "0",
-	"tgLang":             "en-US",
-	"subEnable":          "false",
-	"subListen":          "",
-	"subPort":            "2096",
-	"subPath":            "/sub/",
-	"subDomain":          "",
-	"subCertFile":        "",
-	"subKeyFile":         "",
-	"subUpdates":         "12",
-	"subEncrypt":         "true",
-	"subShowInfo":        "false",
-	"subURI":             "",
-	"subJsonPath":        "/json/",
-	"subJsonURI":         "",
-	"subJsonFragment":    "",
-	"subJsonNoises":      "",
-	"subJsonMux":         "",
-	"subJsonRules":       "",
-	"warp":               "",
-	"ipBlockAfterRemove": "false",
+	"xrayTemplateConfig":    config.GetDefaultXrayTemplate(),
+	"webListen":             "",
+	"webListenSocket":       "",
+	"webProxyProtocol":      "false",
+	"trustedProxies":        "127.0.0.1/32,::1/128",
+	"webAllowedIps":         "",
+	"apiAllowedIps":         "",
+	"webDomain":             "",
+	"webPort":               "54321",
+	"webCertFile":           "",
+	"webKeyFile":            "",
+	"webAcme":               "false",
+	"acmeEmail":             "",
+	"acmeDirectory":         "https://acme-v02.api.letsencrypt.org/directory",
+	"acmeChallenge":         "http-01",
+	"acmeHttpPort":          "80",
+	"certExpiryWarnDays":    "14",
+	"secret":                random.Seq(32),
+	"webBasePath":           "/",
+	"sessionMaxAge":         "0",
+	"pageSize":              "0",
+	"expireDiff":            "0",
+	"trafficDiff":           "0",
+	"remarkModel":           "-ieo",
+	"outboundTestUrl":       "https://www.gstatic.com/generate_204",
+	"timeLocation":          "Asia/Tehran",
+	"tgBotEnable":           "false",
+	"tgBotToken":            "",
+	"tgBotChatId":           "",
+	"tgRunTime":             "@daily",
+	"tgBotBackup":           "false",
+	"tgBotLoginNotify":      "false",
+	"tgCpu":                 "0",
+	"tgCpuPeriod":           "5",
+	"tgLang":                "en-US",
+	"subEnable":             "false",
+	"subListen":             "",
+	"subListenSocket":       "",
+	"subProxyProtocol":      "false",
+	"subPort":               "2096",
+	"subPath":               "/sub/",
+	"subDomain":             "",
+	"subCertFile":           "",
+	"subKeyFile":            "",
+	"subAcme":               "false",
+	"subUpdates":            "12",
+	"subEncrypt":            "true",
+	"subShowInfo":           "false",
+	"subURI":                "",
+	"subJsonPath":           "/json/",
+	"subJsonURI":            "",
+	"subJsonFragment":       "",
+	"subJsonNoises":         "",
+	"subJsonMux":            "",
+	"subJsonRules":          "",
+	"warp":                  "",
+	"ipBlockAfterRemove":    "false",
+	"ipLimitBackend":        "auto",
+	"ipLimitStrategy":       "newest",
+	"ipBlockDuration":       "60",
+	"ipBlockMaxDuration":    "3600",
+	"hostFirewall":          "off",
+	"hostFirewallPorts":     "22",
+	"xrayMirrorUrl":         "",
+	"geoUpdateSources":      "[]",
+	"geoUpdateCron":         "@daily",
+	"metricsEnable":         "false",
+	"metricsListen":         "",
+	"metricsUser":           "",
+	"metricsPassword":       "",
+	"metricsToken":          "",
+	"metricsClients":        "false",
+	"apiToken":              "",
+	"serverMetricsInterval": "10",
+	"notifyRoutes":          "{}",
+	"notifyWebhookUrl":      "",
+	"notifyWebhookSecret":   "",
+	"notifySmtpHost":        "",
+	"notifySmtpPort":        "587",
+	"notifySmtpUser":        "",
+	"notifySmtpPassword":    "",
+	"notifySmtpFrom":        "",
+	"notifySmtpTo":          "",
+	"clientWebhooks":        "[]",
+	"accessLogIngest":       "false",
+	"accessLogRetention":    "7",
+	"accessLogMaxRows":      "1000000",
+	"ipHistoryRetention":    "30",
+	"sharingDetect":         "false",
+	"sharingMaxSubnets":     "8",
+	"sharingMinDistance":    "500",
+	"sharingAction":         "none",
+	"sharingLimitIp":        "1",
 }
 
 type SettingService struct{}
@@ -222,6 +273,34 @@ func (s *SettingService) GetListen() (string, error) {
 	return s.getString("webListen")
 }
 
+func (s *SettingService) GetWebListenSocket() (string, error) {
+	return s.getString("webListenSocket")
+}
+
+func (s *SettingService) GetWebProxyProtocol() (bool, error) {
+	return s.getBool("webProxyProtocol")
+}
+
+func (s *SettingService) GetTrustedProxies() (string, error) {
+	return s.getString("trustedProxies")
+}
+
+func (s *SettingService) GetWebAllowedIps() (string, error) {
+	return s.getString("webAllowedIps")
+}
+
+func (s *SettingService) GetApiAllowedIps() (string, error) {
+	return s.getString("apiAllowedIps")
+}
+
+// ClearAllowedIps lets every address reach the panel and its API again.
+func (s *SettingService) ClearAllowedIps() error {
+	if err := s.setString("webAllowedIps", ""); err != nil {
+		return err
+	}
+	return s.setString("apiAllowedIps", "")
+}
+
 func (s *SettingService) GetWebDomain() (string, error) {
 	return s.getString("webDomain")
 }
@@ -270,6 +349,10 @@ func (s *SettingService) GetTgCpu() (int, error) {
 	return s.getInt("tgCpu")
 }
 
+func (s *SettingService) GetTgCpuPeriod() (int, error) {
+	return s.getInt("tgCpuPeriod")
+}
+
 func (s *SettingService) GetTgLang() (string, error) {
 	return s.getString("tgLang")
 }
@@ -298,6 +381,30 @@ func (s *SettingService) GetKeyFile() (string, error) {
 	return s.getString("webKeyFile")
 }
 
+func (s *SettingService) GetWebAcme() (bool, error) {
+	return s.getBool("webAcme")
+}
+
+func (s *SettingService) GetAcmeEmail() (string, error) {
+	return s.getString("acmeEmail")
+}
+
+func (s *SettingService) GetAcmeDirectory() (string, error) {
+	return s.getString("acmeDirectory")
+}
+
+func (s *SettingService) GetAcmeChallenge() (string, error) {
+	return s.getString("acmeChallenge")
+}
+
+func (s *SettingService) GetAcmeHttpPort() (int, error) {
+	return s.getInt("acmeHttpPort")
+}
+
+func (s *SettingService) GetCertExpiryWarnDays() (int, error) {
+	return s.getInt("certExpiryWarnDays")
+}
+
 func (s *SettingService) GetExpireDiff() (int, error) {
 	return s.getInt("expireDiff")
 }
@@ -318,6 +425,126 @@ func (s *SettingService) GetOutboundTestUrl() (string, error) {
 	return s.getString("outboundTestUrl")
 }
 
+func (s *SettingService) GetXrayMirrorUrl() (string, error) {
+	return s.getString("xrayMirrorUrl")
+}
+
+func (s *SettingService) GetGeoUpdateSources() (string, error) {
+	return s.getString("geoUpdateSources")
+}
+
+func (s *SettingService) GetGeoUpdateCron() (string, error) {
+	return s.getString("geoUpdateCron")
+}
+
+func (s *SettingService) GetApiToken() (string, error) {
+	return s.getString("apiToken")
+}
+
+func (s *SettingService) GetServerMetricsInterval() (int, error) {
+	return s.getInt("serverMetricsInterval")
+}
+
+func (s *SettingService) GetNotifyRoutes() (string, error) {
+	return s.getString("notifyRoutes")
+}
+
+func (s *SettingService) GetNotifyWebhookUrl() (string, error) {
+	return s.getString("notifyWebhookUrl")
+}
+
+func (s *SettingService) GetNotifyWebhookSecret() (string, error) {
+	return s.getString("notifyWebhookSecret")
+}
+
+func (s *SettingService) GetNotifySmtpHost() (string, error) {
+	return s.getString("notifySmtpHost")
+}
+
+func (s *SettingService) GetNotifySmtpPort() (int, error) {
+	return s.getInt("notifySmtpPort")
+}
+
+func (s *SettingService) GetNotifySmtpUser() (string, error) {
+	return s.getString("notifySmtpUser")
+}
+
+func (s *SettingService) GetNotifySmtpPassword() (string, error) {
+	return s.getString("notifySmtpPassword")
+}
+
+func (s *SettingService) GetNotifySmtpFrom() (string, error) {
+	return s.getString("notifySmtpFrom")
+}
+
+func (s *SettingService) GetNotifySmtpTo() (string, error) {
+	return s.getString("notifySmtpTo")
+}
+
+func (s *SettingService) GetClientWebhooks() (string, error) {
+	return s.getString("clientWebhooks")
+}
+
+func (s *SettingService) GetAccessLogIngest() (bool, error) {
+	return s.getBool("accessLogIngest")
+}
+
+func (s *SettingService) GetAccessLogRetention() (int, error) {
+	return s.getInt("accessLogRetention")
+}
+
+func (s *SettingService) GetAccessLogMaxRows() (int, error) {
+	return s.getInt("accessLogMaxRows")
+}
+
+func (s *SettingService) GetIpHistoryRetention() (int, error) {
+	return s.getInt("ipHistoryRetention")
+}
+
+func (s *SettingService) GetSharingDetect() (bool, error) {
+	return s.getBool("sharingDetect")
+}
+
+func (s *SettingService) GetSharingMaxSubnets() (int, error) {
+	return s.getInt("sharingMaxSubnets")
+}
+
+func (s *SettingService) GetSharingMinDistance() (int, error) {
+	return s.getInt("sharingMinDistance")
+}
+
+func (s *SettingService) GetSharingAction() (string, error) {
+	return s.getString("sharingAction")
+}
+
+func (s *SettingService) GetSharingLimitIp() (int, error) {
+	return s.getInt("sharingLimitIp")
+}
+
+func (s *SettingService) GetMetricsEnable() (bool, error) {
+	return s.getBool("metricsEnable")
+}
+
+func (s *SettingService) GetMetricsListen() (string, error) {
+	return s.getString("metricsListen")
+}
+
+func (s *SettingService) GetMetricsUser() (string, error) {
+	return s.getString("metricsUser")
+}
+
+func (s *SettingService) GetMetricsPassword() (string, error) {
+	return s.getString("metricsPassword")
+}
+
+func (s *SettingService) GetMetricsToken() (string, error) {
+	return s.getString("metricsToken")
+}
+
+func (s *SettingService) GetMetricsClients() (bool, error) {
+	return s.getBool("metricsClients")
+}
+
 func (s *SettingService) GetSecret() ([]byte, error) {
 	secret, err := s.getString("secret")
 	if secret == defaultValueMap["secret"] {
@@ -384,10 +611,46 @@ func (s *SettingService) SetIpBlockAfterRemove(value bool) error {
 	return s.setBool("ipBlockAfterRemove", value)
 }
 
+func (s *SettingService) GetIpLimitBackend() (string, error) {
+	return s.getString("ipLimitBackend")
+}
+
+func (s *SettingService) GetIpLimitStrategy() (string, error) {
+	return s.getString("ipLimitStrategy")
+}
+
+func (s *SettingService) GetIpBlockDuration() (int, error) {
+	return s.getInt("ipBlockDuration")
+}
+
+func (s *SettingService) GetIpBlockMaxDuration() (int, error) {
+	return s.getInt("ipBlockMaxDuration")
+}
+
+func (s *SettingService) GetHostFirewall() (string, error) {
+	return s.getString("hostFirewall")
+}
+
+func (s *SettingService) SetHostFirewall(value string) error {
+	return s.setString("hostFirewall", value)
+}
+
+func (s *SettingService) GetHostFirewallPorts() (string, error) {
+	return s.getString("hostFirewallPorts")
+}
+
 func (s *SettingService) GetSubListen() (string, error) {
 	return s.getString("subListen")
 }
 
+func (s *SettingService) GetSubListenSocket() (string, error) {
+	return s.getString("subListenSocket")
+}
+
+func (s *SettingService) GetSubProxyProtocol() (bool, error) {
+	return s.getBool("subProxyProtocol")
+}
+
 func (s *SettingService) GetSubPort() (int, error) {
 	return s.getInt("subPort")
 }
@@ -412,6 +675,10 @@ func (s *SettingService) GetSubKeyFile() (string, error) {
 	return s.getString("subKeyFile")
 }
 
+func (s *SettingService) GetSubAcme() (bool, error) {
+	return s.getBool("subAcme")
+}
+
 func (s *SettingService) GetSubUpdates() (string, error) {
 	return s.getString("subUpdates")
 }
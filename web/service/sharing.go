@@ -0,0 +1,351 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/util/geoip"
+	"github.com/alireza0/x-ui/xray"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SharingSubnets   = "subnets"
+	SharingCountries = "countries"
+
+	SharingActionNone    = "none"
+	SharingActionDisable = "disable"
+	SharingActionLimit   = "limit"
+)
+
+type ipHistoryKey struct {
+	email string
+	ip    string
+}
+
+type ipHistoryEntry struct {
+	firstSeen int64
+	lastSeen  int64
+	count     int64
+}
+
+// concurrentUse is the widest spread seen between the addresses a client
+// was online from at the same time.
+type concurrentUse struct {
+	countries []string
+	distance  float64
+	time      int64
+}
+
+// ipHistory collects the online addresses between flushes to the database.
+// count is the number of sessions, an address that disappears and comes
+// back counts again.
+var ipHistory = struct {
+	sync.Mutex
+	online     map[string]map[string]struct{}
+	pending    map[ipHistoryKey]*ipHistoryEntry
+	concurrent map[string]*concurrentUse
+}{
+	online:     make(map[string]map[string]struct{}),
+	pending:    make(map[ipHistoryKey]*ipHistoryEntry),
+	concurrent: make(map[string]*concurrentUse),
+}
+
+func recordIpHistory(users []xray.OnlineUserInfo) {
+	now := time.Now().Unix()
+	ipHistory.Lock()
+	defer ipHistory.Unlock()
+
+	current := make(map[string]map[string]struct{}, len(users))
+	for _, user := range users {
+		if user.Email == "" {
+			continue
+		}
+		ips := make(map[string]struct{}, len(user.IPs))
+		previous := ipHistory.online[user.Email]
+		for ip := range user.IPs {
+			ips[ip] = struct{}{}
+			key := ipHistoryKey{email: user.Email, ip: ip}
+			entry, ok := ipHistory.pending[key]
+			if !ok {
+				entry = &ipHistoryEntry{firstSeen: now}
+				ipHistory.pending[key] = entry
+			}
+			entry.lastSeen = now
+			if _, seen := previous[ip]; !seen {
+				entry.count++
+			}
+		}
+		current[user.Email] = ips
+		if len(ips) > 1 {
+			observeConcurrentUse(user.Email, ips, now)
+		}
+	}
+	ipHistory.online = current
+}
+
+func observeConcurrentUse(email string, ips map[string]struct{}, now int64) {
+	infos := make([]geoip.Info, 0, len(ips))
+	countries := make(map[string]struct{})
+	for ip := range ips {
+		if info, ok := lookupIpInfo(ip); ok && info.Country != "" {
+			infos = append(infos, info)
+			countries[info.Country] = struct{}{}
+		}
+	}
+	if len(countries) < 2 {
+		return
+	}
+	distance := 0.0
+	for i := range infos {
+		for j := i + 1; j < len(infos); j++ {
+			if infos[i].Country != infos[j].Country && infos[i].HasLocation() && infos[j].HasLocation() {
+				distance = math.Max(distance, haversine(infos[i], infos[j]))
+			}
+		}
+	}
+	use := ipHistory.concurrent[email]
+	if use == nil || distance > use.distance || len(countries) > len(use.countries) {
+		list := make([]string, 0, len(countries))
+		for country := range countries {
+			list = append(list, country)
+		}
+		sort.Strings(list)
+		ipHistory.concurrent[email] = &concurrentUse{countries: list, distance: distance, time: now}
+	}
+}
+
+// haversine returns the distance between two locations in kilometers.
+func haversine(a, b geoip.Info) float64 {
+	const earthRadius = 6371.0
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// ipSubnet returns the /24 of an IPv4 or the /48 of an IPv6 address.
+func ipSubnet(ip string) string {
+	parsed := net.ParseIP(strings.Trim(ip, "[]"))
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+type SharingService struct {
+	settingService SettingService
+	inboundService InboundService
+	xrayService    XrayService
+}
+
+// FlushHistory writes the collected sightings to the database and removes
+// history older than the retention.
+func (s *SharingService) FlushHistory() error {
+	ipHistory.Lock()
+	pending := ipHistory.pending
+	ipHistory.pending = make(map[ipHistoryKey]*ipHistoryEntry)
+	ipHistory.Unlock()
+
+	if len(pending) > 0 {
+		rows := make([]*model.ClientIpHistory, 0, len(pending))
+		for key, entry := range pending {
+			row := &model.ClientIpHistory{
+				Email:     key.email,
+				Ip:        key.ip,
+				Subnet:    ipSubnet(key.ip),
+				FirstSeen: entry.firstSeen,
+				LastSeen:  entry.lastSeen,
+				Count:     entry.count,
+			}
+			if info, ok := lookupIpInfo(key.ip); ok {
+				row.Country = info.Country
+				row.Asn = info.Asn
+				row.AsnOrg = info.AsnOrg
+			}
+			rows = append(rows, row)
+		}
+		err := database.GetDB().Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "email"}, {Name: "ip"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "last_seen"}, Value: clause.Column{Table: "excluded", Name: "last_seen"}},
+				{Column: clause.Column{Name: "count"}, Value: clause.Expr{SQL: "client_ip_histories.count + excluded.count"}},
+				{Column: clause.Column{Name: "country"}, Value: clause.Column{Table: "excluded", Name: "country"}},
+				{Column: clause.Column{Name: "asn"}, Value: clause.Column{Table: "excluded", Name: "asn"}},
+				{Column: clause.Column{Name: "asn_org"}, Value: clause.Column{Table: "excluded", Name: "asn_org"}},
+			},
+		}).CreateInBatches(rows, 200).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	retention, err := s.settingService.GetIpHistoryRetention()
+	if err != nil {
+		return err
+	}
+	since := time.Now().AddDate(0, 0, -retention).Unix()
+	return database.GetDB().Where("last_seen < ?", since).Delete(&model.ClientIpHistory{}).Error
+}
+
+// GetHistory returns the addresses of email, most recently seen first.
+func (s *SharingService) GetHistory(email string) ([]*model.ClientIpHistory, error) {
+	if email == "" {
+		return nil, common.NewError("email is required")
+	}
+	history := make([]*model.ClientIpHistory, 0)
+	err := database.GetDB().Where("email = ?", email).Order("last_seen desc").Find(&history).Error
+	return history, err
+}
+
+// Detect flags clients seen from too many subnets within a day or from
+// distant countries at the same time, and applies the configured action.
+// A client is flagged at most once a day for each reason.
+func (s *SharingService) Detect() ([]*model.SharingFlag, error) {
+	ipHistory.Lock()
+	concurrent := ipHistory.concurrent
+	ipHistory.concurrent = make(map[string]*concurrentUse)
+	ipHistory.Unlock()
+
+	enabled, err := s.settingService.GetSharingDetect()
+	if err != nil || !enabled {
+		return nil, err
+	}
+	now := time.Now()
+	flags := make([]*model.SharingFlag, 0)
+
+	maxSubnets, err := s.settingService.GetSharingMaxSubnets()
+	if err != nil {
+		return nil, err
+	}
+	if maxSubnets > 0 {
+		var rows []struct {
+			Email   string
+			Subnets int
+		}
+		err = database.GetDB().Model(model.ClientIpHistory{}).
+			Select("email, COUNT(DISTINCT subnet) AS subnets").
+			Where("last_seen >= ?", now.Add(-24*time.Hour).Unix()).
+			Group("email").
+			Having("COUNT(DISTINCT subnet) > ?", maxSubnets).
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			flags = append(flags, &model.SharingFlag{
+				Email:  row.Email,
+				Reason: SharingSubnets,
+				Detail: fmt.Sprintf("%d subnets in 24h", row.Subnets),
+				Value:  float64(row.Subnets),
+				Time:   now.Unix(),
+			})
+		}
+	}
+
+	minDistance, err := s.settingService.GetSharingMinDistance()
+	if err != nil {
+		return nil, err
+	}
+	for email, use := range concurrent {
+		if minDistance > 0 && use.distance < float64(minDistance) {
+			continue
+		}
+		flags = append(flags, &model.SharingFlag{
+			Email:  email,
+			Reason: SharingCountries,
+			Detail: fmt.Sprintf("online from %s at once, %.0f km apart", strings.Join(use.countries, ", "), use.distance),
+			Value:  use.distance,
+			Time:   use.time,
+		})
+	}
+
+	action, _ := s.settingService.GetSharingAction()
+	result := make([]*model.SharingFlag, 0, len(flags))
+	db := database.GetDB()
+	for _, flag := range flags {
+		var count int64
+		err := db.Model(model.SharingFlag{}).
+			Where("email = ? AND reason = ? AND time >= ?", flag.Email, flag.Reason, now.Add(-24*time.Hour).Unix()).
+			Count(&count).Error
+		if err != nil {
+			return result, err
+		}
+		if count > 0 {
+			continue
+		}
+		flag.Action = s.applyAction(flag.Email, action)
+		if err := db.Create(flag).Error; err != nil {
+			return result, err
+		}
+		logger.WithFields(logger.Fields{"email": flag.Email, "reason": flag.Reason}).Info("account sharing suspected:", flag.Detail)
+		result = append(result, flag)
+	}
+	return result, nil
+}
+
+// applyAction disables the client or lowers its IP limit and returns what
+// was done.
+func (s *SharingService) applyAction(email string, action string) string {
+	var modify func(client map[string]any)
+	switch action {
+	case SharingActionDisable:
+		modify = func(client map[string]any) {
+			client["enable"] = false
+		}
+	case SharingActionLimit:
+		limit, err := s.settingService.GetSharingLimitIp()
+		if err != nil || limit <= 0 {
+			return SharingActionNone
+		}
+		modify = func(client map[string]any) {
+			if current, ok := client["limitIp"].(float64); !ok || current == 0 || int(current) > limit {
+				client["limitIp"] = limit
+			}
+		}
+	default:
+		return SharingActionNone
+	}
+	needRestart, err := s.inboundService.UpdateClientByEmail(email, modify)
+	if err != nil {
+		logger.Warning("apply sharing action to", email, "failed:", err)
+		return SharingActionNone
+	}
+	if needRestart {
+		s.xrayService.SetToNeedRestart()
+	}
+	return action
+}
+
+// GetFlags returns the latest flags, of one client if email is set.
+func (s *SharingService) GetFlags(email string, since int64, limit int) ([]*model.SharingFlag, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	db := database.GetDB().Model(model.SharingFlag{}).Where("time >= ?", since)
+	if email != "" {
+		db = db.Where("email = ?", email)
+	}
+	flags := make([]*model.SharingFlag, 0)
+	err := db.Order("time desc").Limit(limit).Find(&flags).Error
+	return flags, err
+}
+
+func (s *SharingService) ClearFlags() error {
+	return database.GetDB().Where("1 = 1").Delete(&model.SharingFlag{}).Error
+}
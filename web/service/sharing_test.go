@@ -0,0 +1,199 @@
+package service
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/util/geoip"
+	"github.com/alireza0/x-ui/xray"
+)
+
+var (
+	berlin = geoip.Info{Country: "DE", Latitude: 52.52, Longitude: 13.405}
+	paris  = geoip.Info{Country: "FR", Latitude: 48.857, Longitude: 2.352}
+	munich = geoip.Info{Country: "DE", Latitude: 48.137, Longitude: 11.575}
+)
+
+// withGeoIP answers lookups from infos instead of the databases of the bin
+// folder, and resets the collected history.
+func withGeoIP(t *testing.T, infos map[string]geoip.Info) {
+	t.Helper()
+	geoIPState.Lock()
+	geoIPState.loaded = true
+	geoIPState.readers = nil
+	geoIPState.cache = infos
+	geoIPState.Unlock()
+
+	reset := func() {
+		ipHistory.Lock()
+		ipHistory.online = make(map[string]map[string]struct{})
+		ipHistory.pending = make(map[ipHistoryKey]*ipHistoryEntry)
+		ipHistory.concurrent = make(map[string]*concurrentUse)
+		ipHistory.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		reset()
+		geoIPState.Lock()
+		geoIPState.loaded = false
+		geoIPState.Unlock()
+	})
+}
+
+func onlineUser(email string, ips ...string) xray.OnlineUserInfo {
+	user := xray.OnlineUserInfo{Email: email, IPs: make(map[string]int64)}
+	for _, ip := range ips {
+		user.IPs[ip] = 0
+	}
+	return user
+}
+
+func TestIpSubnet(t *testing.T) {
+	tests := map[string]string{
+		"1.2.3.4":              "1.2.3.0/24",
+		"[2001:db8:1:2::1]":    "2001:db8:1::/48",
+		"::ffff:10.20.30.40":   "10.20.30.0/24",
+		"not an address":       "not an address",
+		"2001:db8:ffff:1::abc": "2001:db8:ffff::/48",
+	}
+	for ip, want := range tests {
+		if got := ipSubnet(ip); got != want {
+			t.Errorf("%s: got %s, want %s", ip, got, want)
+		}
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	if d := haversine(berlin, paris); math.Abs(d-878) > 5 {
+		t.Errorf("Berlin to Paris is %.0f km", d)
+	}
+	if d := haversine(berlin, berlin); d != 0 {
+		t.Errorf("distance to itself is %f", d)
+	}
+}
+
+func TestRecordIpHistory(t *testing.T) {
+	withGeoIP(t, map[string]geoip.Info{"1.1.1.1": berlin, "2.2.2.2": paris, "3.3.3.3": munich})
+
+	recordIpHistory([]xray.OnlineUserInfo{onlineUser("a", "1.1.1.1", "3.3.3.3"), onlineUser("", "1.1.1.1")})
+	recordIpHistory([]xray.OnlineUserInfo{onlineUser("a", "1.1.1.1")})
+	recordIpHistory([]xray.OnlineUserInfo{onlineUser("a", "1.1.1.1", "3.3.3.3", "2.2.2.2")})
+
+	ipHistory.Lock()
+	defer ipHistory.Unlock()
+	counts := map[string]int64{}
+	for key, entry := range ipHistory.pending {
+		if key.email != "a" {
+			t.Errorf("recorded %+v", key)
+		}
+		counts[key.ip] = entry.count
+	}
+	// 3.3.3.3 went away and came back
+	want := map[string]int64{"1.1.1.1": 1, "3.3.3.3": 2, "2.2.2.2": 1}
+	for ip, count := range want {
+		if counts[ip] != count {
+			t.Errorf("%s: %d sessions, want %d", ip, counts[ip], count)
+		}
+	}
+
+	use := ipHistory.concurrent["a"]
+	if use == nil {
+		t.Fatal("concurrent use from two countries was not seen")
+	}
+	if strings.Join(use.countries, ",") != "DE,FR" || math.Abs(use.distance-878) > 5 {
+		t.Errorf("unexpected use %+v", use)
+	}
+}
+
+func TestRecordIpHistorySameCountry(t *testing.T) {
+	withGeoIP(t, map[string]geoip.Info{"1.1.1.1": berlin, "3.3.3.3": munich})
+	recordIpHistory([]xray.OnlineUserInfo{onlineUser("a", "1.1.1.1", "3.3.3.3", "9.9.9.9")})
+	ipHistory.Lock()
+	defer ipHistory.Unlock()
+	if use := ipHistory.concurrent["a"]; use != nil {
+		t.Errorf("one country flagged as %+v", use)
+	}
+}
+
+func TestSharingDetect(t *testing.T) {
+	initTestDB(t)
+	withGeoIP(t, map[string]geoip.Info{"1.1.1.1": berlin, "2.2.2.2": paris, "3.3.3.3": munich})
+	db := database.GetDB()
+	for key, value := range map[string]string{"sharingDetect": "true", "sharingMaxSubnets": "2", "sharingMinDistance": "500"} {
+		if err := db.Create(&model.Setting{Key: key, Value: value}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().Unix()
+	rows := []*model.ClientIpHistory{
+		{Email: "many", Ip: "10.0.1.1", Subnet: "10.0.1.0/24", LastSeen: now},
+		{Email: "many", Ip: "10.0.2.1", Subnet: "10.0.2.0/24", LastSeen: now},
+		{Email: "many", Ip: "10.0.3.1", Subnet: "10.0.3.0/24", LastSeen: now},
+		{Email: "few", Ip: "10.0.1.1", Subnet: "10.0.1.0/24", LastSeen: now},
+		{Email: "few", Ip: "10.0.1.2", Subnet: "10.0.1.0/24", LastSeen: now},
+		{Email: "few", Ip: "10.0.2.1", Subnet: "10.0.2.0/24", LastSeen: now},
+		{Email: "old", Ip: "10.0.1.1", Subnet: "10.0.1.0/24", LastSeen: now - 2*86400},
+		{Email: "old", Ip: "10.0.2.1", Subnet: "10.0.2.0/24", LastSeen: now - 2*86400},
+		{Email: "old", Ip: "10.0.3.1", Subnet: "10.0.3.0/24", LastSeen: now},
+	}
+	if err := db.Create(rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := SharingService{}
+	detect := func() map[string]string {
+		recordIpHistory([]xray.OnlineUserInfo{onlineUser("far", "1.1.1.1", "2.2.2.2"), onlineUser("near", "1.1.1.1", "3.3.3.3")})
+		flags, err := s.Detect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, flag := range flags {
+			got[flag.Email] = flag.Reason
+			if flag.Action != SharingActionNone {
+				t.Errorf("%s: action %q", flag.Email, flag.Action)
+			}
+		}
+		return got
+	}
+
+	got := detect()
+	if len(got) != 2 || got["many"] != SharingSubnets || got["far"] != SharingCountries {
+		t.Errorf("got flags %v", got)
+	}
+	if got := detect(); len(got) != 0 {
+		t.Errorf("flagged again within a day: %v", got)
+	}
+	stored, err := s.GetFlags("", 0, 0)
+	if err != nil || len(stored) != 2 {
+		t.Errorf("stored %d flags, %v", len(stored), err)
+	}
+}
+
+func TestSharingFlushHistory(t *testing.T) {
+	initTestDB(t)
+	withGeoIP(t, map[string]geoip.Info{"1.1.1.1": berlin})
+	s := SharingService{}
+
+	recordIpHistory([]xray.OnlineUserInfo{onlineUser("a", "1.1.1.1")})
+	if err := s.FlushHistory(); err != nil {
+		t.Fatal(err)
+	}
+	recordIpHistory(nil)
+	recordIpHistory([]xray.OnlineUserInfo{onlineUser("a", "1.1.1.1")})
+	if err := s.FlushHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := s.GetHistory("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Count != 2 || history[0].Country != "DE" || history[0].Subnet != "1.1.1.0/24" {
+		t.Errorf("unexpected history %+v", history)
+	}
+}
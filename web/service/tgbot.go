@@ -3,6 +3,7 @@ package service
 import (
 	"embed"
 	"fmt"
+	"html"
 	"net"
 	"os"
 	"strconv"
@@ -38,6 +39,8 @@ type Tgbot struct {
 	inboundService InboundService
 	settingService SettingService
 	serverService  ServerService
+	notifyService  NotifyService
+	sharingService SharingService
 	lastStatus     *Status
 }
 
@@ -318,19 +321,25 @@ func (t *Tgbot) SendMsgToTgbotAdmins(msg string) {
 }
 
 func (t *Tgbot) SendReport() {
+	msg := ""
 	runTime, err := t.settingService.GetTgbotRuntime()
 	if err == nil && len(runTime) > 0 {
-		msg := ""
 		msg += t.I18nBot("tgbot.messages.report", "RunTime=="+runTime)
 		msg += t.I18nBot("tgbot.messages.datetime", "DateTime=="+time.Now().Format("2006-01-02 15:04:05"))
-		t.SendMsgToTgbotAdmins(msg)
+		msg += "\r\n \r\n"
 	}
+	msg += t.getServerUsage()
+	t.notifyService.Notify(NotifyReport, msg)
 
-	info := t.getServerUsage()
-	t.SendMsgToTgbotAdmins(info)
-
-	exhausted := t.getExhausted()
-	t.SendMsgToTgbotAdmins(exhausted)
+	if depleted, count := t.exhaustedReport(true, false); count > 0 {
+		t.notifyService.Notify(NotifyDepleted, depleted)
+	}
+	if expiring, count := t.exhaustedReport(false, true); count > 0 {
+		t.notifyService.Notify(NotifyExpiring, expiring)
+	}
+	if sharing := t.sharingReport(); sharing != "" {
+		t.notifyService.Notify(NotifySharing, sharing)
+	}
 
 	backupEnable, err := t.settingService.GetTgBotBackup()
 	if err == nil && backupEnable {
@@ -338,13 +347,32 @@ func (t *Tgbot) SendReport() {
 	}
 }
 
-func (t *Tgbot) SendBackupToAdmins() {
-	if !t.IsRunning() {
-		return
+// sharingReport lists the clients flagged for account sharing during the
+// last day.
+func (t *Tgbot) sharingReport() string {
+	flags, err := t.sharingService.GetFlags("", time.Now().Add(-24*time.Hour).Unix(), 0)
+	if err != nil || len(flags) == 0 {
+		return ""
 	}
-	for _, adminId := range adminIds {
-		t.sendBackup(int64(adminId))
+	output := t.I18nBot("tgbot.messages.sharingReport", "Count=="+strconv.Itoa(len(flags)))
+	for _, flag := range flags {
+		output += t.I18nBot("tgbot.messages.sharingFlag",
+			"Email=="+html.EscapeString(flag.Email),
+			"Detail=="+html.EscapeString(flag.Detail),
+			"Action=="+flag.Action)
+	}
+	return output
+}
+
+func (t *Tgbot) SendBackupToAdmins() {
+	// Update by manually trigger a checkpoint operation
+	err := database.Checkpoint()
+	if err != nil {
+		logger.Warning("Error in trigger a checkpoint operation: ", err)
 	}
+
+	output := t.I18nBot("tgbot.messages.backupTime", "Time=="+time.Now().Format("2006-01-02 15:04:05"))
+	t.notifyService.Notify(NotifyBackup, output, config.GetDBPath(), xray.GetConfigPath())
 }
 
 func (t *Tgbot) getServerUsage() string {
@@ -393,10 +421,6 @@ func (t *Tgbot) getServerUsage() string {
 }
 
 func (t *Tgbot) UserLoginNotify(username string, ip string, time string, status LoginStatus) {
-	if !t.IsRunning() {
-		return
-	}
-
 	if username == "" || ip == "" || time == "" {
 		logger.Warning("UserLoginNotify failed,invalid info")
 		return
@@ -417,9 +441,45 @@ func (t *Tgbot) UserLoginNotify(username string, ip string, time string, status
 	msg += t.I18nBot("tgbot.messages.hostname", "Hostname=="+hostname)
 	msg += t.I18nBot("tgbot.messages.username", "Username=="+username)
 	msg += t.I18nBot("tgbot.messages.ip", "IP=="+ip)
+	if info, ok := lookupIpInfo(ip); ok {
+		if location := info.Location(); location != "" {
+			msg += t.I18nBot("tgbot.messages.location", "Location=="+html.EscapeString(location))
+		}
+		if network := info.Network(); network != "" {
+			msg += t.I18nBot("tgbot.messages.network", "Network=="+html.EscapeString(network))
+		}
+	}
 	msg += t.I18nBot("tgbot.messages.time", "Time=="+time)
 
-	t.SendMsgToTgbotAdmins(msg)
+	t.notifyService.Notify(NotifyLogin, msg)
+}
+
+func (t *Tgbot) SendXrayCrashAlert(event *xray.RestartEvent) {
+	msg := ""
+	if event.RolledBack {
+		msg += t.I18nBot("tgbot.messages.xrayRolledBack")
+	} else {
+		msg += t.I18nBot("tgbot.messages.xrayCrashLoop")
+	}
+	msg += t.I18nBot("tgbot.messages.hostname", "Hostname=="+hostname)
+	msg += t.I18nBot("tgbot.messages.time", "Time=="+event.Time.Format("2006-01-02 15:04:05"))
+	msg += t.I18nBot("tgbot.messages.exitCode", "Code=="+strconv.Itoa(event.ExitCode))
+	if len(event.LastLines) > 0 {
+		msg += "<pre>" + html.EscapeString(strings.Join(event.LastLines, "\n")) + "</pre>\r\n"
+	}
+
+	reports, err := xray.GetCrashReports()
+	if err == nil && len(reports) > 0 {
+		msg += t.I18nBot("tgbot.messages.crashReports")
+		for i, report := range reports {
+			if i == 5 {
+				break
+			}
+			msg += "📄 " + report.Name + "\r\n"
+		}
+	}
+
+	t.notifyService.Notify(NotifyXrayCrash, msg)
 }
 
 func (t *Tgbot) getInboundUsages() string {
@@ -593,6 +653,13 @@ func (t *Tgbot) searchForClient(chatId int64, query string) {
 }
 
 func (t *Tgbot) getExhausted() string {
+	output, _ := t.exhaustedReport(true, true)
+	return output
+}
+
+// exhaustedReport lists the inbounds and clients that run out of traffic,
+// expire soon, or both. It also returns how many of them were found.
+func (t *Tgbot) exhaustedReport(byTraffic bool, byExpiry bool) (string, int) {
 	trDiff := int64(0)
 	exDiff := int64(0)
 	now := time.Now().Unix() * 1000
@@ -616,15 +683,15 @@ func (t *Tgbot) getExhausted() string {
 
 	for _, inbound := range inbounds {
 		if inbound.Enable {
-			if (inbound.ExpiryTime > 0 && (inbound.ExpiryTime-now < exDiff)) ||
-				(inbound.Total > 0 && (inbound.Total-(inbound.Up+inbound.Down) < trDiff)) {
+			if (byExpiry && inbound.ExpiryTime > 0 && (inbound.ExpiryTime-now < exDiff)) ||
+				(byTraffic && inbound.Total > 0 && (inbound.Total-(inbound.Up+inbound.Down) < trDiff)) {
 				exhaustedInbounds = append(exhaustedInbounds, *inbound)
 			}
 			if len(inbound.ClientStats) > 0 {
 				for _, client := range inbound.ClientStats {
 					if client.Enable {
-						if (client.ExpiryTime > 0 && (client.ExpiryTime-now < exDiff)) ||
-							(client.Total > 0 && (client.Total-(client.Up+client.Down) < trDiff)) {
+						if (byExpiry && client.ExpiryTime > 0 && (client.ExpiryTime-now < exDiff)) ||
+							(byTraffic && client.Total > 0 && (client.Total-(client.Up+client.Down) < trDiff)) {
 							exhaustedClients = append(exhaustedClients, client)
 						}
 					} else {
@@ -675,7 +742,7 @@ func (t *Tgbot) getExhausted() string {
 		}
 	}
 
-	return output
+	return output, len(exhaustedInbounds) + len(exhaustedClients)
 }
 
 func (t *Tgbot) onlineClients(chatId int64) {
@@ -689,7 +756,7 @@ func (t *Tgbot) onlineClients(chatId int64) {
 		keyboard := tgbotapi.NewInlineKeyboardMarkup()
 		for index, online := range onlines {
 			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d: %s\r\n", index+1, online), "client_"+online.Email)))
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d: %s\r\n", index+1, online.Email), "client_"+online.Email)))
 		}
 		t.SendMsgToTgbot(chatId, output, keyboard)
 	} else {
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"sync/atomic"
+
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/web/network"
+)
+
+var trustedProxies atomic.Pointer[network.TrustedProxies]
+
+// RefreshTrustedProxies reads the trusted proxy setting again and returns
+// the new list. An invalid setting trusts no proxy.
+func RefreshTrustedProxies() network.TrustedProxies {
+	var settingService SettingService
+	value, err := settingService.GetTrustedProxies()
+	if err != nil {
+		logger.Warning("get trusted proxies failed:", err)
+	}
+	trusted, err := network.ParseTrustedProxies(value)
+	if err != nil {
+		logger.Warning("parse trusted proxies failed:", err)
+		trusted = network.TrustedProxies{}
+	}
+	trustedProxies.Store(&trusted)
+	return trusted
+}
+
+// TrustedProxies returns the list loaded by the last RefreshTrustedProxies.
+func TrustedProxies() network.TrustedProxies {
+	if trusted := trustedProxies.Load(); trusted != nil {
+		return *trusted
+	}
+	return network.TrustedProxies{}
+}
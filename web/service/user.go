@@ -34,6 +34,7 @@ func (s *UserService) CheckUser(username string, password string) *model.User {
 		First(user).
 		Error
 	if err == gorm.ErrRecordNotFound {
+		recordLoginFailure()
 		return nil
 	} else if err != nil {
 		logger.Warning("check user err:", err)
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/database"
+	"github.com/alireza0/x-ui/database/model"
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+)
+
+// Client lifecycle events sent to the configured webhooks.
+const (
+	WebhookClientCreated   = "client.created"
+	WebhookClientUpdated   = "client.updated"
+	WebhookClientDeleted   = "client.deleted"
+	WebhookClientRenewed   = "client.renewed"
+	WebhookClientDepleted  = "client.depleted"
+	WebhookClientExpired   = "client.expired"
+	WebhookClientIpLimit   = "client.ip_limit"
+	WebhookInboundDisabled = "inbound.disabled"
+)
+
+const (
+	WebhookPending = "pending"
+	WebhookSuccess = "success"
+	WebhookFailed  = "failed"
+)
+
+const (
+	webhookMaxAttempts   = 8
+	webhookRetryBase     = 30 * time.Second
+	webhookRetryMax      = time.Hour
+	maxWebhookDeliveries = 2000
+)
+
+// Webhook is one entry of the clientWebhooks setting. A webhook without
+// events receives all of them.
+type Webhook struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (w *Webhook) wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type webhookEvent struct {
+	event string
+	data  any
+	time  time.Time
+}
+
+var (
+	webhookQueue     = make(chan webhookEvent, 1024)
+	webhookStartOnce sync.Once
+	webhookLock      sync.Mutex
+	webhookClient    = &http.Client{Timeout: 15 * time.Second}
+)
+
+// emitWebhook queues a lifecycle event. The event is stored and delivered by
+// a background worker, so callers are never blocked. Changes made in a
+// transaction collect their events in a webhookBatch instead.
+func emitWebhook(event string, data any) {
+	queueWebhook(webhookEvent{event: event, data: data, time: time.Now()})
+}
+
+func queueWebhook(e webhookEvent) {
+	webhookStartOnce.Do(func() {
+		go webhookWorker()
+	})
+	select {
+	case webhookQueue <- e:
+	default:
+		logger.Warning("webhook queue is full, event dropped:", e.event)
+	}
+}
+
+// webhookBatch holds the events of a transaction until it commits, so a
+// rolled back change is never announced.
+type webhookBatch []webhookEvent
+
+func (b *webhookBatch) add(event string, data any) {
+	*b = append(*b, webhookEvent{event: event, data: data, time: time.Now()})
+}
+
+// addClientChanges adds the created, updated and deleted events between the
+// clients of an inbound before and after a change. Clients are matched by
+// the key of their protocol first, so a renamed client is one update that
+// carries its previous email.
+func (b *webhookBatch) addClientChanges(inboundId int, protocol model.Protocol, oldClients, newClients []model.Client) {
+	byKey := make(map[string]int, len(oldClients))
+	byEmail := make(map[string]int, len(oldClients))
+	for i, client := range oldClients {
+		if client.Email == "" {
+			continue
+		}
+		if key := inboundClientKey(protocol, client); key != "" {
+			byKey[key] = i
+		}
+		byEmail[client.Email] = i
+	}
+	matched := make(map[int]bool, len(oldClients))
+	find := func(index map[string]int, key string) (int, bool) {
+		i, ok := index[key]
+		if !ok || key == "" || matched[i] {
+			return 0, false
+		}
+		return i, true
+	}
+	for _, client := range newClients {
+		if client.Email == "" {
+			continue
+		}
+		i, ok := find(byKey, inboundClientKey(protocol, client))
+		if !ok {
+			i, ok = find(byEmail, client.Email)
+		}
+		if !ok {
+			b.add(WebhookClientCreated, map[string]any{"inboundId": inboundId, "email": client.Email, "client": client})
+			continue
+		}
+		matched[i] = true
+		if !reflect.DeepEqual(oldClients[i], client) {
+			b.add(WebhookClientUpdated, map[string]any{"inboundId": inboundId, "email": client.Email, "oldEmail": oldClients[i].Email, "client": client})
+		}
+	}
+	for i, client := range oldClients {
+		if client.Email != "" && !matched[i] {
+			b.add(WebhookClientDeleted, map[string]any{"inboundId": inboundId, "email": client.Email})
+		}
+	}
+}
+
+// inboundClientKey returns the field a client of protocol is identified by,
+// the same one UpdateInboundClient matches on.
+func inboundClientKey(protocol model.Protocol, client model.Client) string {
+	switch protocol {
+	case model.Trojan:
+		return client.Password
+	case model.Shadowsocks:
+		return client.Email
+	case model.Hysteria:
+		return client.Auth
+	}
+	return client.ID
+}
+
+// emit queues the collected events.
+func (b webhookBatch) emit() {
+	for _, e := range b {
+		queueWebhook(e)
+	}
+}
+
+func webhookWorker() {
+	s := &WebhookService{}
+	for e := range webhookQueue {
+		if err := s.enqueue(e); err != nil {
+			logger.Warning("queue webhook", e.event, "failed:", err)
+			continue
+		}
+		s.ProcessDue()
+	}
+}
+
+type WebhookService struct {
+	settingService SettingService
+}
+
+func (s *WebhookService) GetWebhooks() ([]Webhook, error) {
+	hooksJson, err := s.settingService.GetClientWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]Webhook, 0)
+	if strings.TrimSpace(hooksJson) == "" {
+		return hooks, nil
+	}
+	err = json.Unmarshal([]byte(hooksJson), &hooks)
+	return hooks, err
+}
+
+func (s *WebhookService) enqueue(e webhookEvent) error {
+	hooks, err := s.GetWebhooks()
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	payload, err := json.Marshal(map[string]any{
+		"event":    e.event,
+		"time":     e.time.Unix(),
+		"hostname": hostname,
+		"data":     e.data,
+	})
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	for _, hook := range hooks {
+		if !hook.wants(e.event) {
+			continue
+		}
+		delivery := &model.WebhookDelivery{
+			Event:       e.event,
+			Url:         hook.Url,
+			Payload:     string(payload),
+			Status:      WebhookPending,
+			CreatedAt:   e.time.Unix(),
+			NextAttempt: e.time.Unix(),
+		}
+		if err := db.Create(delivery).Error; err != nil {
+			return err
+		}
+	}
+	// deliveries still waiting for a retry are kept
+	return db.Where("status <> ? AND id <= (SELECT MAX(id) FROM webhook_deliveries) - ?", WebhookPending, maxWebhookDeliveries).
+		Delete(&model.WebhookDelivery{}).Error
+}
+
+// ProcessDue sends every pending delivery whose next attempt is due. Failed
+// attempts are retried with exponential backoff until webhookMaxAttempts.
+func (s *WebhookService) ProcessDue() {
+	if !webhookLock.TryLock() {
+		return
+	}
+	defer webhookLock.Unlock()
+
+	db := database.GetDB()
+	var deliveries []*model.WebhookDelivery
+	err := db.Where("status = ? AND next_attempt <= ?", WebhookPending, time.Now().Unix()).
+		Order("id asc").Find(&deliveries).Error
+	if err != nil {
+		logger.Warning("load webhook deliveries failed:", err)
+		return
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	secrets := make(map[string]string)
+	hooks, _ := s.GetWebhooks()
+	for _, hook := range hooks {
+		secrets[hook.Url] = hook.Secret
+	}
+
+	for _, delivery := range deliveries {
+		code, err := s.send(delivery, secrets[delivery.Url])
+		delivery.Attempts++
+		delivery.ResponseCode = code
+		delivery.UpdatedAt = time.Now().Unix()
+		if err == nil {
+			delivery.Status = WebhookSuccess
+			delivery.Error = ""
+		} else {
+			delivery.Error = err.Error()
+			if delivery.Attempts >= webhookMaxAttempts {
+				delivery.Status = WebhookFailed
+				logger.Warningf("webhook %s to %s failed after %d attempts: %v", delivery.Event, delivery.Url, delivery.Attempts, err)
+			} else {
+				backoff := min(webhookRetryBase<<(delivery.Attempts-1), webhookRetryMax)
+				delivery.NextAttempt = time.Now().Add(backoff).Unix()
+			}
+		}
+		if err := db.Save(delivery).Error; err != nil {
+			logger.Warning("save webhook delivery failed:", err)
+		}
+	}
+}
+
+func (s *WebhookService) send(delivery *model.WebhookDelivery, secret string) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-XUI-Event", delivery.Event)
+	req.Header.Set("X-XUI-Delivery", strconv.FormatInt(delivery.Id, 10))
+	if secret != "" {
+		req.Header.Set("X-XUI-Signature", signPayload(secret, body))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, common.NewErrorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// GetDeliveries returns the latest deliveries, newest first.
+func (s *WebhookService) GetDeliveries(status string, limit int) ([]*model.WebhookDelivery, error) {
+	if limit <= 0 || limit > maxWebhookDeliveries {
+		limit = 200
+	}
+	db := database.GetDB().Model(model.WebhookDelivery{})
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	deliveries := make([]*model.WebhookDelivery, 0)
+	err := db.Order("id desc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Replay queues the payload of a delivery again as a new delivery.
+func (s *WebhookService) Replay(id int64) (*model.WebhookDelivery, error) {
+	db := database.GetDB()
+	old := &model.WebhookDelivery{}
+	if err := db.First(old, id).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	delivery := &model.WebhookDelivery{
+		Event:       old.Event,
+		Url:         old.Url,
+		Payload:     old.Payload,
+		Status:      WebhookPending,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+	if err := db.Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	go s.ProcessDue()
+	return delivery, nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/alireza0/x-ui/database/model"
+)
+
+func TestWebhookBatchAddClientChanges(t *testing.T) {
+	oldClients := []model.Client{
+		{Email: "kept", TotalGB: 1},
+		{Email: "changed", TotalGB: 1},
+		{Email: "removed"},
+		{Email: ""},
+	}
+	newClients := []model.Client{
+		{Email: "kept", TotalGB: 1},
+		{Email: "changed", TotalGB: 2},
+		{Email: "added"},
+		{Email: ""},
+	}
+
+	var events webhookBatch
+	events.addClientChanges(7, model.VLESS, oldClients, newClients)
+	got := make(map[string]string)
+	for _, e := range events {
+		data := e.data.(map[string]any)
+		if data["inboundId"] != 7 {
+			t.Errorf("%s has inbound %v", e.event, data["inboundId"])
+		}
+		got[data["email"].(string)] = e.event
+	}
+	want := map[string]string{
+		"changed": WebhookClientUpdated,
+		"added":   WebhookClientCreated,
+		"removed": WebhookClientDeleted,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+	for email, event := range want {
+		if got[email] != event {
+			t.Errorf("%s: got %q, want %q", email, got[email], event)
+		}
+	}
+}
+
+func TestWebhookBatchNewInbound(t *testing.T) {
+	var events webhookBatch
+	events.addClientChanges(1, model.VLESS, nil, []model.Client{{Email: "a"}, {Email: "b"}})
+	if len(events) != 2 || events[0].event != WebhookClientCreated || events[1].event != WebhookClientCreated {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func TestWebhookBatchRenamedClient(t *testing.T) {
+	tests := []struct {
+		protocol  model.Protocol
+		oldClient model.Client
+		newClient model.Client
+	}{
+		{model.VLESS, model.Client{ID: "uuid", Email: "old"}, model.Client{ID: "uuid", Email: "new"}},
+		{model.Trojan, model.Client{Password: "pass", Email: "old"}, model.Client{Password: "pass", Email: "new"}},
+		{model.Hysteria, model.Client{Auth: "auth", Email: "old"}, model.Client{Auth: "auth", Email: "new"}},
+	}
+	for _, test := range tests {
+		var events webhookBatch
+		events.addClientChanges(3, test.protocol, []model.Client{test.oldClient}, []model.Client{test.newClient})
+		if len(events) != 1 || events[0].event != WebhookClientUpdated {
+			t.Errorf("%s: got events %v, want one update", test.protocol, events)
+			continue
+		}
+		data := events[0].data.(map[string]any)
+		if data["email"] != "new" || data["oldEmail"] != "old" {
+			t.Errorf("%s: got email %v and old email %v", test.protocol, data["email"], data["oldEmail"])
+		}
+	}
+}
+
+func TestWebhookBatchChangedKey(t *testing.T) {
+	// a new id with the same email is still the same client
+	var events webhookBatch
+	events.addClientChanges(3, model.VLESS, []model.Client{{ID: "a", Email: "user"}}, []model.Client{{ID: "b", Email: "user"}})
+	if len(events) != 1 || events[0].event != WebhookClientUpdated {
+		t.Errorf("got events %v, want one update", events)
+	}
+}
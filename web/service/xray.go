@@ -8,6 +8,7 @@ import (
 
 	"github.com/alireza0/x-ui/logger"
 	"github.com/alireza0/x-ui/util/json_util"
+	"github.com/alireza0/x-ui/web/events"
 	"github.com/alireza0/x-ui/xray"
 
 	"go.uber.org/atomic"
@@ -18,6 +19,8 @@ var (
 	lock              sync.Mutex
 	isNeedXrayRestart atomic.Bool
 	result            string
+	xrayAPI           = xray.NewXrayAPI()
+	supervisor        = xray.NewSupervisor()
 )
 
 type XrayService struct {
@@ -26,7 +29,7 @@ type XrayService struct {
 	routingRuleService RoutingRuleService
 	settingService     SettingService
 	xraySettingService XraySettingService
-	xrayAPI            xray.XrayAPI
+	certificateService CertificateService
 }
 
 func (s *XrayService) IsXrayRunning() bool {
@@ -174,6 +177,7 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 			if ok1 || ok2 {
 				if ok1 {
 					delete(tlsSettings, "settings")
+					s.certificateService.ResolveCertificates(tlsSettings)
 				} else if ok2 {
 					delete(realitySettings, "settings")
 				}
@@ -232,11 +236,10 @@ func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic,
 	if !s.IsXrayRunning() {
 		return nil, nil, errors.New("xray is not running")
 	}
-	if err := s.xrayAPI.Init(p.GetAPIAddr()); err != nil {
+	if err := xrayAPI.Init(p.GetAPIAddr()); err != nil {
 		return nil, nil, err
 	}
-	defer s.xrayAPI.Close()
-	return s.xrayAPI.GetTraffic(true)
+	return xrayAPI.GetTraffic(true)
 }
 
 func (s *XrayService) RefreshOnlineUsersCache() error {
@@ -244,12 +247,11 @@ func (s *XrayService) RefreshOnlineUsersCache() error {
 		ClearOnlineUsersCache()
 		return nil
 	}
-	if err := s.xrayAPI.Init(p.GetAPIAddr()); err != nil {
+	if err := xrayAPI.Init(p.GetAPIAddr()); err != nil {
 		return err
 	}
-	defer s.xrayAPI.Close()
 
-	users, err := s.xrayAPI.GetUsersOnlineInfo()
+	users, err := xrayAPI.GetUsersOnlineInfo()
 	if err != nil {
 		return err
 	}
@@ -257,6 +259,13 @@ func (s *XrayService) RefreshOnlineUsersCache() error {
 	return nil
 }
 
+func (s *XrayService) GetXrayAPIHealth() xray.APIHealth {
+	if s.IsXrayRunning() {
+		xrayAPI.Init(p.GetAPIAddr())
+	}
+	return xrayAPI.Health()
+}
+
 func (s *XrayService) GetOnlineUsers() []xray.OnlineUserInfo {
 	return GetOnlineUsersCache()
 }
@@ -271,30 +280,123 @@ func (s *XrayService) RestartXray(isForce bool) error {
 		return err
 	}
 
+	if p != nil && p.HasExited() && !isForce {
+		// a crashed core is brought back by the supervisor, which honours its backoff
+		_, err = s.superviseLocked(xrayConfig)
+		return err
+	}
+
 	if p != nil && p.IsRunning() {
 		if !isForce && p.GetConfig().Equals(xrayConfig) {
 			logger.Debug("It does not need to restart xray")
 			return nil
 		}
+		if !isForce && supervisor.KeepRollback(xrayConfig) {
+			logger.Debug("Keeping the last known-good xray config")
+			return nil
+		}
 		p.Stop()
 	}
 
+	supervisor.Reset()
+	return s.startLocked(xrayConfig)
+}
+
+// Supervise restarts the core if it exited on its own, applying the
+// supervisor's backoff and crash-loop rollback. The returned event is non-nil
+// when the admins should be alerted.
+func (s *XrayService) Supervise() (*xray.RestartEvent, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if p == nil {
+		return nil, nil
+	}
+	if p.IsRunning() {
+		supervisor.MarkRunning(p)
+		return nil, nil
+	}
+	if !p.HasExited() {
+		return nil, nil
+	}
+
+	xrayConfig, err := s.GetXrayConfig()
+	if err != nil {
+		logger.Warning("generate xray config failed:", err)
+	}
+	return s.superviseLocked(xrayConfig)
+}
+
+func (s *XrayService) superviseLocked(xrayConfig *xray.Config) (*xray.RestartEvent, error) {
+	var alert *xray.RestartEvent
+	event := supervisor.RecordExit(p)
+	if event != nil {
+		publishXrayState("crashed", event.Error)
+		ClearOnlineUsersCache()
+		if event.CrashLoop {
+			alert = event
+		}
+	}
+	if !supervisor.ReadyToRestart() {
+		return alert, nil
+	}
+
+	restartConfig, rollback := supervisor.RestartConfig(xrayConfig)
+	if rollback != nil {
+		alert = rollback
+	}
+	if restartConfig == nil {
+		return alert, errors.New("no xray config to restart with")
+	}
+	return alert, s.startLocked(restartConfig)
+}
+
+func (s *XrayService) startLocked(xrayConfig *xray.Config) error {
 	p = xray.NewProcess(xrayConfig)
 	result = ""
-	err = p.Start()
+	err := p.Start()
 	if err != nil {
+		publishXrayState("error", err.Error())
 		return err
 	}
+	publishXrayState("running", "")
 	return nil
 }
 
+func publishXrayState(state string, msg string) {
+	version := "Unknown"
+	if p != nil {
+		version = p.GetVersion()
+	}
+	events.Publish(events.Xray, map[string]string{
+		"state":   state,
+		"error":   msg,
+		"version": version,
+	})
+}
+
+func (s *XrayService) GetSupervisorState() xray.SupervisorState {
+	return supervisor.GetState()
+}
+
+func (s *XrayService) GetCrashReports() ([]xray.CrashReport, error) {
+	return xray.GetCrashReports()
+}
+
+func (s *XrayService) ReadCrashReport(name string) (string, error) {
+	return xray.ReadCrashReport(name)
+}
+
 func (s *XrayService) StopXray() error {
 	lock.Lock()
 	defer lock.Unlock()
 	logger.Debug("stop xray")
 	ClearOnlineUsersCache()
+	xrayAPI.Close()
 	if s.IsXrayRunning() {
-		return p.Stop()
+		err := p.Stop()
+		publishXrayState("stopped", "")
+		return err
 	}
 	return errors.New("xray is not running")
 }
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/alireza0/x-ui/logger"
+	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/xray"
+)
+
+const defaultXrayReleaseUrl = "https://github.com/XTLS/Xray-core/releases/download"
+
+// xrayHealthCheckTime is how long a freshly activated core has to stay up
+// before the switch is considered successful.
+const xrayHealthCheckTime = 5 * time.Second
+
+func getXrayArchiveName() string {
+	osName := runtime.GOOS
+	arch := runtime.GOARCH
+
+	switch osName {
+	case "darwin":
+		osName = "macos"
+	case "windows":
+		osName = "windows"
+	}
+
+	switch arch {
+	case "amd64":
+		arch = "64"
+	case "arm64":
+		arch = "arm64-v8a"
+	case "armv7":
+		arch = "arm32-v7a"
+	case "armv6":
+		arch = "arm32-v6"
+	case "armv5":
+		arch = "arm32-v5"
+	case "386":
+		arch = "32"
+	case "s390x":
+		arch = "s390x"
+	}
+
+	return fmt.Sprintf("Xray-%s-%s.zip", osName, arch)
+}
+
+func getXrayArchiveBinaryName() string {
+	if runtime.GOOS == "windows" {
+		return "xray.exe"
+	}
+	return "xray"
+}
+
+func (s *ServerService) downloadXRay(version string) (string, error) {
+	if err := xray.CheckVersionName(version); err != nil {
+		return "", err
+	}
+	baseUrl, err := s.settingService.GetXrayMirrorUrl()
+	if err != nil || baseUrl == "" {
+		baseUrl = defaultXrayReleaseUrl
+	}
+	url := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(baseUrl, "/"), version, getXrayArchiveName())
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", common.NewErrorf("download %s failed: %s", url, resp.Status)
+	}
+
+	file, err := os.CreateTemp("", "xray-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// extractXrayArchive stores the core binary of a release zip under version.
+// An empty version is read from the extracted binary itself.
+func (s *ServerService) extractXrayArchive(zipFileName string, version string) (string, error) {
+	reader, err := zip.OpenReader(zipFileName)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	binary, err := reader.Open(getXrayArchiveBinaryName())
+	if err != nil {
+		return "", common.NewError("xray binary not found in archive:", err)
+	}
+	defer binary.Close()
+
+	tmp, err := os.CreateTemp("", "xray-bin-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, binary)
+	tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	os.Chmod(tmp.Name(), 0o755)
+
+	if version == "" {
+		version, err = xray.ReadBinaryVersion(tmp.Name())
+		if err != nil {
+			return "", common.NewError("unable to detect xray version of archive:", err)
+		}
+	}
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return version, xray.InstallVersion(version, file)
+}
+
+func (s *ServerService) GetInstalledXrayVersions() ([]xray.InstalledVersion, error) {
+	if err := xray.TrackCurrentBinary(); err != nil {
+		logger.Warning("track current xray binary failed:", err)
+	}
+	return xray.ListInstalledVersions()
+}
+
+// UpdateXray downloads version from the configured mirror, keeps it next to
+// the already installed versions and switches to it.
+func (s *ServerService) UpdateXray(version string) error {
+	if err := xray.TrackCurrentBinary(); err != nil {
+		logger.Warning("track current xray binary failed:", err)
+	}
+
+	zipFileName, err := s.downloadXRay(version)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(zipFileName)
+
+	if _, err = s.extractXrayArchive(zipFileName, version); err != nil {
+		return err
+	}
+	return s.ActivateXrayVersion(version)
+}
+
+// InstallXrayArchive installs an uploaded release zip and switches to it.
+func (s *ServerService) InstallXrayArchive(archive io.Reader) error {
+	if err := xray.TrackCurrentBinary(); err != nil {
+		logger.Warning("track current xray binary failed:", err)
+	}
+
+	tmp, err := os.CreateTemp("", "xray-upload-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, archive)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	version, err := s.extractXrayArchive(tmp.Name(), "")
+	if err != nil {
+		return err
+	}
+	return s.ActivateXrayVersion(version)
+}
+
+// ActivateXrayVersion switches the core to an installed version. If the core
+// does not stay up with the current config, the previous version is restored.
+func (s *ServerService) ActivateXrayVersion(version string) error {
+	if err := xray.TrackCurrentBinary(); err != nil {
+		logger.Warning("track current xray binary failed:", err)
+	}
+	previous := xray.GetActiveVersion()
+
+	if err := s.switchXrayVersion(version); err == nil {
+		return nil
+	} else if previous == "" || previous == version {
+		return err
+	} else {
+		logger.Warningf("xray %s failed health check, reverting to %s: %v", version, previous, err)
+		if revertErr := s.switchXrayVersion(previous); revertErr != nil {
+			return common.NewErrorf("xray %s failed: %v; reverting to %s failed: %v", version, err, previous, revertErr)
+		}
+		return common.NewErrorf("xray %s failed to start, reverted to %s: %v", version, previous, err)
+	}
+}
+
+func (s *ServerService) switchXrayVersion(version string) error {
+	if err := s.StopXrayService(); err != nil {
+		logger.Debug("stop xray before switching version:", err)
+	}
+	if err := xray.ActivateVersion(version); err != nil {
+		return err
+	}
+	if err := s.xrayService.RestartXray(true); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(xrayHealthCheckTime)
+	for time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+		if !s.xrayService.IsXrayRunning() {
+			if msg := s.xrayService.GetXrayResult(); msg != "" {
+				return common.NewError(msg)
+			}
+			return common.NewError("xray exited right after start")
+		}
+	}
+	return nil
+}
+
+func (s *ServerService) RemoveXrayVersion(version string) error {
+	return xray.RemoveVersion(version)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"embed"
+	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
@@ -19,8 +20,10 @@ import (
 	"github.com/alireza0/x-ui/logger"
 	"github.com/alireza0/x-ui/util/common"
 	"github.com/alireza0/x-ui/web/controller"
+	"github.com/alireza0/x-ui/web/events"
 	"github.com/alireza0/x-ui/web/job"
 	"github.com/alireza0/x-ui/web/locale"
+	"github.com/alireza0/x-ui/web/metrics"
 	"github.com/alireza0/x-ui/web/middleware"
 	"github.com/alireza0/x-ui/web/network"
 	"github.com/alireza0/x-ui/web/service"
@@ -80,8 +83,10 @@ func (f *wrapAssetsFileInfo) ModTime() time.Time {
 }
 
 type Server struct {
-	httpServer *http.Server
-	listener   net.Listener
+	httpServer    *http.Server
+	listener      net.Listener
+	metricsServer *http.Server
+	certReloader  *network.CertReloader
 
 	index  *controller.IndexController
 	server *controller.ServerController
@@ -92,6 +97,7 @@ type Server struct {
 	xrayService    service.XrayService
 	settingService service.SettingService
 	tgbotService   service.Tgbot
+	notifyService  service.NotifyService
 
 	cron *cron.Cron
 
@@ -159,6 +165,7 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 
 	engine := gin.Default()
+	engine.Use(middleware.RequestIdMiddleware())
 
 	webDomain, err := s.settingService.GetWebDomain()
 	if err != nil {
@@ -196,9 +203,11 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 	store.Options(sessionOptions)
 	engine.Use(sessions.Sessions("x-ui", store))
-	iplimitSupported := "true"
+	// iplimitSupported is the name of the firewall backend, empty if none
+	// is usable.
+	iplimitSupported := s.ipLimitFw.Backend()
 	if !s.ipLimitFw.Supported() {
-		iplimitSupported = "false"
+		iplimitSupported = ""
 	}
 	engine.Use(func(c *gin.Context) {
 		c.Set("base_path", basePath)
@@ -224,6 +233,32 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	engine.FuncMap["i18n"] = i18nWebFunc
 	engine.Use(locale.LocalizerMiddleware())
 
+	// the challenge must stay reachable for the CA, so it is registered
+	// before the allowlist
+	engine.GET("/.well-known/acme-challenge/:token", gin.WrapF(service.ServeAcmeChallenge))
+
+	webAllowedIps, err := s.settingService.GetWebAllowedIps()
+	if err != nil {
+		return nil, err
+	}
+	apiAllowedIps, err := s.settingService.GetApiAllowedIps()
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := network.ParseNetworks(webAllowedIps)
+	if err != nil {
+		return nil, err
+	}
+	apiAllowed, err := network.ParseNetworks(apiAllowedIps)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowed) > 0 || len(apiAllowed) > 0 {
+		engine.Use(middleware.IpAllowMiddleware(allowed, apiAllowed, basePath+"xui/API", func(r *http.Request) string {
+			return service.TrustedProxies().ClientIP(r)
+		}))
+	}
+
 	// set static files and template
 	if config.IsDebug() {
 		// for development
@@ -250,6 +285,12 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	s.xui = controller.NewXUIController(g)
 	s.api = controller.NewAPIController(g, s.server)
 
+	metricsEnable, _ := s.settingService.GetMetricsEnable()
+	metricsListen, _ := s.settingService.GetMetricsListen()
+	if metricsEnable && metricsListen == "" {
+		g.GET("/metrics", controller.NewMetricsController().Handler)
+	}
+
 	engine.NoRoute(func(c *gin.Context) {
 		c.AbortWithStatus(http.StatusNotFound)
 	})
@@ -262,11 +303,12 @@ func (s *Server) startTask(ipLimitCron bool) {
 	if err != nil {
 		logger.Warning("start xray failed:", err)
 	}
-	// Check whether xray is running every 30 seconds
-	s.cron.AddJob("@every 30s", job.NewCheckXrayRunningJob())
+	// Supervise xray and restart it with backoff if it exits
+	s.cron.AddJob("@every 5s", metrics.TimedJob("check_xray_running", job.NewCheckXrayRunningJob()))
 
 	// Process ip online and ip limit
-	s.cron.AddJob("@every 2s", job.NewIpLimitJob())
+	s.cron.AddJob("@every 2s", metrics.TimedJob("ip_limit", job.NewIpLimitJob()))
+	s.cron.AddJob("@every 1m", metrics.TimedJob("ip_limit_state", job.NewIpLimitStateJob()))
 
 	// Check if xray needs to be restarted
 	s.cron.AddFunc("@every 10s", func() {
@@ -281,20 +323,63 @@ func (s *Server) startTask(ipLimitCron bool) {
 	go func() {
 		time.Sleep(time.Second * 5)
 		// Statistics every 10 seconds, start the delay for 5 seconds for the first time, and staggered with the time to restart xray
-		s.cron.AddJob("@every 10s", job.NewXrayTrafficJob())
+		s.cron.AddJob("@every 10s", metrics.TimedJob("xray_traffic", job.NewXrayTrafficJob()))
 	}()
 
+	// Record server resource history
+	metricsInterval, err := s.settingService.GetServerMetricsInterval()
+	if err == nil && metricsInterval > 0 {
+		s.cron.AddJob(fmt.Sprintf("@every %ds", metricsInterval), metrics.TimedJob("server_metrics", job.NewServerMetricJob()))
+	}
+
+	// Evaluate alert rules
+	s.cron.AddJob("@every 30s", metrics.TimedJob("alert", job.NewAlertJob()))
+
+	// Retry pending client webhook deliveries
+	s.cron.AddJob("@every 30s", metrics.TimedJob("webhook", job.NewWebhookJob()))
+
+	// Ingest the xray access log
+	s.cron.AddJob("@every 10s", metrics.TimedJob("access_log", job.NewAccessLogJob()))
+
+	// Store client ip history and look for shared accounts
+	s.cron.AddJob("@every 1m", metrics.TimedJob("ip_history", job.NewIpHistoryJob()))
+	s.cron.AddJob("@every 10m", metrics.TimedJob("sharing", job.NewSharingJob()))
+
+	// Keep the country access rules of the inbounds up to date
+	s.cron.AddJob("@every 5m", metrics.TimedJob("geo_access", job.NewGeoAccessJob()))
+
+	// Lift expired manual bans
+	s.cron.AddJob("@every 1m", metrics.TimedJob("ip_access", job.NewIpAccessJob()))
+
+	// Reconcile the host firewall with the enabled inbounds
+	s.cron.AddJob("@every 5m", metrics.TimedJob("host_firewall", job.NewHostFirewallJob()))
+
+	// Order and renew the automatic certificates
+	s.cron.AddJob("@every 12h", metrics.TimedJob("acme", job.NewAcmeJob()))
+	service.RefreshAcme()
+
+	// Renew the stored certificates and warn before they expire
+	s.cron.AddJob("@every 12h", metrics.TimedJob("certificate", job.NewCertificateJob()))
+
+	// Update geo data files from the configured sources
+	geoUpdateCron, err := s.settingService.GetGeoUpdateCron()
+	if err == nil && geoUpdateCron != "" {
+		_, err = s.cron.AddJob(geoUpdateCron, metrics.TimedJob("geo_update", job.NewGeoUpdateJob()))
+		if err != nil {
+			logger.Warning("Add NewGeoUpdateJob error", err)
+		}
+	}
+
 	// Make a traffic condition every day, 8:30
 	var entry cron.EntryID
-	isTgbotenabled, err := s.settingService.GetTgbotenabled()
-	if (err == nil) && (isTgbotenabled) {
+	if s.notifyService.IsEnabled() {
 		runtime, err := s.settingService.GetTgbotRuntime()
 		if err != nil || runtime == "" {
 			logger.Errorf("Add NewStatsNotifyJob error[%s], Runtime[%s] invalid, will run default", err, runtime)
 			runtime = "@daily"
 		}
-		logger.Infof("Tg notify enabled,run at %s", runtime)
-		_, err = s.cron.AddJob(runtime, job.NewStatsNotifyJob())
+		logger.Infof("Notify enabled,run at %s", runtime)
+		_, err = s.cron.AddJob(runtime, metrics.TimedJob("stats_notify", job.NewStatsNotifyJob()))
 		if err != nil {
 			logger.Warning("Add NewStatsNotifyJob error", err)
 			return
@@ -303,7 +388,7 @@ func (s *Server) startTask(ipLimitCron bool) {
 		// Check CPU load and alarm to TgBot if threshold passes
 		cpuThreshold, err := s.settingService.GetTgCpu()
 		if (err == nil) && (cpuThreshold > 0) {
-			s.cron.AddJob("@every 10s", job.NewCheckCpuJob())
+			s.cron.AddJob("@every 10s", metrics.TimedJob("check_cpu", job.NewCheckCpuJob()))
 		}
 	} else {
 		s.cron.Remove(entry)
@@ -318,7 +403,8 @@ func (s *Server) Start() (err error) {
 		}
 	}()
 
-	s.ipLimitFw = iplimit.NewFirewall()
+	ipLimitBackend, _ := s.settingService.GetIpLimitBackend()
+	s.ipLimitFw = iplimit.NewFirewall(ipLimitBackend)
 	if s.ipLimitFw.Supported() {
 		if err := s.ipLimitFw.Init(); err != nil {
 			logger.Error("init iplimit failed:", err)
@@ -329,6 +415,8 @@ func (s *Server) Start() (err error) {
 	if err := service.InitOnlineStore(s.ipLimitFw, ipBlockAfterRemove); err != nil {
 		logger.Warning("init online store failed:", err)
 	}
+	service.RefreshGeoAccess()
+	service.RefreshIpAccess()
 
 	loc, err := s.settingService.GetTimeLocation()
 	if err != nil {
@@ -350,6 +438,14 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	webAcme, err := s.settingService.GetWebAcme()
+	if err != nil {
+		return err
+	}
+	webDomain, err := s.settingService.GetWebDomain()
+	if err != nil {
+		return err
+	}
 	listen, err := s.settingService.GetListen()
 	if err != nil {
 		return err
@@ -358,28 +454,68 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
-	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
-	listener, err := net.Listen("tcp", listenAddr)
+	listenSocket, err := s.settingService.GetWebListenSocket()
 	if err != nil {
 		return err
 	}
+	proxyProtocol, err := s.settingService.GetWebProxyProtocol()
+	if err != nil {
+		return err
+	}
+	trusted := service.RefreshTrustedProxies()
+
+	var listener net.Listener
+	if listenSocket != "" {
+		listener, err = network.ListenUnix(listenSocket)
+	} else {
+		listener, err = net.Listen("tcp", net.JoinHostPort(listen, strconv.Itoa(port)))
+	}
+	if err != nil {
+		return err
+	}
+	if proxyProtocol {
+		listener = network.NewProxyProtocolListener(listener, trusted)
+	}
+	var reloader *network.CertReloader
 	if certFile != "" || keyFile != "" {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		loaded, err := network.NewCertReloader(certFile, keyFile)
 		if err == nil {
-			c := &tls.Config{
-				Certificates: []tls.Certificate{cert},
-			}
-			listener = network.NewAutoHttpsListener(listener)
-			listener = tls.NewListener(listener, c)
-			logger.Info("Web server running HTTPS on", listener.Addr())
+			reloader = loaded
 		} else {
 			logger.Error("Error loading certificates:", err)
-			logger.Info("Web server running HTTP on", listener.Addr())
 		}
+	}
+	var tlsConfig *tls.Config
+	if webAcme && webDomain != "" {
+		var fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+		if reloader != nil {
+			fallback = reloader.GetCertificate
+		}
+		tlsConfig = service.AcmeTLSConfig(webDomain, fallback)
+	} else if reloader != nil {
+		tlsConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+	if reloader != nil {
+		s.certReloader = reloader
+		go reloader.Watch(s.ctx)
+	}
+	if tlsConfig != nil {
+		listener = network.NewAutoHttpsListener(listener)
+		listener = tls.NewListener(listener, tlsConfig)
+		logger.Info("Web server running HTTPS on", listener.Addr())
 	} else {
 		logger.Info("Web server running HTTP on", listener.Addr())
 	}
 	s.listener = listener
+	if listenSocket != "" {
+		// nothing to keep open for the panel
+		service.SetHostFirewallPanelPort(0)
+	} else {
+		service.SetHostFirewallPanelPort(port)
+	}
+	service.RefreshHostFirewall()
 
 	s.httpServer = &http.Server{
 		Handler: engine,
@@ -389,6 +525,17 @@ func (s *Server) Start() (err error) {
 		s.httpServer.Serve(listener)
 	}()
 
+	if err := s.startMetricsServer(); err != nil {
+		logger.Warning("start metrics server failed:", err)
+	}
+
+	logger.SetListener(func(time string, level string, log string) {
+		if level != "DEBUG" {
+			events.Publish(events.Log, map[string]string{"time": time, "level": level, "log": log})
+		}
+	})
+
+	s.tgbotService.SetHostname()
 	s.startTask(s.ipLimitFw.Supported())
 
 	isTgbotenabled, err := s.settingService.GetTgbotenabled()
@@ -400,9 +547,40 @@ func (s *Server) Start() (err error) {
 	return nil
 }
 
+// startMetricsServer serves /metrics on its own address when one is set, so
+// scrapers do not need access to the panel port.
+func (s *Server) startMetricsServer() error {
+	enable, err := s.settingService.GetMetricsEnable()
+	if err != nil || !enable {
+		return err
+	}
+	listen, err := s.settingService.GetMetricsListen()
+	if err != nil || listen == "" {
+		return err
+	}
+
+	engine := gin.New()
+	engine.GET("/metrics", controller.NewMetricsController().Handler)
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	logger.Info("Metrics server running HTTP on", listener.Addr())
+	s.metricsServer = &http.Server{
+		Handler: engine,
+	}
+	go func() {
+		s.metricsServer.Serve(listener)
+	}()
+	return nil
+}
+
 func (s *Server) Stop() error {
 	s.cancel()
 	s.xrayService.StopXray()
+	if err := service.SaveIpLimitState(); err != nil {
+		logger.Warning("save iplimit state failed:", err)
+	}
 	if s.ipLimitFw != nil {
 		if err := s.ipLimitFw.Stop(); err != nil {
 			logger.Warning("stop iplimit failed:", err)
@@ -414,6 +592,9 @@ func (s *Server) Stop() error {
 	if s.tgbotService.IsRunning() {
 		s.tgbotService.Stop()
 	}
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
+	}
 	var err1 error
 	var err2 error
 	if s.httpServer != nil {
@@ -429,6 +610,15 @@ func (s *Server) GetCtx() context.Context {
 	return s.ctx
 }
 
+// ReloadCert loads the certificate files of the listener again. It does
+// nothing if the listener serves no certificate files.
+func (s *Server) ReloadCert() error {
+	if s.certReloader == nil {
+		return nil
+	}
+	return s.certReloader.Reload()
+}
+
 func (s *Server) GetCron() *cron.Cron {
 	return s.cron
 }
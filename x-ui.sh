@@ -675,7 +675,8 @@ ssl_cert_issue() {
     # install the certificate
     ~/.acme.sh/acme.sh --installcert -d ${domain} \
         --key-file /root/cert/${domain}/privkey.pem \
-        --fullchain-file /root/cert/${domain}/fullchain.pem
+        --fullchain-file /root/cert/${domain}/fullchain.pem \
+        --reloadcmd "systemctl kill --kill-who=main -s USR2 x-ui || true"
 
     if [ $? -ne 0 ]; then
         LOGE "Installing certificate failed, exiting."
@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"os"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/alireza0/x-ui/config"
 	"github.com/alireza0/x-ui/logger"
 	"github.com/alireza0/x-ui/util/common"
+	"github.com/alireza0/x-ui/util/geoip"
 
 	"github.com/xtls/xray-core/app/proxyman/command"
 	routingcommand "github.com/xtls/xray-core/app/router/command"
@@ -25,47 +27,155 @@ import (
 	"github.com/xtls/xray-core/proxy/vless"
 	"github.com/xtls/xray-core/proxy/vmess"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
+const apiCallTimeout = 10 * time.Second
+
+// XrayAPI is a long-lived gRPC client for the xray-core API. It is safe for
+// concurrent use: Init only dials when the API address changes, and the
+// underlying connection reconnects on its own when the core restarts.
 type XrayAPI struct {
-	HandlerServiceClient *command.HandlerServiceClient
-	RoutingServiceClient *routingcommand.RoutingServiceClient
-	StatsServiceClient   *statsService.StatsServiceClient
-	grpcClient           *grpc.ClientConn
-	isConnected          bool
+	mu            sync.RWMutex
+	apiAddr       string
+	grpcClient    *grpc.ClientConn
+	handlerClient command.HandlerServiceClient
+	routingClient routingcommand.RoutingServiceClient
+	statsClient   statsService.StatsServiceClient
+}
+
+type APIHealth struct {
+	Address   string `json:"address"`
+	State     string `json:"state"`
+	Connected bool   `json:"connected"`
+	Latency   int64  `json:"latency"`
+	Error     string `json:"error"`
+}
+
+func NewXrayAPI() *XrayAPI {
+	return &XrayAPI{}
 }
 
 func (x *XrayAPI) Init(apiAddr string) (err error) {
 	if apiAddr == "" {
 		return common.NewError("xray api port wrong:", apiAddr)
 	}
-	x.grpcClient, err = grpc.NewClient(apiAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return err
+
+	x.mu.RLock()
+	connected := x.grpcClient != nil && x.apiAddr == apiAddr
+	x.mu.RUnlock()
+	if connected {
+		return nil
 	}
-	x.isConnected = true
 
-	hsClient := command.NewHandlerServiceClient(x.grpcClient)
-	rsClient := routingcommand.NewRoutingServiceClient(x.grpcClient)
-	ssClient := statsService.NewStatsServiceClient(x.grpcClient)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.grpcClient != nil {
+		if x.apiAddr == apiAddr {
+			return nil
+		}
+		x.closeLocked()
+	}
 
-	x.HandlerServiceClient = &hsClient
-	x.RoutingServiceClient = &rsClient
-	x.StatsServiceClient = &ssClient
+	grpcClient, err := grpc.NewClient(apiAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	x.grpcClient = grpcClient
+	x.apiAddr = apiAddr
+	x.handlerClient = command.NewHandlerServiceClient(grpcClient)
+	x.routingClient = routingcommand.NewRoutingServiceClient(grpcClient)
+	x.statsClient = statsService.NewStatsServiceClient(grpcClient)
+	logger.Debug("xray api connected to", apiAddr)
 
 	return
 }
 
 func (x *XrayAPI) Close() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.closeLocked()
+}
+
+func (x *XrayAPI) closeLocked() {
 	if x.grpcClient != nil {
 		x.grpcClient.Close()
 		x.grpcClient = nil
 	}
-	x.HandlerServiceClient = nil
-	x.RoutingServiceClient = nil
-	x.StatsServiceClient = nil
-	x.isConnected = false
+	x.apiAddr = ""
+	x.handlerClient = nil
+	x.routingClient = nil
+	x.statsClient = nil
+}
+
+func (x *XrayAPI) IsConnected() bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.grpcClient == nil {
+		return false
+	}
+	return x.grpcClient.GetState() == connectivity.Ready
+}
+
+// Health probes the core with a cheap GetSysStats call and reports the
+// connection state along with the round-trip latency.
+func (x *XrayAPI) Health() APIHealth {
+	x.mu.RLock()
+	health := APIHealth{Address: x.apiAddr, State: connectivity.Shutdown.String()}
+	grpcClient := x.grpcClient
+	client := x.statsClient
+	x.mu.RUnlock()
+
+	if grpcClient == nil {
+		health.Error = "xray api is not initialized"
+		return health
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetSysStats(ctx, &statsService.SysStatsRequest{})
+	if err != nil {
+		health.Error = err.Error()
+	} else {
+		health.Latency = time.Since(start).Milliseconds()
+	}
+	state := grpcClient.GetState()
+	health.State = state.String()
+	health.Connected = err == nil && state == connectivity.Ready
+	return health
+}
+
+func (x *XrayAPI) handler() (command.HandlerServiceClient, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.handlerClient == nil {
+		return nil, common.NewError("handler api is not initialized")
+	}
+	return x.handlerClient, nil
+}
+
+func (x *XrayAPI) routing() (routingcommand.RoutingServiceClient, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.routingClient == nil {
+		return nil, common.NewError("routing api is not initialized")
+	}
+	return x.routingClient, nil
+}
+
+func (x *XrayAPI) stats() (statsService.StatsServiceClient, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.statsClient == nil {
+		return nil, common.NewError("xray api is not initialized")
+	}
+	return x.statsClient, nil
+}
+
+func callContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), apiCallTimeout)
 }
 
 func ensureGeodataAssetPath() {
@@ -76,8 +186,9 @@ func ensureGeodataAssetPath() {
 }
 
 func (x *XrayAPI) AddRule(ruleJSON []byte, shouldAppend bool) error {
-	if x.RoutingServiceClient == nil {
-		return common.NewError("routing api is not initialized")
+	client, err := x.routing()
+	if err != nil {
+		return err
 	}
 	ensureGeodataAssetPath()
 	rc := &conf.RouterConfig{RuleList: []json.RawMessage{ruleJSON}}
@@ -89,8 +200,9 @@ func (x *XrayAPI) AddRule(ruleJSON []byte, shouldAppend bool) error {
 	if len(built.Rule) == 0 {
 		return common.NewError("empty routing rule")
 	}
-	client := *x.RoutingServiceClient
-	_, err = client.AddRule(context.Background(), &routingcommand.AddRuleRequest{
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.AddRule(ctx, &routingcommand.AddRuleRequest{
 		Config:       serial.ToTypedMessage(built),
 		ShouldAppend: shouldAppend,
 	})
@@ -98,21 +210,26 @@ func (x *XrayAPI) AddRule(ruleJSON []byte, shouldAppend bool) error {
 }
 
 func (x *XrayAPI) DelRule(ruleTag string) error {
-	if x.RoutingServiceClient == nil {
-		return common.NewError("routing api is not initialized")
+	client, err := x.routing()
+	if err != nil {
+		return err
 	}
-	client := *x.RoutingServiceClient
-	_, err := client.RemoveRule(context.Background(), &routingcommand.RemoveRuleRequest{
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.RemoveRule(ctx, &routingcommand.RemoveRuleRequest{
 		RuleTag: ruleTag,
 	})
 	return err
 }
 
 func (x *XrayAPI) AddInbound(inbound []byte) error {
-	client := *x.HandlerServiceClient
+	client, err := x.handler()
+	if err != nil {
+		return err
+	}
 
 	conf := new(conf.InboundDetourConfig)
-	err := json.Unmarshal(inbound, conf)
+	err = json.Unmarshal(inbound, conf)
 	if err != nil {
 		logger.Debug("Failed to unmarshal inbound:", err)
 		return err
@@ -124,24 +241,34 @@ func (x *XrayAPI) AddInbound(inbound []byte) error {
 	}
 	inboundConfig := command.AddInboundRequest{Inbound: config}
 
-	_, err = client.AddInbound(context.Background(), &inboundConfig)
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.AddInbound(ctx, &inboundConfig)
 
 	return err
 }
 
 func (x *XrayAPI) DelInbound(tag string) error {
-	client := *x.HandlerServiceClient
-	_, err := client.RemoveInbound(context.Background(), &command.RemoveInboundRequest{
+	client, err := x.handler()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.RemoveInbound(ctx, &command.RemoveInboundRequest{
 		Tag: tag,
 	})
 	return err
 }
 
 func (x *XrayAPI) AddOutbound(outbound []byte) error {
-	client := *x.HandlerServiceClient
+	client, err := x.handler()
+	if err != nil {
+		return err
+	}
 
 	conf := new(conf.OutboundDetourConfig)
-	err := json.Unmarshal(outbound, conf)
+	err = json.Unmarshal(outbound, conf)
 	if err != nil {
 		logger.Debug("Failed to unmarshal outbound:", err)
 		return err
@@ -153,24 +280,31 @@ func (x *XrayAPI) AddOutbound(outbound []byte) error {
 	}
 	outboundConfig := command.AddOutboundRequest{Outbound: config}
 
-	_, err = client.AddOutbound(context.Background(), &outboundConfig)
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.AddOutbound(ctx, &outboundConfig)
 	return err
 }
 
 func (x *XrayAPI) DelOutbound(tag string) error {
-	client := *x.HandlerServiceClient
-	_, err := client.RemoveOutbound(context.Background(), &command.RemoveOutboundRequest{
+	client, err := x.handler()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.RemoveOutbound(ctx, &command.RemoveOutboundRequest{
 		Tag: tag,
 	})
 	return err
 }
 
 func (x *XrayAPI) HasOutbound(tag string) (bool, error) {
-	if x.HandlerServiceClient == nil {
-		return false, common.NewError("handler api is not initialized")
+	client, err := x.handler()
+	if err != nil {
+		return false, err
 	}
-	client := *x.HandlerServiceClient
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := callContext()
 	defer cancel()
 
 	resp, err := client.ListOutbounds(ctx, &command.ListOutboundsRequest{})
@@ -258,9 +392,13 @@ func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]in
 		return nil
 	}
 
-	client := *x.HandlerServiceClient
-
-	_, err := client.AlterInbound(context.Background(), &command.AlterInboundRequest{
+	client, err := x.handler()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.AlterInbound(ctx, &command.AlterInboundRequest{
 		Tag: inboundTag,
 		Operation: serial.ToTypedMessage(&command.AddUserOperation{
 			User: &protocol.User{
@@ -273,8 +411,13 @@ func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]in
 }
 
 func (x *XrayAPI) RemoveUser(inboundTag string, email string) error {
-	client := *x.HandlerServiceClient
-	_, err := client.AlterInbound(context.Background(), &command.AlterInboundRequest{
+	client, err := x.handler()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := callContext()
+	defer cancel()
+	_, err = client.AlterInbound(ctx, &command.AlterInboundRequest{
 		Tag: inboundTag,
 		Operation: serial.ToTypedMessage(&command.RemoveUserOperation{
 			Email: email,
@@ -284,11 +427,11 @@ func (x *XrayAPI) RemoveUser(inboundTag string, email string) error {
 }
 
 func (x *XrayAPI) GetUserOnlineIpList(email string) (map[string]int64, error) {
-	if x.StatsServiceClient == nil {
-		return nil, common.NewError("xray api is not initialized")
+	client, err := x.stats()
+	if err != nil {
+		return nil, err
 	}
-	client := *x.StatsServiceClient
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := callContext()
 	defer cancel()
 
 	resp, err := client.GetStatsOnlineIpList(ctx, &statsService.GetStatsRequest{
@@ -301,8 +444,9 @@ func (x *XrayAPI) GetUserOnlineIpList(email string) (map[string]int64, error) {
 }
 
 type OnlineUserInfo struct {
-	Email string           `json:"email"`
-	IPs   map[string]int64 `json:"ips"`
+	Email string                `json:"email"`
+	IPs   map[string]int64      `json:"ips"`
+	Geo   map[string]geoip.Info `json:"geo,omitempty"`
 }
 
 func userStatToOnlineUserInfo(user *statsService.UserStat) OnlineUserInfo {
@@ -319,11 +463,11 @@ func userStatToOnlineUserInfo(user *statsService.UserStat) OnlineUserInfo {
 }
 
 func (x *XrayAPI) GetUsersOnlineInfo() ([]OnlineUserInfo, error) {
-	if x.StatsServiceClient == nil {
-		return nil, common.NewError("xray api is not initialized")
+	client, err := x.stats()
+	if err != nil {
+		return nil, err
 	}
-	client := *x.StatsServiceClient
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := callContext()
 	defer cancel()
 
 	resp, err := client.GetUsersStats(ctx, &statsService.GetUsersStatsRequest{
@@ -345,14 +489,14 @@ func (x *XrayAPI) GetUsersOnlineInfo() ([]OnlineUserInfo, error) {
 }
 
 func (x *XrayAPI) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
-	if x.grpcClient == nil {
-		return nil, nil, common.NewError("xray api is not initialized")
+	client, err := x.stats()
+	if err != nil {
+		return nil, nil, err
 	}
 	trafficRegex := regexp.MustCompile("(inbound|outbound)>>>([^>]+)>>>traffic>>>(downlink|uplink)")
 	ClientTrafficRegex := regexp.MustCompile("(user)>>>([^>]+)>>>traffic>>>(downlink|uplink)")
 
-	client := *x.StatsServiceClient
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := callContext()
 	defer cancel()
 	request := &statsService.QueryStatsRequest{
 		Reset_: reset,
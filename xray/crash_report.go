@@ -0,0 +1,64 @@
+package xray
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alireza0/x-ui/config"
+	"github.com/alireza0/x-ui/util/common"
+)
+
+const crashReportPrefix = "core_crash_"
+
+type CrashReport struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+func writeCrashReport(m []byte) error {
+	crashReportPath := config.GetBinFolderPath() + "/" + crashReportPrefix + time.Now().Format("20060102_150405") + ".log"
+	return os.WriteFile(crashReportPath, m, os.ModePerm)
+}
+
+// GetCrashReports lists the crash reports in the bin folder, newest first.
+func GetCrashReports() ([]CrashReport, error) {
+	entries, err := os.ReadDir(config.GetBinFolderPath())
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]CrashReport, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, crashReportPrefix) || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		reports = append(reports, CrashReport{
+			Name: name,
+			Time: info.ModTime(),
+			Size: info.Size(),
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Time.After(reports[j].Time)
+	})
+	return reports, nil
+}
+
+func ReadCrashReport(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, crashReportPrefix) || !strings.HasSuffix(name, ".log") {
+		return "", common.NewError("invalid crash report name:", name)
+	}
+	data, err := os.ReadFile(filepath.Join(config.GetBinFolderPath(), name))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
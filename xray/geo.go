@@ -0,0 +1,263 @@
+package xray
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/config"
+	"github.com/alireza0/x-ui/util/common"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var geoFileNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*\.dat$`)
+
+// GeoFile describes a geo data file in the bin folder.
+type GeoFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Sha256  string    `json:"sha256"`
+	Builtin bool      `json:"builtin"`
+}
+
+type geoTagCache struct {
+	modTime time.Time
+	size    int64
+	tags    map[string]bool
+}
+
+var (
+	geoTagsLock sync.Mutex
+	geoTags     = map[string]*geoTagCache{}
+)
+
+func isBuiltinGeoFile(name string) bool {
+	return name == "geoip.dat" || name == "geosite.dat"
+}
+
+func CheckGeoFileName(name string) error {
+	if !geoFileNameRegex.MatchString(name) {
+		return common.NewError("invalid geo file name:", name)
+	}
+	return nil
+}
+
+func GetGeoFilePath(name string) string {
+	return filepath.Join(config.GetBinFolderPath(), name)
+}
+
+func fileSha256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func ListGeoFiles() ([]GeoFile, error) {
+	entries, err := os.ReadDir(config.GetBinFolderPath())
+	if err != nil {
+		return nil, err
+	}
+	files := make([]GeoFile, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !geoFileNameRegex.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		sum, err := fileSha256(GetGeoFilePath(entry.Name()))
+		if err != nil {
+			continue
+		}
+		files = append(files, GeoFile{
+			Name:    entry.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Sha256:  sum,
+			Builtin: isBuiltinGeoFile(entry.Name()),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// InstallGeoFile verifies the data read from r and atomically replaces the
+// geo file name with it. If expectedSha256 is set the data must match it.
+// It reports whether the file content actually changed.
+func InstallGeoFile(name string, r io.Reader, expectedSha256 string) (bool, error) {
+	if err := CheckGeoFileName(name); err != nil {
+		return false, err
+	}
+	target := GetGeoFilePath(name)
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-"+name)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if expectedSha256 != "" && !strings.EqualFold(sum, expectedSha256) {
+		return false, common.NewErrorf("checksum mismatch for %s: expected %s, got %s", name, expectedSha256, sum)
+	}
+	if current, err := fileSha256(target); err == nil && current == sum {
+		return false, nil
+	}
+	if _, err = readGeoTags(tmp.Name()); err != nil {
+		return false, common.NewErrorf("%s is not a valid geo data file: %v", name, err)
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func RemoveGeoFile(name string) error {
+	if err := CheckGeoFileName(name); err != nil {
+		return err
+	}
+	if isBuiltinGeoFile(name) {
+		return common.NewError("can not remove builtin geo file:", name)
+	}
+	return os.Remove(GetGeoFilePath(name))
+}
+
+// readGeoTags returns the upper-cased codes of a geoip or geosite list. Both
+// are a repeated message in field 1 whose first field is the code, so the
+// file is walked on the wire level instead of decoding every entry.
+func readGeoTags(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]bool{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num != 1 || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		entry, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		for len(entry) > 0 {
+			num, typ, n := protowire.ConsumeTag(entry)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			entry = entry[n:]
+			if num == 1 && typ == protowire.BytesType {
+				code, n := protowire.ConsumeBytes(entry)
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+				tags[strings.ToUpper(string(code))] = true
+				break
+			}
+			n = protowire.ConsumeFieldValue(num, typ, entry)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			entry = entry[n:]
+		}
+	}
+	if len(tags) == 0 {
+		return nil, common.NewError("no entries found")
+	}
+	return tags, nil
+}
+
+func getGeoTags(name string) (map[string]bool, error) {
+	path := GetGeoFilePath(name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, common.NewError("geo file not found:", name)
+	}
+
+	geoTagsLock.Lock()
+	defer geoTagsLock.Unlock()
+	cache, ok := geoTags[name]
+	if ok && cache.modTime.Equal(info.ModTime()) && cache.size == info.Size() {
+		return cache.tags, nil
+	}
+	tags, err := readGeoTags(path)
+	if err != nil {
+		return nil, err
+	}
+	geoTags[name] = &geoTagCache{modTime: info.ModTime(), size: info.Size(), tags: tags}
+	return tags, nil
+}
+
+// ValidateGeoReference checks that a routing value such as "geosite:cn" or
+// "ext:custom.dat:ir" refers to a geo file and code that exist. Values of any
+// other form are accepted as is.
+func ValidateGeoReference(value string) error {
+	var file, code string
+	switch {
+	case strings.HasPrefix(value, "geosite:"):
+		file, code = "geosite.dat", strings.TrimPrefix(value, "geosite:")
+	case strings.HasPrefix(value, "geoip:"):
+		file, code = "geoip.dat", strings.TrimPrefix(value, "geoip:")
+	case strings.HasPrefix(value, "ext:"):
+		parts := strings.SplitN(strings.TrimPrefix(value, "ext:"), ":", 2)
+		if len(parts) != 2 {
+			return common.NewError("invalid external geo reference:", value)
+		}
+		file, code = parts[0], parts[1]
+	default:
+		return nil
+	}
+
+	code = strings.TrimPrefix(code, "!")
+	if i := strings.Index(code, "@"); i >= 0 {
+		code = code[:i]
+	}
+	if err := CheckGeoFileName(file); err != nil {
+		return err
+	}
+	tags, err := getGeoTags(file)
+	if err != nil {
+		return common.NewErrorf("%s: %v", value, err)
+	}
+	if !tags[strings.ToUpper(code)] {
+		return common.NewErrorf("%s: code %q not found in %s", value, code, file)
+	}
+	return nil
+}
@@ -3,16 +3,44 @@ package xray
 import (
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/alireza0/x-ui/logger"
 )
 
+// xrayLog logs core output under the "xray" component, so its level can be
+// set apart from the panel with XUI_LOG_LEVELS.
+var xrayLog = logger.WithComponent("xray")
+
 func NewLogWriter() *LogWriter {
 	return &LogWriter{}
 }
 
+// maxLastLines is how many recent core output lines are kept for restart
+// history entries.
+const maxLastLines = 20
+
 type LogWriter struct {
 	lastLine string
+
+	mu        sync.Mutex
+	lastLines []string
+}
+
+// LastLines returns a copy of the most recent lines written by the core.
+func (lw *LogWriter) LastLines() []string {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return append([]string(nil), lw.lastLines...)
+}
+
+func (lw *LogWriter) remember(line string) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.lastLines = append(lw.lastLines, line)
+	if len(lw.lastLines) > maxLastLines {
+		lw.lastLines = lw.lastLines[len(lw.lastLines)-maxLastLines:]
+	}
 }
 
 func (lw *LogWriter) Write(m []byte) (n int, err error) {
@@ -25,6 +53,7 @@ func (lw *LogWriter) Write(m []byte) (n int, err error) {
 	if crashRegex.MatchString(message) {
 		logger.Debug("Core crash detected:\n", message)
 		lw.lastLine = message
+		lw.remember(message)
 		err1 := writeCrashReport(m)
 		if err1 != nil {
 			logger.Error("Unable to write crash report:", err1)
@@ -36,34 +65,48 @@ func (lw *LogWriter) Write(m []byte) (n int, err error) {
 	messages := strings.SplitSeq(message, "\n")
 
 	for msg := range messages {
+		if msg != "" {
+			lw.remember(msg)
+		}
 		matches := regex.FindStringSubmatch(msg)
 
 		if len(matches) > 3 {
 			level := matches[2]
 			msgBody := matches[3]
+			// the core level is only written where the line is logged at
+			// another level
+			relevelled := xrayLog.With("coreLevel", strings.ToLower(level))
 			msgBodyLower := strings.ToLower(msgBody)
 
 			if strings.Contains(msgBodyLower, "tls handshake error") ||
 				strings.Contains(msgBodyLower, "connection ends") {
-				logger.Debug("XRAY: " + msgBody)
+				if level == "Debug" {
+					xrayLog.Debug(msgBody)
+				} else {
+					relevelled.Debug(msgBody)
+				}
 				lw.lastLine = ""
 				continue
 			}
 
 			if strings.Contains(msgBodyLower, "failed") {
-				logger.Error("XRAY: " + msgBody)
+				if level == "Error" {
+					xrayLog.Error(msgBody)
+				} else {
+					relevelled.Error(msgBody)
+				}
 			} else {
 				switch level {
 				case "Debug":
-					logger.Debug("XRAY: " + msgBody)
+					xrayLog.Debug(msgBody)
 				case "Info":
-					logger.Info("XRAY: " + msgBody)
+					xrayLog.Info(msgBody)
 				case "Warning":
-					logger.Warning("XRAY: " + msgBody)
+					xrayLog.Warning(msgBody)
 				case "Error":
-					logger.Error("XRAY: " + msgBody)
+					xrayLog.Error(msgBody)
 				default:
-					logger.Debug("XRAY: " + msg)
+					relevelled.Debug(msg)
 				}
 			}
 			lw.lastLine = ""
@@ -72,15 +115,15 @@ func (lw *LogWriter) Write(m []byte) (n int, err error) {
 
 			if strings.Contains(msgLower, "tls handshake error") ||
 				strings.Contains(msgLower, "connection ends") {
-				logger.Debug("XRAY: " + msg)
+				xrayLog.Debug(msg)
 				lw.lastLine = msg
 				continue
 			}
 
 			if strings.Contains(msgLower, "failed") {
-				logger.Error("XRAY: " + msg)
+				xrayLog.Error(msg)
 			} else {
-				logger.Debug("XRAY: " + msg)
+				xrayLog.Debug(msg)
 			}
 			lw.lastLine = msg
 		}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
@@ -29,6 +30,10 @@ func GetConfigPath() string {
 	return config.GetBinFolderPath() + "/config.json"
 }
 
+func GetLastGoodConfigPath() string {
+	return config.GetBinFolderPath() + "/config.good.json"
+}
+
 func GetGeositePath() string {
 	return config.GetBinFolderPath() + "/geosite.dat"
 }
@@ -61,13 +66,21 @@ type process struct {
 
 	config    *Config
 	logWriter *LogWriter
+
+	// mu guards the exit state, which the goroutine waiting for the core
+	// writes while the panel reads it
+	mu        sync.RWMutex
 	exitErr   error
+	exitCode  int
+	exitTime  time.Time
+	stopped   bool
 	startTime time.Time
 }
 
 func newProcess(config *Config) *process {
 	return &process{
 		version:   "Unknown",
+		exitCode:  -1,
 		config:    config,
 		logWriter: NewLogWriter(),
 		startTime: time.Now(),
@@ -78,23 +91,61 @@ func (p *process) IsRunning() bool {
 	if p.cmd == nil || p.cmd.Process == nil {
 		return false
 	}
-	if p.cmd.ProcessState == nil {
-		return true
-	}
-	return false
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.exitTime.IsZero()
 }
 
 func (p *process) GetErr() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.exitErr
 }
 
 func (p *process) GetResult() string {
-	if len(p.logWriter.lastLine) == 0 && p.exitErr != nil {
-		return p.exitErr.Error()
+	if err := p.GetErr(); len(p.logWriter.lastLine) == 0 && err != nil {
+		return err.Error()
 	}
 	return p.logWriter.lastLine
 }
 
+// HasExited reports whether the core terminated on its own, as opposed to
+// never being started or being stopped by the panel.
+func (p *process) HasExited() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return !p.stopped && !p.exitTime.IsZero()
+}
+
+func (p *process) GetExitCode() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.exitCode
+}
+
+func (p *process) GetExitTime() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.exitTime
+}
+
+// setExit records how the core ended.
+func (p *process) setExit(err error, code int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.exitErr = err
+	}
+	if code >= 0 {
+		p.exitCode = code
+	}
+	p.exitTime = time.Now()
+}
+
+func (p *process) GetLastLines() []string {
+	return p.logWriter.LastLines()
+}
+
 func (p *process) GetVersion() string {
 	return p.version
 }
@@ -146,7 +197,7 @@ func (p *process) Start() (err error) {
 	defer func() {
 		if err != nil {
 			logger.Error("Failure in running xray-core process: ", err)
-			p.exitErr = err
+			p.setExit(err, -1)
 		}
 	}()
 
@@ -166,12 +217,20 @@ func (p *process) Start() (err error) {
 	cmd.Stdout = p.logWriter
 	cmd.Stderr = p.logWriter
 
+	// start here so cmd.Process is set before anyone looks at it
+	if err = cmd.Start(); err != nil {
+		return err
+	}
 	go func() {
-		err := cmd.Run()
+		err := cmd.Wait()
 		if err != nil {
 			logger.Error("Failure in running xray-core: ", err)
-			p.exitErr = err
 		}
+		code := -1
+		if cmd.ProcessState != nil {
+			code = cmd.ProcessState.ExitCode()
+		}
+		p.setExit(err, code)
 	}()
 
 	p.refreshVersion()
@@ -185,14 +244,12 @@ func (p *process) Stop() error {
 		return errors.New("xray is not running")
 	}
 
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
 	if runtime.GOOS == "windows" {
 		return p.cmd.Process.Kill()
 	} else {
 		return p.cmd.Process.Signal(syscall.SIGTERM)
 	}
 }
-
-func writeCrashReport(m []byte) error {
-	crashReportPath := config.GetBinFolderPath() + "/core_crash_" + time.Now().Format("20060102_150405") + ".log"
-	return os.WriteFile(crashReportPath, m, os.ModePerm)
-}
@@ -0,0 +1,218 @@
+package xray
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alireza0/x-ui/logger"
+)
+
+const (
+	restartBackoffMin = 5 * time.Second
+	restartBackoffMax = 5 * time.Minute
+
+	// The core is considered crash-looping once it exits crashLoopThreshold
+	// times in a row within crashLoopWindow without ever becoming stable.
+	crashLoopThreshold = 5
+	crashLoopWindow    = 10 * time.Minute
+
+	// stableUptime is how long the core must stay up before its config is
+	// remembered as the last known-good one.
+	stableUptime = time.Minute
+
+	maxRestartHistory = 50
+)
+
+// RestartEvent describes one unexpected exit of the core.
+type RestartEvent struct {
+	Time       time.Time `json:"time"`
+	ExitCode   int       `json:"exitCode"`
+	Error      string    `json:"error"`
+	Uptime     uint64    `json:"uptime"`
+	LastLines  []string  `json:"lastLines"`
+	CrashLoop  bool      `json:"crashLoop"`
+	RolledBack bool      `json:"rolledBack"`
+}
+
+// SupervisorState is a snapshot of the supervisor for the panel.
+type SupervisorState struct {
+	Crashes     int            `json:"crashes"`
+	Failures    int            `json:"failures"`
+	CrashLoop   bool           `json:"crashLoop"`
+	RolledBack  bool           `json:"rolledBack"`
+	NextRestart time.Time      `json:"nextRestart"`
+	HasLastGood bool           `json:"hasLastGood"`
+	History     []RestartEvent `json:"history"`
+}
+
+// Supervisor decides when a crashed core may be restarted and with which
+// config. It applies exponential backoff between restarts, detects crash
+// loops and falls back to the last config that ran stable.
+type Supervisor struct {
+	mu sync.Mutex
+
+	history     []RestartEvent
+	crashes     int
+	failures    int
+	nextRestart time.Time
+	recorded    *process
+
+	lastGood   *Config
+	badConfig  *Config
+	crashLoop  bool
+	rolledBack bool
+}
+
+func NewSupervisor() *Supervisor {
+	s := &Supervisor{}
+	data, err := os.ReadFile(GetLastGoodConfigPath())
+	if err == nil {
+		cfg := &Config{}
+		if json.Unmarshal(data, cfg) == nil {
+			s.lastGood = cfg
+		}
+	}
+	return s
+}
+
+// MarkRunning is called periodically while the core is up. Once it has been
+// running for stableUptime the backoff is reset and its config is kept as the
+// last known-good one.
+func (s *Supervisor) MarkRunning(p *Process) {
+	if time.Since(p.startTime) < stableUptime {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = 0
+	s.crashLoop = false
+	if s.lastGood != nil && s.lastGood.Equals(p.config) {
+		return
+	}
+	s.lastGood = p.config
+	data, err := json.MarshalIndent(p.config, "", "  ")
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(GetLastGoodConfigPath(), data, 0o644)
+	if err != nil {
+		logger.Warning("Unable to save last known-good xray config:", err)
+	}
+}
+
+// RecordExit registers an unexpected exit of p and schedules the next
+// restart. It returns nil when this exit was already recorded.
+func (s *Supervisor) RecordExit(p *Process) *RestartEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recorded == p.process {
+		return nil
+	}
+	s.recorded = p.process
+
+	exitTime := p.GetExitTime()
+	event := RestartEvent{
+		Time:      exitTime,
+		ExitCode:  p.GetExitCode(),
+		Uptime:    uint64(exitTime.Sub(p.startTime).Seconds()),
+		LastLines: p.GetLastLines(),
+	}
+	if err := p.GetErr(); err != nil {
+		event.Error = err.Error()
+	}
+
+	s.crashes++
+	s.failures++
+	delay := restartBackoffMin << min(s.failures-1, 16)
+	if delay > restartBackoffMax {
+		delay = restartBackoffMax
+	}
+	s.nextRestart = exitTime.Add(delay)
+
+	if !s.crashLoop && s.failures >= crashLoopThreshold {
+		first := s.history[len(s.history)-(crashLoopThreshold-1)]
+		if exitTime.Sub(first.Time) <= crashLoopWindow {
+			s.crashLoop = true
+			s.badConfig = p.config
+			event.CrashLoop = true
+		}
+	}
+
+	s.history = append(s.history, event)
+	if len(s.history) > maxRestartHistory {
+		s.history = s.history[len(s.history)-maxRestartHistory:]
+	}
+
+	logger.Warningf("xray exited unexpectedly (code %d), next restart in %s", event.ExitCode, delay)
+	return &event
+}
+
+// ReadyToRestart reports whether the backoff delay has elapsed.
+func (s *Supervisor) ReadyToRestart() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !time.Now().Before(s.nextRestart)
+}
+
+// RestartConfig picks the config for the next restart. While crash-looping it
+// returns the last known-good config instead of generated, if one differs.
+// The returned event is non-nil when this call started the rollback.
+func (s *Supervisor) RestartConfig(generated *Config) (*Config, *RestartEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rolledBack {
+		return s.lastGood, nil
+	}
+	if !s.crashLoop || s.lastGood == nil || (generated != nil && s.lastGood.Equals(generated)) {
+		return generated, nil
+	}
+	s.rolledBack = true
+	logger.Warning("xray is crash-looping, rolling back to the last known-good config")
+	if len(s.history) == 0 {
+		return s.lastGood, &RestartEvent{Time: time.Now(), RolledBack: true}
+	}
+	s.history[len(s.history)-1].RolledBack = true
+	event := s.history[len(s.history)-1]
+	return s.lastGood, &event
+}
+
+// KeepRollback reports whether a rollback is active and generated is still
+// the config that crash-looped, so a routine restart should not replace the
+// known-good config with it.
+func (s *Supervisor) KeepRollback(generated *Config) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rolledBack && s.badConfig != nil && s.badConfig.Equals(generated)
+}
+
+// Reset clears backoff and rollback state, e.g. after a manual restart or a
+// config change.
+func (s *Supervisor) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = 0
+	s.nextRestart = time.Time{}
+	s.crashLoop = false
+	s.rolledBack = false
+	s.badConfig = nil
+}
+
+func (s *Supervisor) GetState() SupervisorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SupervisorState{
+		Crashes:     s.crashes,
+		Failures:    s.failures,
+		CrashLoop:   s.crashLoop,
+		RolledBack:  s.rolledBack,
+		NextRestart: s.nextRestart,
+		HasLastGood: s.lastGood != nil,
+		History:     append([]RestartEvent(nil), s.history...),
+	}
+}
@@ -0,0 +1,192 @@
+package xray
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alireza0/x-ui/config"
+	"github.com/alireza0/x-ui/util/common"
+)
+
+var versionNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// InstalledVersion is a core binary kept in the versions folder.
+type InstalledVersion struct {
+	Version     string    `json:"version"`
+	Active      bool      `json:"active"`
+	Size        int64     `json:"size"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+func GetVersionsFolderPath() string {
+	return config.GetBinFolderPath() + "/xray-versions"
+}
+
+func getActiveMarkerPath() string {
+	return GetVersionsFolderPath() + "/active"
+}
+
+func getVersionBinaryPath(version string) string {
+	return filepath.Join(GetVersionsFolderPath(), version, GetBinaryName())
+}
+
+// getActiveBinaryPath is where the active core is copied to and started from.
+func getActiveBinaryPath() string {
+	if runtime.GOOS == "windows" {
+		return GetBinaryPath() + ".exe"
+	}
+	return GetBinaryPath()
+}
+
+// CheckVersionName rejects names that are unsafe in a path or a url.
+func CheckVersionName(version string) error {
+	if !versionNameRegex.MatchString(version) || version == "active" {
+		return common.NewError("invalid xray version:", version)
+	}
+	return nil
+}
+
+func GetActiveVersion() string {
+	data, err := os.ReadFile(getActiveMarkerPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ReadBinaryVersion runs the binary at path and returns its version as a
+// release tag, e.g. "v25.8.3".
+func ReadBinaryVersion(path string) (string, error) {
+	data, err := exec.Command(path, "-version").Output()
+	if err != nil {
+		return "", err
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return "", common.NewError("unable to parse xray version output")
+	}
+	return "v" + strings.TrimPrefix(string(fields[1]), "v"), nil
+}
+
+// TrackCurrentBinary adds the binary installed before versions were kept
+// side by side to the versions folder, so it can be switched back to.
+func TrackCurrentBinary() error {
+	if GetActiveVersion() != "" {
+		return nil
+	}
+	binaryPath := getActiveBinaryPath()
+	if _, err := os.Stat(binaryPath); err != nil {
+		return nil
+	}
+	version, err := ReadBinaryVersion(binaryPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(binaryPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = InstallVersion(version, file); err != nil {
+		return err
+	}
+	return os.WriteFile(getActiveMarkerPath(), []byte(version), 0o644)
+}
+
+func ListInstalledVersions() ([]InstalledVersion, error) {
+	entries, err := os.ReadDir(GetVersionsFolderPath())
+	if os.IsNotExist(err) {
+		return []InstalledVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	active := GetActiveVersion()
+	versions := make([]InstalledVersion, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := os.Stat(getVersionBinaryPath(entry.Name()))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, InstalledVersion{
+			Version:     entry.Name(),
+			Active:      entry.Name() == active,
+			Size:        info.Size(),
+			InstalledAt: info.ModTime(),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].InstalledAt.After(versions[j].InstalledAt)
+	})
+	return versions, nil
+}
+
+// InstallVersion stores the core binary read from r under version.
+func InstallVersion(version string, r io.Reader) error {
+	if err := CheckVersionName(version); err != nil {
+		return err
+	}
+	target := getVersionBinaryPath(version)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(target, r)
+}
+
+// ActivateVersion copies the binary of version over the active core binary.
+// The core has to be restarted for it to take effect.
+func ActivateVersion(version string) error {
+	if err := CheckVersionName(version); err != nil {
+		return err
+	}
+	file, err := os.Open(getVersionBinaryPath(version))
+	if err != nil {
+		return common.NewError("xray version is not installed:", version)
+	}
+	defer file.Close()
+	if err = writeFileAtomic(getActiveBinaryPath(), file); err != nil {
+		return err
+	}
+	return os.WriteFile(getActiveMarkerPath(), []byte(version), 0o644)
+}
+
+func RemoveVersion(version string) error {
+	if err := CheckVersionName(version); err != nil {
+		return err
+	}
+	if version == GetActiveVersion() {
+		return common.NewError("can not remove the active xray version:", version)
+	}
+	return os.RemoveAll(filepath.Join(GetVersionsFolderPath(), version))
+}
+
+func writeFileAtomic(target string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-"+filepath.Base(target))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}